@@ -1,5 +1,5 @@
 module github.com/batchatco/go-native-netcdf
 
-go 1.14
+go 1.18
 
 require github.com/batchatco/go-thrower v0.0.0-20200827035905-5cb7337f6be6
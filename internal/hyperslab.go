@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"errors"
+	"reflect"
+)
+
+// CheckHyperslab validates hyperslab parameters against the dimension lengths
+// of a variable.  A nil stride means a stride of one in every dimension.
+// It returns the stride to use and false if the parameters are invalid.
+func CheckHyperslab(dimLengths []uint64, start, count, stride []int64) ([]int64, bool) {
+	if stride == nil {
+		stride = make([]int64, len(dimLengths))
+		for i := range stride {
+			stride[i] = 1
+		}
+	}
+	if len(start) != len(dimLengths) || len(count) != len(dimLengths) ||
+		len(stride) != len(dimLengths) {
+		return nil, false
+	}
+	for i, dimLength := range dimLengths {
+		if start[i] < 0 || count[i] < 0 || stride[i] < 1 {
+			return nil, false
+		}
+		if count[i] == 0 {
+			if uint64(start[i]) > dimLength {
+				return nil, false
+			}
+			continue
+		}
+		last := start[i] + (count[i]-1)*stride[i]
+		if last < start[i] || uint64(last) >= dimLength {
+			return nil, false
+		}
+	}
+	return stride, true
+}
+
+// CheckReadInto validates the parameters of ReadInto against the dimension
+// lengths of a variable.  Nil start and count select the whole variable.  It
+// returns the start, count and stride (of one) to use.  dst must have room for
+// all the values.
+func CheckReadInto(dimLengths []uint64, dst interface{}, start, count []int64) (
+	[]int64, []int64, []int64, error) {
+	if start == nil && count == nil {
+		start = make([]int64, len(dimLengths))
+		count = make([]int64, len(dimLengths))
+		for i, dimLength := range dimLengths {
+			count[i] = int64(dimLength)
+		}
+	}
+	stride, ok := CheckHyperslab(dimLengths, start, count, nil)
+	if !ok {
+		return nil, nil, nil, errors.New("invalid hyperslab parameters")
+	}
+	n := int64(1)
+	for _, c := range count {
+		n *= c
+	}
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Slice {
+		return nil, nil, nil, errors.New("destination is not a slice")
+	}
+	if int64(v.Len()) < n {
+		return nil, nil, nil, errors.New("destination slice too short")
+	}
+	return start, count, stride, nil
+}
+
+// HyperslabRuns calls f for each run of contiguous elements in the hyperslab,
+// in row-major order.  The offset and length of each run are in elements,
+// relative to the start of the variable.  Adjacent dimensions are merged into
+// a single run when possible, so a hyperslab covering the whole variable is
+// one run.
+func HyperslabRuns(dimLengths []uint64, start, count, stride []int64,
+	f func(offset, length int64)) {
+	nDims := len(dimLengths)
+	for _, c := range count {
+		if c == 0 {
+			return
+		}
+	}
+	// Distance in elements between neighbours in each dimension.
+	dimStride := make([]int64, nDims)
+	size := int64(1)
+	for i := nDims - 1; i >= 0; i-- {
+		dimStride[i] = size
+		size *= int64(dimLengths[i])
+	}
+	// Dimensions from inner onwards are covered by a single run.
+	inner := nDims
+	runLength := int64(1)
+	for inner > 0 {
+		d := inner - 1
+		if stride[d] != 1 && count[d] != 1 {
+			break
+		}
+		runLength *= count[d]
+		inner = d
+		if uint64(count[d]) != dimLengths[d] {
+			break
+		}
+	}
+	index := make([]int64, inner)
+	for {
+		offset := int64(0)
+		for d := 0; d < nDims; d++ {
+			pos := start[d]
+			if d < inner {
+				pos += index[d] * stride[d]
+			}
+			offset += pos * dimStride[d]
+		}
+		f(offset, runLength)
+
+		// Advance to the next run, innermost outer dimension first.
+		d := inner - 1
+		for ; d >= 0; d-- {
+			index[d]++
+			if index[d] < count[d] {
+				break
+			}
+			index[d] = 0
+		}
+		if d < 0 {
+			return
+		}
+	}
+}
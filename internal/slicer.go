@@ -6,12 +6,14 @@ import (
 )
 
 type slice struct {
-	getSlice func(begin, end int64) (interface{}, error)
-	length   int64
-	dimNames []string
-	attrs    api.AttributeMap
-	cdlType  string
-	goType   string
+	getSlice     func(begin, end int64) (interface{}, error)
+	getHyperslab func(start, count, stride []int64) (interface{}, error)
+	readInto     func(dst interface{}, start, count []int64) error
+	length       int64
+	dimNames     []string
+	attrs        api.AttributeMap
+	cdlType      string
+	goType       string
 }
 
 func (sl *slice) GetSlice(begin, end int64) (slice interface{}, err error) {
@@ -20,6 +22,17 @@ func (sl *slice) GetSlice(begin, end int64) (slice interface{}, err error) {
 	return slice, err
 }
 
+func (sl *slice) GetHyperslab(start, count, stride []int64) (slice interface{}, err error) {
+	defer thrower.RecoverError(&err)
+	slice, err = sl.getHyperslab(start, count, stride)
+	return slice, err
+}
+
+func (sl *slice) ReadInto(dst interface{}, start, count []int64) (err error) {
+	defer thrower.RecoverError(&err)
+	return sl.readInto(dst, start, count)
+}
+
 func (sl *slice) Values() (values interface{}, err error) {
 	defer thrower.RecoverError(&err)
 	values, err = sl.getSlice(0, sl.length)
@@ -47,14 +60,18 @@ func (sl *slice) GoType() string {
 }
 
 func NewSlicer(getSlice func(begin, end int64) (interface{}, error),
+	getHyperslab func(start, count, stride []int64) (interface{}, error),
+	readInto func(dst interface{}, start, count []int64) error,
 	length int64, dimNames []string, attributes api.AttributeMap,
 	cdlType string, goType string) api.VarGetter {
 	return &slice{
-		getSlice: getSlice,
-		length:   length,
-		dimNames: dimNames,
-		attrs:    attributes,
-		cdlType:  cdlType,
-		goType:   goType,
+		getSlice:     getSlice,
+		getHyperslab: getHyperslab,
+		readInto:     readInto,
+		length:       length,
+		dimNames:     dimNames,
+		attrs:        attributes,
+		cdlType:      cdlType,
+		goType:       goType,
 	}
 }
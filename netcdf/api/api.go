@@ -37,6 +37,19 @@ type VarGetter interface {
 	// It's useful for variables which are very large and may not fit in memory.
 	GetSlice(begin, end int64) (interface{}, error)
 
+	// GetHyperslab gets an N-dimensional subset of the variable.  For each
+	// dimension, start is the first index, count is the number of elements and
+	// stride is the step between them.  A nil stride means a stride of one.
+	// Unlike GetSlice, only the data in the hyperslab is read.
+	GetHyperslab(start, count, stride []int64) (interface{}, error)
+
+	// ReadInto reads the values with the given start and count in each
+	// dimension into dst, which is a flat slice of the variable's base type,
+	// in row-major order.  Characters are read as bytes.  Unlike the other
+	// methods, no nested slices are made, so dst can be reused.  It must have
+	// room for all the values.  Nil start and count read the whole variable.
+	ReadInto(dst interface{}, start, count []int64) error
+
 	Dimensions() []string
 
 	Attributes() AttributeMap
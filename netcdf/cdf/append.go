@@ -0,0 +1,215 @@
+package cdf
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"math"
+	"os"
+	"reflect"
+
+	"github.com/batchatco/go-native-netcdf/internal"
+	"github.com/batchatco/go-native-netcdf/netcdf/api"
+	"github.com/batchatco/go-native-netcdf/netcdf/util"
+	"github.com/batchatco/go-thrower"
+)
+
+// OpenAppend opens an existing CDF file to change it in place.  Records can be
+// appended with AppendRecord, the values of the other variables overwritten
+// with WriteSlab, and attributes set with SetAttribute.  No dimensions or
+// variables can be added.  The file must be closed to write out the number of
+// records.
+func OpenAppend(fileName string) (*CDFWriter, error) {
+	file, err := os.OpenFile(fileName, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	g, err := New(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	cw, err := newAppender(g.(*CDF), file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return cw, nil
+}
+
+// newAppender returns a writer for the file with the header read by c, with
+// its header already written and positioned after the last record.
+func newAppender(c *CDF, file *os.File) (cw *CDFWriter, err error) {
+	defer thrower.RecoverError(&err)
+	cw = &CDFWriter{
+		file:          file,
+		globalAttrs:   allAttrs(c.globalAttrs),
+		dimLengths:    make(map[string]int64),
+		dimIds:        make(map[string]int64),
+		version:       int8(c.version),
+		format:        Format(c.version),
+		headerWritten: true,
+		numRecs:       int64(c.numRecs)}
+	for _, dim := range c.dimensions {
+		cw.dimLengths[dim.name] = int64(dim.dimLength)
+		cw.dimIds[dim.name] = cw.nextID
+		cw.dimNames = append(cw.dimNames, dim.name)
+		cw.nextID++
+	}
+	for _, name := range c.vars.Keys() {
+		val, _ := c.vars.Get(name)
+		v := val.(variable)
+		saved := savedVar{name: name, ty: int(v.vType), attrs: v.attrs, begin: int64(v.begin)}
+		for _, dimid := range v.dimids {
+			dim := c.dimensions[dimid]
+			saved.dimLengths = append(saved.dimLengths, int64(dim.dimLength))
+			saved.dimNames = append(saved.dimNames, dim.name)
+		}
+		saved.vsize = cw.varSize(&saved)
+		saved.val = emptyValues(v.vType, len(v.dimids))
+		cw.vars = append(cw.vars, saved)
+	}
+
+	// Records are appended after the last one.
+	end, err := file.Seek(0, io.SeekEnd)
+	thrower.ThrowIfError(err)
+	var recordVars []*savedVar
+	for i := range cw.vars {
+		if cw.vars[i].isRecord() {
+			recordVars = append(recordVars, &cw.vars[i])
+		}
+	}
+	if len(recordVars) > 0 {
+		recSize := int64(0)
+		for _, saved := range recordVars {
+			recSize += saved.vsize
+		}
+		if len(recordVars) == 1 {
+			// not padded
+			saved := recordVars[0]
+			recSize = typeSize(uint32(saved.ty))
+			for _, length := range saved.dimLengths[1:] {
+				recSize *= length
+			}
+		}
+		end = recordVars[0].begin + cw.numRecs*recSize
+	}
+	_, err = file.Seek(end, io.SeekStart)
+	thrower.ThrowIfError(err)
+	cw.bf = &countedWriter{bufio.NewWriter(file), end}
+	return cw, nil
+}
+
+// allAttrs returns the attributes, including the hidden _NCProperties, so
+// that they can be written out again.
+func allAttrs(attrs *util.OrderedMap) api.AttributeMap {
+	keys := attrs.Keys()
+	if _, has := attrs.Get(ncpKey); has {
+		keys = append([]string{ncpKey}, keys...)
+	}
+	values := make(map[string]interface{})
+	for _, key := range keys {
+		values[key], _ = attrs.Get(key)
+	}
+	om, err := util.NewOrderedMap(keys, values)
+	thrower.ThrowIfError(err)
+	return om
+}
+
+// emptyValues returns an empty slice of the type of the values of a
+// variable, as AddVar takes it.
+func emptyValues(vType uint32, nDims int) interface{} {
+	t := reflect.TypeOf(makeData(vType, 0)).Elem()
+	if vType == typeChar {
+		t = reflect.TypeOf("")
+		if nDims > 1 {
+			nDims-- // the length of the strings
+		}
+	}
+	for i := 0; i < nDims; i++ {
+		t = reflect.SliceOf(t)
+	}
+	return reflect.MakeSlice(t, 0, 0).Interface()
+}
+
+func (cw *CDFWriter) findVar(name string) *savedVar {
+	for i := range cw.vars {
+		if cw.vars[i].name == name {
+			return &cw.vars[i]
+		}
+	}
+	return nil
+}
+
+// SetAttribute sets an attribute of the named variable, or a global attribute
+// if the name is empty.  Once the header has been written, because the file
+// was opened by OpenAppend or a record was appended, the header is written
+// again in place.  ErrHeaderFull is returned if it no longer fits before the
+// data.
+func (cw *CDFWriter) SetAttribute(varName string, attrName string, val interface{}) (err error) {
+	defer thrower.RecoverError(&err)
+	if !internal.IsValidNetCDFName(attrName) {
+		return ErrInvalidName
+	}
+	attrs := &cw.globalAttrs
+	if varName != "" {
+		saved := cw.findVar(varName)
+		if saved == nil {
+			return ErrNotFound
+		}
+		attrs = &saved.attrs
+	}
+	// The attributes may belong to the caller, so they are copied.
+	var keys []string
+	values := make(map[string]interface{})
+	if *attrs != nil {
+		for _, key := range (*attrs).Keys() {
+			keys = append(keys, key)
+			values[key], _ = (*attrs).Get(key)
+		}
+	}
+	if _, has := values[attrName]; !has {
+		keys = append(keys, attrName)
+	}
+	values[attrName] = val
+	newAttrs, err := util.NewOrderedMap(keys, values)
+	thrower.ThrowIfError(err)
+	// Once the header is written, the format is fixed.
+	cw.checkV5Attributes(newAttrs)
+	if !cw.headerWritten {
+		*attrs = newAttrs
+		return nil
+	}
+	oldAttrs := *attrs
+	*attrs = newAttrs
+	header := cw.headerBytes()
+	if int64(len(header)) > cw.dataStart() {
+		*attrs = oldAttrs
+		return ErrHeaderFull
+	}
+	thrower.ThrowIfError(cw.bf.Flush())
+	_, err = cw.file.WriteAt(header, 0)
+	return err
+}
+
+// headerBytes returns the header as it would be written now.
+func (cw *CDFWriter) headerBytes() []byte {
+	var buf bytes.Buffer
+	bf := cw.bf
+	defer func() { cw.bf = bf }()
+	cw.bf = &countedWriter{bufio.NewWriter(&buf), 0}
+	cw.writeHeader()
+	thrower.ThrowIfError(cw.bf.Flush())
+	return buf.Bytes()
+}
+
+// dataStart returns the offset of the first data after the header.
+func (cw *CDFWriter) dataStart() int64 {
+	start := int64(math.MaxInt64)
+	for i := range cw.vars {
+		if cw.vars[i].begin < start {
+			start = cw.vars[i].begin
+		}
+	}
+	return start
+}
@@ -0,0 +1,272 @@
+package cdf
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/batchatco/go-native-netcdf/netcdf/api"
+	"github.com/batchatco/go-native-netcdf/netcdf/util"
+)
+
+// writeAppendFile writes a file with two records, for appending to.
+func writeAppendFile(t *testing.T, fileName string) {
+	t.Helper()
+	cw, err := OpenWriter(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeCW(t, &cw)
+	units, err := util.NewOrderedMap([]string{"units"}, map[string]interface{}{"units": "K"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cw.SetAttribute("", "title", "append test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cw.DefineDim("time", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []struct {
+		name string
+		vr   api.Variable
+	}{
+		{"lat", api.Variable{Values: []float32{-10, 0, 10}, Dimensions: []string{"lat"}}},
+		{"temp", api.Variable{Values: [][]float32{}, Dimensions: []string{"time", "lat"},
+			Attributes: units}},
+		{"count", api.Variable{Values: []int16{}, Dimensions: []string{"time"}}},
+		{"grid", api.Variable{Values: [][]int32{{1, 2, 3}, {4, 5, 6}},
+			Dimensions: []string{"y", "lat"}}},
+	} {
+		err = cw.AddVar(v.name, v.vr)
+		if err != nil {
+			t.Fatal(v.name, err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		f := float32(i)
+		err = cw.AppendRecord(map[string]interface{}{
+			"temp":  []float32{f, f + 0.5, f + 0.25},
+			"count": int16(i),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestOpenAppend(t *testing.T) {
+	fileName := "testdata/testappend.nc"
+	_ = os.Remove(fileName)
+	defer os.Remove(fileName)
+	writeAppendFile(t, fileName)
+
+	cw, err := OpenAppend(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeCW(t, &cw)
+	for i := 2; i < 4; i++ {
+		f := float32(i)
+		err = cw.AppendRecord(map[string]interface{}{
+			"temp":  []float32{f, f + 0.5, f + 0.25},
+			"count": int16(i),
+		})
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	err = cw.WriteSlab("grid", []int64{0, 1}, []int64{2, 2}, []int32{20, 30, 50, 60})
+	if err != nil {
+		t.Error(err)
+	}
+	err = cw.WriteSlab("lat", nil, nil, []float32{-20, 0, 20})
+	if err != nil {
+		t.Error(err)
+	}
+	// Strings are padded to four bytes, so this fits.
+	err = cw.SetAttribute("temp", "units", "Cel")
+	if err != nil {
+		t.Error(err)
+	}
+	err = cw.SetAttribute("", "title", "a title that is longer than the old one")
+	if err != ErrHeaderFull {
+		t.Error("expected header full, got", err)
+	}
+	err = cw.SetAttribute("", "title", "new title")
+	if err != nil {
+		t.Error(err)
+	}
+	// The file is CDF-2, which has no unsigned types.
+	err = cw.SetAttribute("", "flag", uint8(1))
+	if err != ErrFormat {
+		t.Error("expected format error, got", err)
+	}
+	for _, test := range []struct {
+		name   string
+		values interface{}
+		err    error
+	}{
+		{"temp", []float32{1, 2, 3}, ErrRecordVariable},
+		{"nothing", []float32{1, 2, 3}, ErrNotFound},
+	} {
+		err = cw.WriteSlab(test.name, nil, nil, test.values)
+		if err != test.err {
+			t.Error(test.name, "got", err, "exp", test.err)
+		}
+	}
+	for _, values := range []interface{}{[]float64{1, 2, 3}, []float32{1, 2}} {
+		err = cw.WriteSlab("lat", nil, nil, values)
+		if err == nil {
+			t.Error("expected error for", values)
+		}
+	}
+	err = cw.AddVar("late", api.Variable{Values: int32(1)})
+	if err != ErrDataWritten {
+		t.Error("expected data written, got", err)
+	}
+	closeCW(t, &cw)
+
+	nc, err := Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	for _, exp := range []struct {
+		name string
+		val  interface{}
+	}{
+		{"lat", []float32{-20, 0, 20}},
+		{"temp", [][]float32{{0, 0.5, 0.25}, {1, 1.5, 1.25}, {2, 2.5, 2.25}, {3, 3.5, 3.25}}},
+		{"count", []int16{0, 1, 2, 3}},
+		{"grid", [][]int32{{1, 20, 30}, {4, 50, 60}}},
+	} {
+		vr, err := nc.GetVariable(exp.name)
+		if err != nil {
+			t.Error(exp.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(vr.Values, exp.val) {
+			t.Error(exp.name, "got", vr.Values, "exp", exp.val)
+		}
+	}
+	vr, err := nc.GetVariable("temp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if units, _ := vr.Attributes.Get("units"); units != "Cel" {
+		t.Error("got units", units)
+	}
+	if title, _ := nc.Attributes().Get("title"); title != "new title" {
+		t.Error("got title", title)
+	}
+	if !reflect.DeepEqual(nc.Attributes().Keys(), []string{"title"}) {
+		t.Error("got global attributes", nc.Attributes().Keys())
+	}
+	if _, has := nc.Attributes().Get(ncpKey); !has {
+		t.Error(ncpKey, "missing")
+	}
+}
+
+// Before the header is written, WriteSlab writes over the values of variables
+// added with AddVar.
+func TestWriteSlabNotWritten(t *testing.T) {
+	fileName := "testdata/testnotwritten.nc"
+	cw, err := OpenWriter(fileName)
+	defer os.Remove(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeCW(t, &cw) // can be called twice
+	err = cw.AddVar("x", api.Variable{Values: []int32{1, 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cw.WriteSlab("x", nil, nil, []int32{3, 4})
+	if err != nil {
+		t.Error(err)
+	}
+	closeCW(t, &cw)
+	nc, err := Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	vr, err := nc.GetVariable("x")
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(vr.Values, []int32{3, 4}) {
+		t.Error("got", vr.Values)
+	}
+}
+
+func TestOpenAppendErrors(t *testing.T) {
+	_, err := OpenAppend("testdata/nothing.nc")
+	if err == nil {
+		t.Error("expected error for missing file")
+	}
+	fileName := "testdata/notcdf.nc"
+	err = os.WriteFile(fileName, []byte("not a CDF file"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fileName)
+	_, err = OpenAppend(fileName)
+	if err != ErrNotCDF {
+		t.Error("expected not CDF, got", err)
+	}
+}
+
+func TestOpenAppendOneVar(t *testing.T) {
+	// Records of a single record variable aren't padded.
+	fileName := "testdata/testappendone.nc"
+	_ = os.Remove(fileName)
+	defer os.Remove(fileName)
+	cw, err := OpenWriter(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeCW(t, &cw)
+	err = cw.DefineDim("time", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cw.DefineDim("three", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cw.AddVar("x", api.Variable{Values: [][]uint8{}, Dimensions: []string{"time", "three"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := [][]uint8{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}}
+	for i, rec := range exp {
+		if i > 0 {
+			closeCW(t, &cw)
+			cw, err = OpenAppend(fileName)
+			if err != nil {
+				t.Fatal(i, err)
+			}
+		}
+		err = cw.AppendRecord(map[string]interface{}{"x": rec})
+		if err != nil {
+			t.Error(i, err)
+		}
+	}
+	closeCW(t, &cw)
+
+	nc, err := Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	vr, err := nc.GetVariable("x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(vr.Values, exp) {
+		t.Error("got", vr.Values, "exp", exp)
+	}
+}
@@ -668,27 +668,9 @@ func (cdf *CDF) getVarCommon(name string) (api.VarGetter, error) {
 		default:
 			nChunks = int64(end - begin)
 		}
-		sliceSize := int64(1)
-		var start int64
-		var sizeInBytes int64
-
-		sliceSize = nChunks * chunkSize
-		start = begin * chunkSize
-		switch varFound.vType {
-		case typeDouble, typeInt64, typeUInt64:
-			start *= 8
-			sizeInBytes = sliceSize * 8
-		case typeInt, typeFloat, typeUInt:
-			start *= 4
-			sizeInBytes = sliceSize * 4
-		case typeShort, typeUShort:
-			start *= 2
-			sizeInBytes = sliceSize * 2
-		case typeChar, typeByte, typeUByte:
-			sizeInBytes = sliceSize
-		default:
-			thrower.Throw(ErrInternal)
-		}
+		sliceSize := nChunks * chunkSize
+		start := begin * chunkSize * typeSize(varFound.vType)
+		sizeInBytes := sliceSize * typeSize(varFound.vType)
 
 		var bf io.Reader
 		if unlimited && !cdf.specialCase {
@@ -700,44 +682,7 @@ func (cdf *CDF) getVarCommon(name string) (api.VarGetter, error) {
 		}
 
 		// in case of unlimited, should read a record at a time, using cdf.recSize
-		var data interface{}
-		switch varFound.vType {
-		case typeByte:
-			data = make([]int8, sliceSize)
-
-		case typeChar:
-			data = make([]byte, sliceSize)
-
-		case typeShort:
-			data = make([]int16, sliceSize)
-
-		case typeInt:
-			data = make([]int32, sliceSize)
-
-		case typeFloat:
-			data = make([]float32, sliceSize)
-
-		case typeDouble:
-			data = make([]float64, sliceSize)
-
-		case typeUByte:
-			data = make([]uint8, sliceSize)
-
-		case typeUShort:
-			data = make([]uint16, sliceSize)
-
-		case typeUInt:
-			data = make([]uint32, sliceSize)
-
-		case typeUInt64:
-			data = make([]uint64, sliceSize)
-
-		case typeInt64:
-			data = make([]int64, sliceSize)
-
-		default:
-			fail("unknown type", ErrUnknownType)
-		}
+		data := makeData(varFound.vType, sliceSize)
 		err := binary.Read(bf, binary.BigEndian, data)
 		if err != nil {
 			return nil, err
@@ -753,10 +698,199 @@ func (cdf *CDF) getVarCommon(name string) (api.VarGetter, error) {
 		}
 		return converted, nil
 	}
-	return internal.NewSlicer(getSlice, length, dimNames, varFound.attrs,
+	elemSize := typeSize(varFound.vType)
+	var recordLength int64 // in elements, 0 if not a record variable
+	if unlimited && !cdf.specialCase {
+		recordLength = chunkSize
+	}
+	// readRuns calls f with a reader for each run of contiguous values in
+	// the hyperslab, in row-major order, and the number of values in it.
+	readRuns := func(start, count, stride []int64, f func(r io.Reader, n int64)) {
+		internal.HyperslabRuns(dimLengths, start, count, stride,
+			func(offset, length int64) {
+				// Record variables are interleaved with the other record
+				// variables, so runs must be split at record boundaries.
+				for length > 0 {
+					n := length
+					pos := offset * elemSize
+					if recordLength > 0 {
+						record := offset / recordLength
+						within := offset % recordLength
+						if within+n > recordLength {
+							n = recordLength - within
+						}
+						pos = record*int64(cdf.recSize) + within*elemSize
+					}
+					seekTo(cdf.file, int64(varFound.begin)+pos)
+					f(io.LimitReader(makeFillValueReader(varFound,
+						io.LimitReader(cdf.file, n*elemSize)), n*elemSize), n)
+					offset += n
+					length -= n
+				}
+			})
+	}
+	getHyperslab := func(start, count, stride []int64) (interface{}, error) {
+		stride, ok := internal.CheckHyperslab(dimLengths, start, count, stride)
+		if !ok {
+			return nil, errors.New("invalid hyperslab parameters")
+		}
+		var buf bytes.Buffer
+		readRuns(start, count, stride, func(r io.Reader, n int64) {
+			_, err := io.Copy(&buf, r)
+			thrower.ThrowIfError(err)
+		})
+		sliceSize := int64(buf.Len()) / elemSize
+		data := makeData(varFound.vType, sliceSize)
+		err := binary.Read(&buf, binary.BigEndian, data)
+		if err != nil {
+			return nil, err
+		}
+		countLengths := make([]uint64, len(count))
+		for i := range count {
+			countLengths[i] = uint64(count[i])
+		}
+		converted := cdf.convert(data, countLengths, varFound.vType)
+		if converted == nil {
+			thrower.Throw(ErrInternal)
+		}
+		return converted, nil
+	}
+	readInto := func(dst interface{}, start, count []int64) error {
+		start, count, stride, err := internal.CheckReadInto(dimLengths, dst, start, count)
+		if err != nil {
+			return err
+		}
+		want := reflect.TypeOf(makeData(varFound.vType, 0))
+		if reflect.TypeOf(dst) != want {
+			return fmt.Errorf("destination is %T, not %v", dst, want)
+		}
+		// The values are decoded straight into dst, one run at a time.
+		var buf []byte
+		pos := 0
+		readRuns(start, count, stride, func(r io.Reader, n int64) {
+			if int64(cap(buf)) < n*elemSize {
+				buf = make([]byte, n*elemSize)
+			}
+			b := buf[:n*elemSize]
+			_, err := io.ReadFull(r, b)
+			thrower.ThrowIfError(err)
+			decodeInto(dst, pos, b)
+			pos += int(n)
+		})
+		return nil
+	}
+	return internal.NewSlicer(getSlice, getHyperslab, readInto, length, dimNames, varFound.attrs,
 		cdlType(varFound.vType), goType(varFound.vType)), nil
 }
 
+// typeSize returns the size in bytes of one element of the given type.
+func typeSize(vType uint32) int64 {
+	switch vType {
+	case typeDouble, typeInt64, typeUInt64:
+		return 8
+	case typeInt, typeFloat, typeUInt:
+		return 4
+	case typeShort, typeUShort:
+		return 2
+	case typeChar, typeByte, typeUByte:
+		return 1
+	default:
+		thrower.Throw(ErrInternal)
+	}
+	panic("never gets here")
+}
+
+// decodeInto decodes the big-endian values in b into dst, starting at index
+// pos.  Dst is a slice of the type made by makeData.
+func decodeInto(dst interface{}, pos int, b []byte) {
+	be := binary.BigEndian
+	switch dst := dst.(type) {
+	case []int8:
+		for i := range b {
+			dst[pos+i] = int8(b[i])
+		}
+	case []uint8:
+		copy(dst[pos:], b)
+	case []int16:
+		for i := 0; i < len(b)/2; i++ {
+			dst[pos+i] = int16(be.Uint16(b[2*i:]))
+		}
+	case []uint16:
+		for i := 0; i < len(b)/2; i++ {
+			dst[pos+i] = be.Uint16(b[2*i:])
+		}
+	case []int32:
+		for i := 0; i < len(b)/4; i++ {
+			dst[pos+i] = int32(be.Uint32(b[4*i:]))
+		}
+	case []uint32:
+		for i := 0; i < len(b)/4; i++ {
+			dst[pos+i] = be.Uint32(b[4*i:])
+		}
+	case []float32:
+		for i := 0; i < len(b)/4; i++ {
+			dst[pos+i] = math.Float32frombits(be.Uint32(b[4*i:]))
+		}
+	case []int64:
+		for i := 0; i < len(b)/8; i++ {
+			dst[pos+i] = int64(be.Uint64(b[8*i:]))
+		}
+	case []uint64:
+		for i := 0; i < len(b)/8; i++ {
+			dst[pos+i] = be.Uint64(b[8*i:])
+		}
+	case []float64:
+		for i := 0; i < len(b)/8; i++ {
+			dst[pos+i] = math.Float64frombits(be.Uint64(b[8*i:]))
+		}
+	default:
+		thrower.Throw(ErrInternal)
+	}
+}
+
+// makeData allocates a slice of n elements of the Go type used to read the
+// given type.
+func makeData(vType uint32, n int64) interface{} {
+	switch vType {
+	case typeByte:
+		return make([]int8, n)
+
+	case typeChar:
+		return make([]byte, n)
+
+	case typeShort:
+		return make([]int16, n)
+
+	case typeInt:
+		return make([]int32, n)
+
+	case typeFloat:
+		return make([]float32, n)
+
+	case typeDouble:
+		return make([]float64, n)
+
+	case typeUByte:
+		return make([]uint8, n)
+
+	case typeUShort:
+		return make([]uint16, n)
+
+	case typeUInt:
+		return make([]uint32, n)
+
+	case typeUInt64:
+		return make([]uint64, n)
+
+	case typeInt64:
+		return make([]int64, n)
+
+	default:
+		fail("unknown type", ErrUnknownType)
+	}
+	panic("never gets here")
+}
+
 func goType(vType uint32) string {
 	switch vType {
 	case typeByte:
@@ -1,10 +1,9 @@
 package cdf
 
-// TODO: write unlimited dimension
 // TODO: too many dimensions error
-// TODO: api for dimensions in case of unlimited and zero length
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -26,14 +25,31 @@ type countedWriter struct {
 
 type savedVar struct {
 	name       string
-	val        interface{}
+	val        interface{} // nil if defined by DefineVar
 	ty         int
 	dimLengths []int64
 	dimNames   []string
 	attrs      api.AttributeMap
 	vsize      int64
+	begin      int64 // offset of the data
 }
 
+// Format is the format of a CDF file, which limits the types and sizes of the
+// data it can hold.
+type Format int8
+
+const (
+	// FormatAuto writes CDF-2, unless the data needs CDF-5.
+	FormatAuto Format = 0
+	// FormatClassic is CDF-1, in which the offsets of the data are 32 bits.
+	FormatClassic Format = 1
+	// Format64BitOffset is CDF-2, in which the offsets are 64 bits.
+	Format64BitOffset Format = 2
+	// Format64BitData is CDF-5, in which sizes are also 64 bits, and which has
+	// unsigned and 64-bit integer types.
+	Format64BitData Format = 5
+)
+
 type CDFWriter struct {
 	file        *os.File
 	bf          *countedWriter
@@ -44,7 +60,12 @@ type CDFWriter struct {
 	dimIds      map[string]int64
 	nextID      int64
 	version     int8
-	begin       int64
+	format      Format
+	needV5      bool // set when the data can only be written in CDF-5
+	// headerWritten is set when the header and the data of the variables
+	// that aren't record variables have been written, before the first record.
+	headerWritten bool
+	numRecs       int64
 }
 
 var (
@@ -53,6 +74,14 @@ var (
 	ErrInvalidName          = errors.New("invalid name")
 	ErrAttribute            = errors.New("invalid attribute")
 	ErrEmptySlice           = errors.New("empty slice encountered")
+	ErrInvalidTag           = errors.New("invalid netcdf tag")
+	ErrNonExportedField     = errors.New("can't marshal non-exported field")
+	ErrMultipleUnlimited    = errors.New("only one unlimited dimension allowed")
+	ErrDataWritten          = errors.New("can't define after data is written")
+	ErrRecord               = errors.New("record doesn't match the record variables")
+	ErrRecordVariable       = errors.New("can't overwrite a record variable")
+	ErrHeaderFull           = errors.New("header doesn't fit before the data")
+	ErrFormat               = errors.New("data doesn't fit the format")
 )
 
 func (c *countedWriter) Count() int64 {
@@ -274,7 +303,10 @@ func (cw *CDFWriter) getDimLengthsHelper(
 	kind := cw.scalarKind(t.Kind())
 	switch kind {
 	case typeNone:
-		break
+		if t.Kind() != reflect.Array && t.Kind() != reflect.Slice {
+			logger.Info("Unknown type", t.Kind())
+			thrower.Throw(ErrUnknownType)
+		}
 	case typeChar:
 		if rv.Len() == 1 && len(dimNames) == 0 {
 			return dims, kind
@@ -320,6 +352,46 @@ func (cw *CDFWriter) getDimLengthsHelper(
 	panic("internal error") // should never happen
 }
 
+// recordDimLengths returns the dimension lengths and type of a record
+// variable, which has an empty slice for its values and the unlimited
+// dimension first.  The lengths of the other dimensions can't be told from the
+// values, so they are the lengths they were defined with.  It returns nil if
+// the variable isn't a record variable.
+func (cw *CDFWriter) recordDimLengths(val interface{}, dimNames []string) ([]int64, int) {
+	v := reflect.ValueOf(val)
+	if len(dimNames) == 0 || v.Kind() != reflect.Slice || v.Len() != 0 {
+		return nil, typeNone
+	}
+	if length, has := cw.dimLengths[dimNames[0]]; !has || length != 0 {
+		return nil, typeNone
+	}
+	t := v.Type()
+	nDims := 0
+	for t.Kind() == reflect.Slice {
+		t = t.Elem()
+		nDims++
+	}
+	kind := cw.scalarKind(t.Kind())
+	switch kind {
+	case typeNone:
+		thrower.Throw(ErrUnknownType)
+	case typeChar:
+		nDims++ // the length of the strings
+	}
+	if len(dimNames) != nDims {
+		thrower.Throw(ErrDimensionSize)
+	}
+	dimLengths := []int64{0}
+	for _, name := range dimNames[1:] {
+		length, has := cw.dimLengths[name]
+		if !has || length == 0 {
+			thrower.Throw(ErrEmptySlice)
+		}
+		dimLengths = append(dimLengths, length)
+	}
+	return dimLengths, kind
+}
+
 func (cw *CDFWriter) getDimLengths(val interface{}, dimNames []string) ([]int64, int) {
 	v := reflect.ValueOf(val)
 	dims := make([]int64, 0)
@@ -349,23 +421,23 @@ func (cw *CDFWriter) scalarKind(goKind reflect.Kind) int {
 
 		// v5
 	case reflect.Uint8:
-		cw.version = 5
+		cw.useV5()
 		return typeUByte
 
 	case reflect.Uint16:
-		cw.version = 5
+		cw.useV5()
 		return typeUShort
 
 	case reflect.Uint32:
-		cw.version = 5
+		cw.useV5()
 		return typeUInt
 
 	case reflect.Uint64:
-		cw.version = 5
+		cw.useV5()
 		return typeUInt64
 
 	case reflect.Int64:
-		cw.version = 5
+		cw.useV5()
 		return typeInt64
 
 	}
@@ -387,19 +459,80 @@ func hasValidNames(am api.AttributeMap) bool {
 
 // AddGlobalAttrs adds global attributes to be written out.
 // Use util.NewOrderedMap to create attribute maps.
-func (cw *CDFWriter) AddGlobalAttrs(attrs api.AttributeMap) error {
+func (cw *CDFWriter) AddGlobalAttrs(attrs api.AttributeMap) (err error) {
+	state := cw.state()
+	defer func() {
+		if err != nil {
+			// Rejected attributes don't change the format.
+			cw.restore(state)
+		}
+	}()
+	defer thrower.RecoverError(&err)
+	if cw.headerWritten {
+		return ErrDataWritten
+	}
 	if !hasValidNames(attrs) {
 		return ErrInvalidName
 	}
+	cw.checkV5Attributes(attrs)
 	cw.globalAttrs = attrs
 	return nil
 }
 
+// DefineDim defines a dimension, so that it can be used by variables added
+// later.  A length of zero makes it the unlimited dimension, whose length is
+// the number of records appended by AppendRecord.
+func (cw *CDFWriter) DefineDim(name string, length int64) error {
+	if cw.headerWritten {
+		return ErrDataWritten
+	}
+	if !internal.IsValidNetCDFName(name) {
+		return ErrInvalidName
+	}
+	if current, has := cw.dimLengths[name]; has {
+		if current != length {
+			return ErrDimensionSize
+		}
+		return nil
+	}
+	switch {
+	case length < 0:
+		return ErrDimensionSize
+	case length == 0:
+		for _, current := range cw.dimLengths {
+			if current == 0 {
+				return ErrMultipleUnlimited
+			}
+		}
+	}
+	cw.dimLengths[name] = length
+	cw.dimIds[name] = cw.nextID
+	cw.dimNames = append(cw.dimNames, name)
+	cw.nextID++
+	return nil
+}
+
 // AddVar adds a variable to be written out.
 // Use util.NewOrderedMap to create attribute maps for the variable.
+//
+// A record variable, whose first dimension is the unlimited one defined by
+// DefineDim, is added with an empty slice of its type for its values, such as
+// [][]float32{} for dimensions time and lat.  Its other dimensions must have
+// been defined, by DefineDim or by other variables.  Its values are written by
+// AppendRecord.
 func (cw *CDFWriter) AddVar(name string, vr api.Variable) (err error) {
+	state := cw.state()
+	defer func() {
+		if err != nil {
+			// A rejected variable doesn't change the format or the dimensions.
+			cw.restore(state)
+		}
+	}()
 	defer thrower.RecoverError(&err)
 
+	if cw.headerWritten {
+		return ErrDataWritten
+	}
 	if !internal.IsValidNetCDFName(name) {
 		return ErrInvalidName
 	}
@@ -408,10 +541,13 @@ func (cw *CDFWriter) AddVar(name string, vr api.Variable) (err error) {
 	}
 	// TODO: check name for validity
 	cw.checkV5Attributes(vr.Attributes)
-	dimLengths, ty := cw.getDimLengths(vr.Values, vr.Dimensions)
+	dimLengths, ty := cw.recordDimLengths(vr.Values, vr.Dimensions)
+	if dimLengths == nil {
+		dimLengths, ty = cw.getDimLengths(vr.Values, vr.Dimensions)
+	}
 	switch ty {
 	case typeUByte, typeUShort, typeUInt, typeUInt64, typeInt64:
-		cw.version = 5
+		cw.useV5()
 	}
 	for i := 0; i < len(dimLengths); i++ {
 		var dimName string
@@ -441,10 +577,130 @@ func (cw *CDFWriter) AddVar(name string, vr api.Variable) (err error) {
 		}
 	}
 	cw.vars = append(cw.vars, savedVar{name, vr.Values, ty, dimLengths,
-		vr.Dimensions, vr.Attributes, 0})
+		vr.Dimensions, vr.Attributes, 0, 0})
+	return nil
+}
+
+// writerState is what is needed to undo the variables, dimensions and
+// attributes added to a CDFWriter.
+type writerState struct {
+	numVars     int
+	numDims     int
+	nextID      int64
+	globalAttrs api.AttributeMap
+	needV5      bool
+	version     int8
+}
+
+func (cw *CDFWriter) state() writerState {
+	return writerState{len(cw.vars), len(cw.dimNames), cw.nextID, cw.globalAttrs,
+		cw.needV5, cw.version}
+}
+
+// restore undoes everything added since the state was taken.
+func (cw *CDFWriter) restore(state writerState) {
+	for _, name := range cw.dimNames[state.numDims:] {
+		delete(cw.dimLengths, name)
+		delete(cw.dimIds, name)
+	}
+	cw.dimNames = cw.dimNames[:state.numDims]
+	cw.vars = cw.vars[:state.numVars]
+	cw.nextID = state.nextID
+	cw.globalAttrs = state.globalAttrs
+	cw.needV5 = state.needV5
+	cw.version = state.version
+}
+
+// DefineVar defines a variable without its values, so that they can be
+// written in pieces by WriteSlab, or by AppendRecord if it is a record
+// variable.  The type is the CDL name of the type, such as "float" or
+// "short".  The dimensions, slowest varying first, must have been defined by
+// DefineDim or by other variables.  Values that haven't been written are the
+// fill value: the _FillValue attribute, which must have the type of the
+// variable, or else the default one.
+func (cw *CDFWriter) DefineVar(name string, cdl string, dims []string,
+	attrs api.AttributeMap) (err error) {
+	state := cw.state()
+	defer func() {
+		if err != nil {
+			// A rejected variable doesn't change the format or the dimensions.
+			cw.restore(state)
+		}
+	}()
+	defer thrower.RecoverError(&err)
+
+	if cw.headerWritten {
+		return ErrDataWritten
+	}
+	if !internal.IsValidNetCDFName(name) || !hasValidNames(attrs) {
+		return ErrInvalidName
+	}
+	if cw.findVar(name) != nil {
+		return ErrDuplicateVariable
+	}
+	ty := typeFromCDL(cdl)
+	if ty == typeNone {
+		return ErrUnknownType
+	}
+	dimLengths := make([]int64, len(dims))
+	for i, dimName := range dims {
+		length, has := cw.dimLengths[dimName]
+		switch {
+		case !has:
+			return ErrNotFound
+		case length == 0 && i != 0:
+			return ErrUnlimitedMustBeFirst
+		}
+		dimLengths[i] = length
+	}
+	if !fillValueFits(ty, attrs) {
+		return ErrFillValue
+	}
+	cw.checkV5Attributes(attrs)
+	switch ty {
+	case typeUByte, typeUShort, typeUInt, typeUInt64, typeInt64:
+		cw.useV5()
+	}
+	saved := savedVar{name, nil, ty, dimLengths,
+		append([]string{}, dims...), attrs, 0, 0}
+	if saved.isRecord() {
+		// AppendRecord checks records against the type of the values.
+		saved.val = emptyValues(uint32(ty), len(dims))
+	}
+	cw.vars = append(cw.vars, saved)
 	return nil
 }
 
+// typeFromCDL returns the type with the given CDL name, or typeNone.
+func typeFromCDL(cdl string) int {
+	for ty := typeByte; ty <= typeUInt64; ty++ {
+		if cdlType(uint32(ty)) == cdl {
+			return ty
+		}
+	}
+	return typeNone
+}
+
+// fillValueFits returns true if there is no _FillValue attribute, or if it is
+// a single value of the given type.
+func fillValueFits(ty int, attrs api.AttributeMap) bool {
+	if attrs == nil {
+		return true
+	}
+	fv, has := attrs.Get("_FillValue")
+	if !has {
+		return true
+	}
+	val := reflect.ValueOf(fv)
+	if val.Kind() == reflect.Slice {
+		if val.Len() != 1 {
+			return false
+		}
+		val = val.Index(0)
+	}
+	return val.Type() == reflect.TypeOf(makeData(uint32(ty), 0)).Elem()
+}
+
 func (cw *CDFWriter) writeAttributes(attrs api.AttributeMap) {
 	if attrs == nil || len(attrs.Keys()) == 0 {
 		write32(cw.bf, 0)        //  attributes: absent
@@ -579,6 +835,59 @@ func (cw *CDFWriter) writeAttributes(attrs api.AttributeMap) {
 	}
 }
 
+// useV5 switches to CDF-5 for data that needs it, or throws ErrFormat if
+// another format has been chosen.
+func (cw *CDFWriter) useV5() {
+	if cw.format != FormatAuto && cw.format != Format64BitData {
+		thrower.Throw(ErrFormat)
+	}
+	cw.needV5 = true
+	cw.version = 5
+}
+
+// SetFormat sets the format of the file.  The default, FormatAuto, writes
+// CDF-2 unless unsigned or 64-bit integer types, or variables of 4 GiB or
+// more, need CDF-5.  With any other format, ErrFormat is returned when the
+// data doesn't fit it, either now or when it is written out.
+func (cw *CDFWriter) SetFormat(format Format) error {
+	if cw.headerWritten {
+		return ErrDataWritten
+	}
+	switch format {
+	case FormatAuto:
+		cw.version = 2
+		if cw.needV5 {
+			cw.version = 5
+		}
+	case FormatClassic, Format64BitOffset:
+		if cw.needV5 {
+			return ErrFormat
+		}
+		cw.version = int8(format)
+	case Format64BitData:
+		cw.version = int8(format)
+	default:
+		return ErrFormat
+	}
+	cw.format = format
+	return nil
+}
+
+// checkSizes checks that the dimensions and variables fit in 32 bits, and
+// switches to CDF-5 if they don't.
+func (cw *CDFWriter) checkSizes() {
+	for _, length := range cw.dimLengths {
+		if length > math.MaxInt32 {
+			cw.useV5()
+		}
+	}
+	for i := range cw.vars {
+		if cw.varSize(&cw.vars[i]) > math.MaxUint32 {
+			cw.useV5()
+		}
+	}
+}
+
 func (cw *CDFWriter) checkV5Attributes(attrs api.AttributeMap) {
 	if attrs == nil {
 		return
@@ -590,8 +899,7 @@ func (cw *CDFWriter) checkV5Attributes(attrs api.AttributeMap) {
 			[]int8, []int16, []int32, []float32, []float64:
 
 		case []uint64, uint64, []int64, int64, []uint8, uint8, []uint16, uint16, []uint32, uint32:
-			cw.version = 5
-			return
+			cw.useV5()
 
 		default:
 			logger.Errorf("invalid attribute %#v", v)
@@ -612,6 +920,40 @@ func (cw *CDFWriter) writeVar(which int) {
 	cw.writeAttributes(saved.attrs)
 
 	write32(cw.bf, int32(saved.ty))
+	cw.writeNumber(saved.vsize)
+	if cw.version == 1 {
+		write32(cw.bf, int32(saved.begin))
+	} else {
+		write64(cw.bf, saved.begin)
+	}
+}
+
+// layout sets the size of each variable and the offset of its data, which
+// starts at begin.  The data of record variables comes after the data of all
+// the others.
+func (cw *CDFWriter) layout(begin int64) {
+	for i := range cw.vars {
+		cw.vars[i].vsize = cw.varSize(&cw.vars[i])
+	}
+	for _, record := range []bool{false, true} {
+		for i := range cw.vars {
+			if cw.vars[i].isRecord() == record {
+				cw.vars[i].begin = begin
+				begin += cw.vars[i].vsize
+			}
+		}
+	}
+}
+
+// isRecord returns true if the first dimension of the variable is the
+// unlimited dimension.
+func (saved *savedVar) isRecord() bool {
+	return len(saved.dimLengths) > 0 && saved.dimLengths[0] == 0
+}
+
+// varSize returns the size of the variable, or of one record of it if it is
+// a record variable, padded to four bytes.
+func (cw *CDFWriter) varSize(saved *savedVar) int64 {
 	vsize := int64(0)
 	switch saved.ty {
 	case typeDouble, typeInt64, typeUInt64:
@@ -637,15 +979,7 @@ func (cw *CDFWriter) writeVar(which int) {
 		}
 	}
 	// pad vsize
-	vsize = 4 * ((vsize + 3) / 4)
-	cw.writeNumber(int64(vsize))
-	saved.vsize = vsize
-
-	calcOffset := cw.begin
-	for i := 0; i < which; i++ {
-		calcOffset += cw.vars[i].vsize
-	}
-	write64(cw.bf, calcOffset)
+	return 4 * ((vsize + 3) / 4)
 }
 
 func (cw *CDFWriter) computeAttributeSize(attrs api.AttributeMap) int64 {
@@ -782,6 +1116,9 @@ func (cw *CDFWriter) computeVarSize(saved *savedVar) int64 {
 	addLength()
 	// offset
 	count += 8
+	if cw.version == 1 {
+		count -= 4
+	}
 	return count
 }
 
@@ -799,48 +1136,186 @@ func (cw *CDFWriter) pad() {
 }
 
 func (cw *CDFWriter) writeData(saved savedVar) {
-	switch saved.ty {
+	if saved.val == nil {
+		cw.writeFill(saved)
+	} else {
+		cw.store(saved.ty, reflect.ValueOf(saved.val), saved.dimLengths)
+	}
+	cw.pad()
+}
+
+// writeFill writes the fill value for each of the values of a variable
+// defined by DefineVar.
+func (cw *CDFWriter) writeFill(saved savedVar) {
+	size := typeSize(uint32(saved.ty))
+	for _, length := range saved.dimLengths {
+		size *= length
+	}
+	var keys []string
+	values := make(map[string]interface{})
+	if saved.attrs != nil {
+		if fv, has := saved.attrs.Get("_FillValue"); has {
+			keys = append(keys, "_FillValue")
+			values["_FillValue"] = fv
+		}
+	}
+	attrs, err := util.NewOrderedMap(keys, values)
+	thrower.ThrowIfError(err)
+	v := variable{vType: uint32(saved.ty), attrs: attrs}
+	_, err = io.CopyN(cw.bf, makeFillValueReader(v, bytes.NewReader(nil)), size)
+	thrower.ThrowIfError(err)
+}
+
+func (cw *CDFWriter) store(ty int, val reflect.Value, dimLengths []int64) {
+	switch ty {
 	case typeByte:
-		cw.storeBytes(reflect.ValueOf(saved.val), saved.dimLengths)
-		cw.pad()
+		cw.storeBytes(val, dimLengths)
 	case typeChar: // char in CDF is string/byte in Go
-		cw.storeChars(reflect.ValueOf(saved.val), saved.dimLengths)
-		cw.pad()
+		cw.storeChars(val, dimLengths)
 	case typeShort:
-		cw.storeShorts(reflect.ValueOf(saved.val), saved.dimLengths)
-		cw.pad()
+		cw.storeShorts(val, dimLengths)
 	case typeInt:
-		cw.storeInts(reflect.ValueOf(saved.val), saved.dimLengths)
+		cw.storeInts(val, dimLengths)
 	case typeFloat:
-		cw.storeFloats(reflect.ValueOf(saved.val), saved.dimLengths)
+		cw.storeFloats(val, dimLengths)
 	case typeDouble:
-		cw.storeDoubles(reflect.ValueOf(saved.val), saved.dimLengths)
+		cw.storeDoubles(val, dimLengths)
 	case typeInt64:
-		cw.storeInt64s(reflect.ValueOf(saved.val), saved.dimLengths)
+		cw.storeInt64s(val, dimLengths)
 	case typeUInt64:
-		cw.storeUInt64s(reflect.ValueOf(saved.val), saved.dimLengths)
+		cw.storeUInt64s(val, dimLengths)
 	case typeUInt:
-		cw.storeUInts(reflect.ValueOf(saved.val), saved.dimLengths)
+		cw.storeUInts(val, dimLengths)
 	case typeUShort:
-		cw.storeUShorts(reflect.ValueOf(saved.val), saved.dimLengths)
-		cw.pad()
+		cw.storeUShorts(val, dimLengths)
 	case typeUByte:
-		cw.storeUBytes(reflect.ValueOf(saved.val), saved.dimLengths)
-		cw.pad()
+		cw.storeUBytes(val, dimLengths)
 	default:
 		thrower.Throw(ErrInternal)
 	}
 }
 
-// Close writes all the data out and closes the file.
-func (cw *CDFWriter) Close() (err error) {
+// AppendRecord writes one record of each record variable.  The record maps
+// the name of each record variable to its values for the record, which are
+// its values without the unlimited dimension, such as []float32 for a
+// [][]float32 variable.  Strings are padded to the length of their dimension.
+//
+// The header and the data of the other variables are written before the
+// first record, so no more dimensions, variables or global attributes can be
+// added after it.  The number of records is filled in by Close.
+func (cw *CDFWriter) AppendRecord(record map[string]interface{}) (err error) {
+	defer thrower.RecoverError(&err)
+	var recordVars []*savedVar
+	for i := range cw.vars {
+		if cw.vars[i].isRecord() {
+			recordVars = append(recordVars, &cw.vars[i])
+		}
+	}
+	if len(recordVars) == 0 || len(record) != len(recordVars) {
+		return ErrRecord
+	}
+	// Check everything first, so that a bad record isn't partly written.
+	for _, saved := range recordVars {
+		val, has := record[saved.name]
+		if !has || reflect.TypeOf(val) != reflect.TypeOf(saved.val).Elem() ||
+			!recordFits(reflect.ValueOf(val), saved.dimLengths[1:]) {
+			return ErrRecord
+		}
+	}
+	if cw.version < 5 && cw.numRecs == math.MaxInt32 {
+		return ErrFormat
+	}
+	if !cw.headerWritten {
+		cw.startData()
+	}
+	for _, saved := range recordVars {
+		cw.store(saved.ty, reflect.ValueOf(record[saved.name]), saved.dimLengths[1:])
+		// Records aren't padded when there is only one record variable.
+		if len(recordVars) > 1 {
+			cw.pad()
+		}
+	}
+	cw.numRecs++
+	return nil
+}
+
+// WriteSlab writes the values of a variable with the given start and count in
+// each dimension, over any written before.  The values are a flat slice of the
+// variable's type, in row-major order, as ReadInto reads them.  Characters
+// are bytes.  Record variables are written by AppendRecord instead.
+//
+// Like AppendRecord, the first call writes the header and the data of the
+// variables that aren't record variables, so nothing more can be defined
+// after it.
+func (cw *CDFWriter) WriteSlab(name string, start, count []int64,
+	values interface{}) (err error) {
 	defer thrower.RecoverError(&err)
-	cw.writeAll()
-	err = cw.bf.Flush()
+	saved := cw.findVar(name)
+	switch {
+	case saved == nil:
+		return ErrNotFound
+	case saved.isRecord():
+		return ErrRecordVariable
+	}
+	dimLengths := make([]uint64, len(saved.dimLengths))
+	for i, length := range saved.dimLengths {
+		dimLengths[i] = uint64(length)
+	}
+	start, count, stride, err := internal.CheckReadInto(dimLengths, values, start, count)
+	if err != nil {
+		return err
+	}
+	want := reflect.TypeOf(makeData(uint32(saved.ty), 0))
+	if reflect.TypeOf(values) != want {
+		return fmt.Errorf("values are %T, not %v", values, want)
+	}
+	if !cw.headerWritten {
+		cw.startData()
+	}
+	// The data may still be buffered.
+	thrower.ThrowIfError(cw.bf.Flush())
+	elemSize := typeSize(uint32(saved.ty))
+	v := reflect.ValueOf(values)
+	pos := 0
+	internal.HyperslabRuns(dimLengths, start, count, stride,
+		func(offset, length int64) {
+			var buf bytes.Buffer
+			writeAny(&buf, v.Slice(pos, pos+int(length)).Interface())
+			_, err := cw.file.WriteAt(buf.Bytes(), saved.begin+offset*elemSize)
+			thrower.ThrowIfError(err)
+			pos += int(length)
+		})
+	return nil
+}
+
+// recordFits returns true if the lengths of the values match the dimension
+// lengths.  Strings can be shorter than their dimension.
+func recordFits(val reflect.Value, dimLengths []int64) bool {
+	if len(dimLengths) == 0 {
+		// a single character
+		return val.Kind() != reflect.String || val.Len() == 1
+	}
+	if val.Kind() == reflect.String {
+		return len(dimLengths) == 1 && int64(val.Len()) <= dimLengths[0]
+	}
+	if int64(val.Len()) != dimLengths[0] {
+		return false
+	}
+	for i := 0; i < val.Len(); i++ {
+		if !recordFits(val.Index(i), dimLengths[1:]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Close writes all the data out and closes the file.
+func (cw *CDFWriter) Close() error {
+	err := cw.flush()
 	err2 := cw.file.Close()
 	if err == nil {
 		err = err2
-	} else {
+	} else if err2 != nil {
 		// return the first error, log the second
 		logger.Error(err2)
 	}
@@ -848,6 +1323,33 @@ func (cw *CDFWriter) Close() (err error) {
 	return err
 }
 
+// flush writes out everything not written yet, so that the file is still
+// closed if the data doesn't fit the format.
+func (cw *CDFWriter) flush() (err error) {
+	defer thrower.RecoverError(&err)
+	if !cw.headerWritten {
+		cw.startData()
+	}
+	thrower.ThrowIfError(cw.bf.Flush())
+	return cw.writeNumRecs()
+}
+
+// writeNumRecs fills in the number of records, which isn't known when the
+// header is written.
+func (cw *CDFWriter) writeNumRecs() error {
+	if cw.numRecs == 0 {
+		return nil
+	}
+	_, err := cw.file.Seek(4, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	if cw.version < 5 {
+		return binary.Write(cw.file, binary.BigEndian, int32(cw.numRecs))
+	}
+	return binary.Write(cw.file, binary.BigEndian, cw.numRecs)
+}
+
 func writeAny(w io.Writer, any interface{}) {
 	err := binary.Write(w, binary.BigEndian, any)
 	thrower.ThrowIfError(err)
@@ -895,11 +1397,30 @@ func (cw *CDFWriter) writeNumber(n int64) {
 	}
 }
 
-func (cw *CDFWriter) writeAll() {
+// startData writes the header and the data of the variables that aren't
+// record variables.
+func (cw *CDFWriter) startData() {
+	cw.checkSizes()
+	cw.writeHeader()
+	cw.headerWritten = true
+	// The header can't change size now.
+	cw.format = Format(cw.version)
+	for i := range cw.vars {
+		if !cw.vars[i].isRecord() {
+			cw.writeData(cw.vars[i])
+		}
+	}
+}
+
+// writeHeader writes the header.  The first time, it works out where the data
+// of the variables goes.  After that, the header can be written again with
+// the same layout.
+func (cw *CDFWriter) writeHeader() {
+	// The version can change, so this must be checked before writing it.
+	cw.checkV5Attributes(cw.globalAttrs)
 	writeBytes(cw.bf, []byte("CDF"))
-	write8(cw.bf, cw.version) // version 2 to handle big files
-	numRecs := int64(0)       // 0: not unlimited
-	cw.writeNumber(numRecs)
+	write8(cw.bf, cw.version)
+	cw.writeNumber(cw.numRecs)
 	if len(cw.dimLengths) > 0 {
 		write32(cw.bf, fieldDimension)
 		cw.writeNumber(int64(len(cw.dimLengths)))
@@ -912,25 +1433,30 @@ func (cw *CDFWriter) writeAll() {
 		write32(cw.bf, 0)        // dimensions: absent
 		cw.writeNumber(int64(0)) // dimensions: absent
 	}
-	cw.checkV5Attributes(cw.globalAttrs)
 	cw.writeAttributes(cw.globalAttrs)
 	if len(cw.vars) > 0 {
 		write32(cw.bf, fieldVariable)
 		cw.writeNumber(int64(len(cw.vars)))
 
-		// Calculate the beginning of where the data is going to be stored.
-		// The var entries will need that to calculate their offset.
-		cw.begin = cw.bf.Count()
-		for i := range cw.vars {
-			cw.begin += cw.computeVarSize(&cw.vars[i])
+		if !cw.headerWritten {
+			// Calculate the beginning of where the data is going to be stored.
+			// The var entries will need that to calculate their offset.
+			begin := cw.bf.Count()
+			for i := range cw.vars {
+				begin += cw.computeVarSize(&cw.vars[i])
+			}
+			cw.layout(begin)
+			if cw.version == 1 {
+				for i := range cw.vars {
+					if cw.vars[i].begin > math.MaxInt32 {
+						thrower.Throw(ErrFormat)
+					}
+				}
+			}
 		}
-
 		for i := range cw.vars {
 			cw.writeVar(i)
 		}
-		for i := range cw.vars {
-			cw.writeData(cw.vars[i])
-		}
 	} else {
 		write32(cw.bf, 0)        // variables: absent
 		cw.writeNumber(int64(0)) // variables: absent
@@ -939,7 +1465,8 @@ func (cw *CDFWriter) writeAll() {
 
 // OpenWriter creates the file and make it available for writing
 // using AddVar and AddGlobalAttrs.  The file must be closed to actually
-// write it out.
+// write it out.  It is written in CDF-2 format, or CDF-5 if needed, unless
+// another format is set with SetFormat.
 func OpenWriter(fileName string) (*CDFWriter, error) {
 	file, err := os.Create(fileName)
 	if err != nil {
@@ -961,6 +1488,7 @@ func OpenWriter(fileName string) (*CDFWriter, error) {
 		dimIds:      make(map[string]int64),
 		dimNames:    nil,
 		nextID:      0,
-		version:     2}
+		version:     2,
+		format:      FormatAuto}
 	return cw, nil
 }
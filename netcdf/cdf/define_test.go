@@ -0,0 +1,181 @@
+package cdf
+
+import (
+	"math"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/batchatco/go-native-netcdf/netcdf/api"
+	"github.com/batchatco/go-native-netcdf/netcdf/util"
+)
+
+func TestDefineVar(t *testing.T) {
+	fileName := "testdata/testdefine.nc"
+	_ = os.Remove(fileName)
+	cw, err := OpenWriter(fileName)
+	defer os.Remove(fileName)
+	defer closeCW(t, &cw) // can be called twice
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// The dimensions are in the order they are defined, not used.
+	for _, dim := range []struct {
+		name   string
+		length int64
+	}{{"time", 0}, {"y", 2}, {"x", 3}} {
+		err = cw.DefineDim(dim.name, dim.length)
+		if err != nil {
+			t.Error(dim.name, err)
+			return
+		}
+	}
+	fill, err := util.NewOrderedMap([]string{"_FillValue"},
+		map[string]interface{}{"_FillValue": int16(-1)})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, v := range []struct {
+		name  string
+		cdl   string
+		dims  []string
+		attrs api.AttributeMap
+	}{
+		{"grid", "float", []string{"y", "x"}, nil},
+		{"filled", "short", []string{"x"}, fill},
+		{"rec", "int", []string{"time", "y"}, nil},
+		{"big", "uint64", []string{"y"}, nil},
+	} {
+		err = cw.DefineVar(v.name, v.cdl, v.dims, v.attrs)
+		if err != nil {
+			t.Error(v.name, err)
+			return
+		}
+	}
+	err = cw.AddVar("lat", api.Variable{Values: []float64{1, 2, 3}, Dimensions: []string{"x"}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, slab := range []struct {
+		name   string
+		start  []int64
+		count  []int64
+		values interface{}
+	}{
+		{"grid", []int64{0, 0}, []int64{1, 3}, []float32{1, 2, 3}},
+		{"grid", []int64{1, 1}, []int64{1, 2}, []float32{5, 6}},
+		{"big", nil, nil, []uint64{math.MaxUint64, 7}},
+		{"lat", []int64{2}, []int64{1}, []float64{30}},
+	} {
+		err = cw.WriteSlab(slab.name, slab.start, slab.count, slab.values)
+		if err != nil {
+			t.Error(slab.name, err)
+			return
+		}
+	}
+	if err := cw.DefineVar("late", "int", nil, nil); err != ErrDataWritten {
+		t.Error("DefineVar after WriteSlab got", err)
+	}
+	for i := int32(0); i < 2; i++ {
+		err = cw.AppendRecord(map[string]interface{}{"rec": []int32{i, -i}})
+		if err != nil {
+			t.Error(i, err)
+			return
+		}
+	}
+	closeCW(t, &cw)
+
+	nc, err := Open(fileName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer nc.Close()
+	if version := nc.(*CDF).version; version != 5 {
+		t.Error("got version", version)
+	}
+	if dims := nc.ListDimensions(); !reflect.DeepEqual(dims, []string{"time", "y", "x"}) {
+		t.Error("got dimensions", dims)
+	}
+	defaultFill := math.Float32frombits(0x7cf00000)
+	for _, exp := range []struct {
+		name string
+		val  interface{}
+	}{
+		{"grid", [][]float32{{1, 2, 3}, {defaultFill, 5, 6}}},
+		{"filled", []int16{-1, -1, -1}},
+		{"rec", [][]int32{{0, 0}, {1, -1}}},
+		{"big", []uint64{math.MaxUint64, 7}},
+		{"lat", []float64{1, 2, 30}},
+	} {
+		vr, err := nc.GetVariable(exp.name)
+		if err != nil {
+			t.Error(exp.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(vr.Values, exp.val) {
+			t.Error(exp.name, "got", vr.Values, "exp", exp.val)
+		}
+	}
+}
+
+func TestDefineVarErrors(t *testing.T) {
+	fileName := "testdata/testdefineerrors.nc"
+	cw, err := OpenWriter(fileName)
+	defer os.Remove(fileName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer cw.Close()
+	if err := cw.DefineDim("time", 0); err != nil {
+		t.Error(err)
+	}
+	if err := cw.DefineDim("x", 2); err != nil {
+		t.Error(err)
+	}
+	if err := cw.DefineVar("rec", "int", []string{"time", "x"}, nil); err != nil {
+		t.Error(err)
+	}
+	badFill, err := util.NewOrderedMap([]string{"_FillValue"},
+		map[string]interface{}{"_FillValue": float64(1)})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, test := range []struct {
+		name  string
+		cdl   string
+		dims  []string
+		attrs api.AttributeMap
+		err   error
+	}{
+		{"v", "string", []string{"x"}, nil, ErrUnknownType},
+		{"v", "int", []string{"y"}, nil, ErrNotFound},
+		{"v", "int", []string{"x", "time"}, nil, ErrUnlimitedMustBeFirst},
+		{"rec", "int", []string{"x"}, nil, ErrDuplicateVariable},
+		{"bad/name", "int", []string{"x"}, nil, ErrInvalidName},
+		{"v", "float", []string{"x"}, badFill, ErrFillValue},
+	} {
+		err := cw.DefineVar(test.name, test.cdl, test.dims, test.attrs)
+		if err != test.err {
+			t.Error(test.name, test.dims, "got", err, "exp", test.err)
+		}
+	}
+	for _, test := range []struct {
+		name   string
+		values interface{}
+		err    error
+	}{
+		{"rec", []int32{1, 2}, ErrRecordVariable},
+		{"nothing", []int32{1, 2}, ErrNotFound},
+	} {
+		err = cw.WriteSlab(test.name, nil, nil, test.values)
+		if err != test.err {
+			t.Error(test.name, "got", err, "exp", test.err)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package cdf
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/batchatco/go-native-netcdf/netcdf/api"
+	"github.com/batchatco/go-native-netcdf/netcdf/util"
+)
+
+func TestSetFormat(t *testing.T) {
+	fileName := "testdata/testformat.nc"
+	defer os.Remove(fileName)
+	for _, test := range []struct {
+		format  Format
+		values  interface{}
+		version uint8
+	}{
+		{FormatClassic, []int32{1, 2}, 1},
+		{Format64BitOffset, []int32{1, 2}, 2},
+		{Format64BitData, []int32{1, 2}, 5},
+		{FormatAuto, []int32{1, 2}, 2},
+		{FormatAuto, []uint16{1, 2}, 5},
+		{FormatAuto, []int64{1, 2}, 5},
+	} {
+		_ = os.Remove(fileName)
+		cw, err := OpenWriter(fileName)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		err = cw.SetFormat(test.format)
+		if err != nil {
+			t.Error(test.format, err)
+		}
+		err = cw.AddVar("x", api.Variable{Values: test.values})
+		if err != nil {
+			t.Error(test.format, err)
+		}
+		closeCW(t, &cw)
+
+		nc, err := Open(fileName)
+		if err != nil {
+			t.Error(test.format, err)
+			continue
+		}
+		if version := nc.(*CDF).version; version != test.version {
+			t.Error(test.format, "got version", version, "exp", test.version)
+		}
+		vr, err := nc.GetVariable("x")
+		if err != nil {
+			t.Error(test.format, err)
+		} else if !reflect.DeepEqual(vr.Values, test.values) {
+			t.Error(test.format, "got", vr.Values, "exp", test.values)
+		}
+		nc.Close()
+	}
+}
+
+func TestSetFormatErrors(t *testing.T) {
+	fileName := "testdata/testformaterrors.nc"
+	cw, err := OpenWriter(fileName)
+	defer os.Remove(fileName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer cw.Close()
+	if err := cw.SetFormat(Format(3)); err != ErrFormat {
+		t.Error("unknown format got", err)
+	}
+	if err := cw.SetFormat(FormatClassic); err != nil {
+		t.Error(err)
+	}
+	attrs, err := util.NewOrderedMap([]string{"big"},
+		map[string]interface{}{"big": int64(1)})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err := cw.AddGlobalAttrs(attrs); err != ErrFormat {
+		t.Error("64-bit global attribute got", err)
+	}
+	if err := cw.AddVar("x", api.Variable{Values: int32(1), Attributes: attrs}); err != ErrFormat {
+		t.Error("64-bit attribute got", err)
+	}
+	if err := cw.AddVar("x", api.Variable{Values: []uint8{1}}); err != ErrFormat {
+		t.Error("unsigned variable got", err)
+	}
+	if err := cw.DefineVar("x", "uint64", nil, nil); err != ErrFormat {
+		t.Error("unsigned defined variable got", err)
+	}
+	if err := cw.SetFormat(FormatAuto); err != nil {
+		t.Error(err)
+	}
+	if err := cw.AddVar("x", api.Variable{Values: []uint8{1}}); err != nil {
+		t.Error(err)
+	}
+	for _, format := range []Format{FormatClassic, Format64BitOffset} {
+		if err := cw.SetFormat(format); err != ErrFormat {
+			t.Error(format, "after unsigned variable got", err)
+		}
+	}
+	if err := cw.SetFormat(Format64BitData); err != nil {
+		t.Error(err)
+	}
+	if err := cw.WriteSlab("x", nil, nil, []uint8{2}); err != nil {
+		t.Error(err)
+	}
+	if err := cw.SetFormat(FormatAuto); err != ErrDataWritten {
+		t.Error("after writing got", err)
+	}
+}
+
+func TestFormatTooBig(t *testing.T) {
+	fileName := "testdata/testformatbig.nc"
+	defer os.Remove(fileName)
+	for _, test := range []struct {
+		format Format
+		dims   []int64 // lengths of byte variables, one per variable
+	}{
+		// Each variable fits, but the second one begins after 2 GiB.
+		{FormatClassic, []int64{3 << 30, 1}},
+		// The variable doesn't fit in 4 GiB.
+		{Format64BitOffset, []int64{5 << 30}},
+	} {
+		cw, err := OpenWriter(fileName)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if err := cw.SetFormat(test.format); err != nil {
+			t.Error(err)
+		}
+		for i, length := range test.dims {
+			name := string(rune('a' + i))
+			if err := cw.DefineDim(name, length); err != nil {
+				t.Error(err)
+			}
+			if err := cw.DefineVar(name, "byte", []string{name}, nil); err != nil {
+				t.Error(err)
+			}
+		}
+		if err := cw.Close(); err != ErrFormat {
+			t.Error(test.format, "got", err)
+		}
+	}
+
+	// In auto mode, the big variable switches to CDF-5.  Only the sizes are
+	// checked, to keep from writing it out.
+	cw, err := OpenWriter(fileName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer cw.file.Close()
+	if err := cw.DefineDim("a", 5<<30); err != nil {
+		t.Error(err)
+	}
+	if err := cw.DefineVar("a", "byte", []string{"a"}, nil); err != nil {
+		t.Error(err)
+	}
+	cw.checkSizes()
+	if cw.version != 5 {
+		t.Error("got version", cw.version)
+	}
+}
+
+func TestFormatAutoRejected(t *testing.T) {
+	fileName := "testdata/testformatrejected.nc"
+	_ = os.Remove(fileName)
+	cw, err := OpenWriter(fileName)
+	defer os.Remove(fileName)
+	defer closeCW(t, &cw) // can be called twice
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = cw.AddVar("x", api.Variable{Values: []int32{1, 2}, Dimensions: []string{"x"}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	badAttrs, err := util.NewOrderedMap([]string{"small", "bad"},
+		map[string]interface{}{"small": uint8(1), "bad": 1})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// Each of these needs CDF-5, but is rejected, so the file stays CDF-2.
+	for _, test := range []struct {
+		name string
+		vr   api.Variable
+		err  error
+	}{
+		{"u", api.Variable{Values: []uint16{1, 2, 3}, Dimensions: []string{"x"}},
+			ErrDimensionSize},
+		{"u", api.Variable{Values: [][]uint16{{1, 2, 3}}, Dimensions: []string{"y", "x"}},
+			ErrDimensionSize},
+		{"a", api.Variable{Values: int32(1), Attributes: badAttrs}, ErrAttribute},
+	} {
+		if err := cw.AddVar(test.name, test.vr); err != test.err {
+			t.Error(test.name, "got", err, "exp", test.err)
+		}
+	}
+	if err := cw.AddGlobalAttrs(badAttrs); err != ErrAttribute {
+		t.Error("global attributes got", err)
+	}
+	closeCW(t, &cw)
+
+	nc, err := Open(fileName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer nc.Close()
+	if version := nc.(*CDF).version; version != 2 {
+		t.Error("got version", version)
+	}
+	if vars := nc.ListVariables(); !reflect.DeepEqual(vars, []string{"x"}) {
+		t.Error("got variables", vars)
+	}
+	if dims := nc.ListDimensions(); !reflect.DeepEqual(dims, []string{"x"}) {
+		t.Error("got dimensions", dims)
+	}
+}
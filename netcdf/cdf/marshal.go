@@ -0,0 +1,141 @@
+package cdf
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/batchatco/go-native-netcdf/netcdf/api"
+	"github.com/batchatco/go-native-netcdf/netcdf/util"
+)
+
+// Marshal adds a variable to cw for each field of the struct v, or the struct
+// it points to, that is tagged with the variable's name, and a global
+// attribute for each field tagged with "@" and the attribute's name.  After
+// the name of a variable can come the names of its dimensions, separated by
+// semicolons, and any number of attributes, which are strings:
+//
+//	Temp [][]float32 `netcdf:"temp,dims=time;lat,attr:units=K"`
+//
+// Untagged fields are left out.  Go types map to NetCDF types the same way
+// as they do for AddVar.  Global attributes are added to those added before,
+// replacing any with the same name.
+//
+// Errors wrapping ErrInvalidTag and ErrNonExportedField name the field.  If
+// an error is returned, nothing is added to cw.
+func Marshal(cw *CDFWriter, v interface{}) (err error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return ErrUnknownType
+	}
+	// Every field is checked before anything is added, and if adding fails,
+	// what was added is undone, so that cw is left as it was.
+	var names []string
+	var vars []api.Variable
+	var globalKeys []string
+	globals := make(map[string]interface{})
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Type().Field(i)
+		tag, has := field.Tag.Lookup("netcdf")
+		if !has || tag == "-" {
+			continue
+		}
+		if field.PkgPath != "" {
+			return fmt.Errorf("%w: %s", ErrNonExportedField, field.Name)
+		}
+		opts := strings.Split(tag, ",")
+		name := opts[0]
+		if strings.HasPrefix(name, "@") {
+			name = name[1:]
+			if _, has := globals[name]; has || len(opts) > 1 {
+				return fmt.Errorf("%w: %s", ErrInvalidTag, field.Name)
+			}
+			globalKeys = append(globalKeys, name)
+			globals[name] = rv.Field(i).Interface()
+			continue
+		}
+		vr, err := tagVariable(rv.Field(i).Interface(), opts[1:])
+		if err != nil {
+			return fmt.Errorf("%w: %s", err, field.Name)
+		}
+		names = append(names, name)
+		vars = append(vars, vr)
+	}
+	if len(globalKeys) > 0 && cw.globalAttrs != nil {
+		// Attributes that are replaced keep their place.
+		var keys []string
+		for _, key := range cw.globalAttrs.Keys() {
+			keys = append(keys, key)
+			if _, has := globals[key]; !has {
+				globals[key], _ = cw.globalAttrs.Get(key)
+			}
+		}
+		for _, key := range globalKeys {
+			if _, has := cw.globalAttrs.Get(key); !has {
+				keys = append(keys, key)
+			}
+		}
+		globalKeys = keys
+	}
+	var attrs api.AttributeMap
+	if len(globalKeys) > 0 {
+		attrs, err = util.NewOrderedMap(globalKeys, globals)
+		if err != nil {
+			return err
+		}
+	}
+
+	state := cw.state()
+	defer func() {
+		if err != nil {
+			cw.restore(state)
+		}
+	}()
+	for i, name := range names {
+		err = cw.AddVar(name, vars[i])
+		if err != nil {
+			return err
+		}
+	}
+	if attrs == nil {
+		return nil
+	}
+	return cw.AddGlobalAttrs(attrs)
+}
+
+// tagVariable returns a variable with the values and the dimensions and
+// attributes given by the options of the tag.
+func tagVariable(values interface{}, opts []string) (api.Variable, error) {
+	vr := api.Variable{Values: values}
+	var keys []string
+	attrs := make(map[string]interface{})
+	for _, opt := range opts {
+		switch {
+		case strings.HasPrefix(opt, "dims="):
+			if vr.Dimensions != nil {
+				return vr, ErrInvalidTag
+			}
+			vr.Dimensions = strings.Split(strings.TrimPrefix(opt, "dims="), ";")
+		case strings.HasPrefix(opt, "attr:"):
+			kv := strings.SplitN(strings.TrimPrefix(opt, "attr:"), "=", 2)
+			if len(kv) != 2 {
+				return vr, ErrInvalidTag
+			}
+			if _, has := attrs[kv[0]]; has {
+				return vr, ErrInvalidTag
+			}
+			keys = append(keys, kv[0])
+			attrs[kv[0]] = kv[1]
+		default:
+			return vr, ErrInvalidTag
+		}
+	}
+	if len(keys) > 0 {
+		am, err := util.NewOrderedMap(keys, attrs)
+		if err != nil {
+			return vr, err
+		}
+		vr.Attributes = am
+	}
+	return vr, nil
+}
@@ -0,0 +1,188 @@
+package cdf
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/batchatco/go-native-netcdf/netcdf/util"
+)
+
+func TestMarshal(t *testing.T) {
+	fileName := "testdata/testmarshal.nc"
+	_ = os.Remove(fileName)
+	cw, err := OpenWriter(fileName)
+	defer os.Remove(fileName)
+	defer closeCW(t, &cw) // can be called twice
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data := struct {
+		Title   string      `netcdf:"@title"`
+		Version int32       `netcdf:"@version"`
+		Temp    [][]float32 `netcdf:"temp,dims=time;lat,attr:units=K,attr:long_name=air temperature"`
+		Lats    []float64   `netcdf:"lat,dims=lat,attr:units=degrees_north"`
+		Count   uint16      `netcdf:"count"`
+		Names   []string    `netcdf:"names,dims=time;len"`
+		Skipped int32       `netcdf:"-"`
+		Other   int         // not tagged
+	}{
+		Title:   "marshal test",
+		Version: 3,
+		Temp:    [][]float32{{1, 2, 3}, {4, 5, 6}},
+		Lats:    []float64{-45, 0, 45},
+		Count:   7,
+		Names:   []string{"abc", "def"},
+	}
+	// The global attributes are merged with these.
+	globals, err := util.NewOrderedMap([]string{"history", "title"},
+		map[string]interface{}{"history": "made", "title": "old"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = cw.AddGlobalAttrs(globals)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = Marshal(cw, &data)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	closeCW(t, &cw) // this writes out the data
+
+	nc, err := Open(fileName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer nc.Close()
+
+	if !reflect.DeepEqual(nc.Attributes().Keys(), []string{"history", "title", "version"}) {
+		t.Error("global attributes", nc.Attributes().Keys())
+	}
+	history, _ := nc.Attributes().Get("history")
+	title, _ := nc.Attributes().Get("title")
+	version, _ := nc.Attributes().Get("version")
+	if history != "made" || title != "marshal test" || version != int32(3) {
+		t.Error("got global attributes", history, title, version)
+	}
+	vars := nc.ListVariables()
+	if !reflect.DeepEqual(vars, []string{"temp", "lat", "count", "names"}) {
+		t.Error("got variables", vars)
+	}
+	for _, exp := range []struct {
+		name  string
+		val   interface{}
+		dims  []string
+		attrs map[string]interface{}
+	}{
+		{"temp", data.Temp, []string{"time", "lat"},
+			map[string]interface{}{"units": "K", "long_name": "air temperature"}},
+		{"lat", data.Lats, []string{"lat"},
+			map[string]interface{}{"units": "degrees_north"}},
+		{"count", data.Count, []string{}, map[string]interface{}{}},
+		{"names", data.Names, []string{"time", "len"}, map[string]interface{}{}},
+	} {
+		vr, err := nc.GetVariable(exp.name)
+		if err != nil {
+			t.Error(exp.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(vr.Values, exp.val) {
+			t.Error(exp.name, "got", vr.Values, "exp", exp.val)
+		}
+		if !reflect.DeepEqual(vr.Dimensions, exp.dims) {
+			t.Error(exp.name, "got dimensions", vr.Dimensions, "exp", exp.dims)
+		}
+		attrs := map[string]interface{}{}
+		for _, k := range vr.Attributes.Keys() {
+			attrs[k], _ = vr.Attributes.Get(k)
+		}
+		if !reflect.DeepEqual(attrs, exp.attrs) {
+			t.Error(exp.name, "got attributes", attrs, "exp", exp.attrs)
+		}
+	}
+	if length, _ := nc.GetDimension("len"); length != 3 {
+		t.Error("got len", length)
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	fileName := "testdata/testmarshalerrors.nc"
+	cw, err := OpenWriter(fileName)
+	defer os.Remove(fileName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer closeCW(t, &cw) // can be called twice
+	for i, test := range []struct {
+		v   interface{}
+		err error
+	}{
+		{int32(1), ErrUnknownType},
+		{struct {
+			X int32 `netcdf:"x,dim=y"`
+		}{}, ErrInvalidTag},
+		{struct {
+			X int32 `netcdf:"x,attr:units"`
+		}{}, ErrInvalidTag},
+		{struct {
+			X int32 `netcdf:"x,attr:units=K,attr:units=m"`
+		}{}, ErrInvalidTag},
+		{struct {
+			X int32 `netcdf:"@x,dims=y"`
+		}{}, ErrInvalidTag},
+		{struct {
+			x int32 `netcdf:"x"`
+		}{}, ErrNonExportedField},
+		{struct {
+			X int `netcdf:"x"`
+		}{}, ErrUnknownType},
+		{struct {
+			X int32 `netcdf:"bad/name"`
+		}{}, ErrInvalidName},
+		{struct {
+			X []int32 `netcdf:"x,dims=a"`
+			Y []int32 `netcdf:"y,dims=a"`
+		}{[]int32{1}, []int32{1, 2}}, ErrDimensionSize},
+		{struct {
+			X []uint16 `netcdf:"x"`
+			G int      `netcdf:"@g"`
+		}{[]uint16{1}, 1}, ErrAttribute},
+	} {
+		err := Marshal(cw, test.v)
+		if !errors.Is(err, test.err) {
+			t.Error(i, "got", err, "exp", test.err)
+		} else if (test.err == ErrInvalidTag || test.err == ErrNonExportedField) &&
+			!strings.HasSuffix(err.Error(), ": X") && !strings.HasSuffix(err.Error(), ": x") {
+			t.Error(i, "expected the field name in", err)
+		}
+	}
+	// None of the failed calls added anything.
+	closeCW(t, &cw)
+	nc, err := Open(fileName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer nc.Close()
+	if vars := nc.ListVariables(); len(vars) != 0 {
+		t.Error("got variables", vars)
+	}
+	if dims := nc.ListDimensions(); len(dims) != 0 {
+		t.Error("got dimensions", dims)
+	}
+	if keys := nc.Attributes().Keys(); len(keys) != 0 {
+		t.Error("got global attributes", keys)
+	}
+	if version := nc.(*CDF).version; version != 2 {
+		t.Error("got version", version)
+	}
+}
@@ -0,0 +1,216 @@
+package cdf
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/batchatco/go-native-netcdf/netcdf/api"
+)
+
+func TestAppendRecord(t *testing.T) {
+	fileName := "testdata/testrecords.nc"
+	_ = os.Remove(fileName)
+	cw, err := OpenWriter(fileName)
+	defer os.Remove(fileName)
+	defer closeCW(t, &cw) // can be called twice
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, dim := range []struct {
+		name   string
+		length int64
+	}{{"time", 0}, {"lat", 3}, {"len", 4}} {
+		err = cw.DefineDim(dim.name, dim.length)
+		if err != nil {
+			t.Error(dim.name, err)
+			return
+		}
+	}
+	vars := []struct {
+		name string
+		vr   api.Variable
+	}{
+		{"lat", api.Variable{Values: []float32{-10, 0, 10}, Dimensions: []string{"lat"}}},
+		{"temp", api.Variable{Values: [][]float32{}, Dimensions: []string{"time", "lat"}}},
+		{"count", api.Variable{Values: []int16{}, Dimensions: []string{"time"}}},
+		{"label", api.Variable{Values: []string{}, Dimensions: []string{"time", "len"}}},
+		{"after", api.Variable{Values: int32(99)}},
+	}
+	for _, v := range vars {
+		err = cw.AddVar(v.name, v.vr)
+		if err != nil {
+			t.Error(v.name, err)
+			return
+		}
+	}
+	labels := []string{"abcd", "efgh", "ijkl"}
+	for i := 0; i < 3; i++ {
+		f := float32(i)
+		err = cw.AppendRecord(map[string]interface{}{
+			"temp":  []float32{f, f + 0.5, f + 0.25},
+			"count": int16(i * 10),
+			"label": labels[i],
+		})
+		if err != nil {
+			t.Error(i, err)
+			return
+		}
+	}
+	if err := cw.AddVar("late", api.Variable{Values: int32(1)}); err != ErrDataWritten {
+		t.Error("AddVar after records got", err)
+	}
+	if err := cw.DefineDim("late", 1); err != ErrDataWritten {
+		t.Error("DefineDim after records got", err)
+	}
+	if err := cw.AddGlobalAttrs(nilMap); err != ErrDataWritten {
+		t.Error("AddGlobalAttrs after records got", err)
+	}
+	closeCW(t, &cw) // this writes out the number of records
+
+	nc, err := Open(fileName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer nc.Close()
+	for _, exp := range []struct {
+		name string
+		val  interface{}
+	}{
+		{"lat", []float32{-10, 0, 10}},
+		{"temp", [][]float32{{0, 0.5, 0.25}, {1, 1.5, 1.25}, {2, 2.5, 2.25}}},
+		{"count", []int16{0, 10, 20}},
+		{"label", labels},
+		{"after", int32(99)},
+	} {
+		vr, err := nc.GetVariable(exp.name)
+		if err != nil {
+			t.Error(exp.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(vr.Values, exp.val) {
+			t.Error(exp.name, "got", vr.Values, "exp", exp.val)
+		}
+	}
+}
+
+func TestAppendRecordOneVar(t *testing.T) {
+	// Records aren't padded when there is only one record variable.
+	fileName := "testdata/testonerecord.nc"
+	_ = os.Remove(fileName)
+	cw, err := OpenWriter(fileName)
+	defer os.Remove(fileName)
+	defer closeCW(t, &cw) // can be called twice
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = cw.DefineDim("time", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = cw.DefineDim("three", 3)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = cw.AddVar("x", api.Variable{Values: [][]int16{}, Dimensions: []string{"time", "three"}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	exp := [][]int16{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}}
+	for _, rec := range exp {
+		err = cw.AppendRecord(map[string]interface{}{"x": rec})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	closeCW(t, &cw)
+
+	nc, err := Open(fileName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer nc.Close()
+	vr, err := nc.GetVariable("x")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(vr.Values, exp) {
+		t.Error("got", vr.Values, "exp", exp)
+	}
+}
+
+func TestAppendRecordErrors(t *testing.T) {
+	fileName := "testdata/testrecorderrors.nc"
+	cw, err := OpenWriter(fileName)
+	defer os.Remove(fileName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer cw.Close()
+	if err := cw.AppendRecord(map[string]interface{}{}); err != ErrRecord {
+		t.Error("no record variables got", err)
+	}
+	if err := cw.DefineDim("time", 0); err != nil {
+		t.Error(err)
+	}
+	if err := cw.DefineDim("time", 0); err != nil {
+		t.Error("same definition got", err)
+	}
+	if err := cw.DefineDim("time", 2); err != ErrDimensionSize {
+		t.Error("redefinition got", err)
+	}
+	if err := cw.DefineDim("time2", 0); err != ErrMultipleUnlimited {
+		t.Error("second unlimited got", err)
+	}
+	if err := cw.DefineDim("bad/name", 1); err != ErrInvalidName {
+		t.Error("bad name got", err)
+	}
+	if err := cw.DefineDim("lat", 2); err != nil {
+		t.Error(err)
+	}
+	for _, test := range []struct {
+		vr  api.Variable
+		err error
+	}{
+		{api.Variable{Values: [][]float32{}, Dimensions: []string{"time", "lon"}}, ErrEmptySlice},
+		{api.Variable{Values: [][]float32{}, Dimensions: []string{"time"}}, ErrDimensionSize},
+		{api.Variable{Values: []string{}, Dimensions: []string{"time"}}, ErrDimensionSize},
+		{api.Variable{Values: []int{}, Dimensions: []string{"time"}}, ErrUnknownType},
+		{api.Variable{Values: []float32{1}, Dimensions: []string{"time"}}, ErrDimensionSize},
+	} {
+		err := cw.AddVar("x", test.vr)
+		if err != test.err {
+			t.Error(test.vr, "got", err, "exp", test.err)
+		}
+	}
+	err = cw.AddVar("temp", api.Variable{Values: [][]float32{}, Dimensions: []string{"time", "lat"}})
+	if err != nil {
+		t.Error(err)
+	}
+	err = cw.AddVar("name", api.Variable{Values: []string{}, Dimensions: []string{"time", "lat"}})
+	if err != nil {
+		t.Error(err)
+	}
+	for i, record := range []map[string]interface{}{
+		{"temp": []float32{1, 2}},
+		{"temp": []float32{1, 2}, "name": "ab", "other": 1},
+		{"temp": []float32{1, 2}, "other": "ab"},
+		{"temp": []float32{1, 2, 3}, "name": "ab"},
+		{"temp": []float64{1, 2}, "name": "ab"},
+		{"temp": []float32{1, 2}, "name": "abc"},
+	} {
+		if err := cw.AppendRecord(record); err != ErrRecord {
+			t.Error(i, "got", err)
+		}
+	}
+}
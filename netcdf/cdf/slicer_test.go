@@ -2,6 +2,7 @@ package cdf
 
 import (
 	"os"
+	"reflect"
 	"testing"
 
 	"github.com/batchatco/go-native-netcdf/netcdf/api"
@@ -84,3 +85,209 @@ func TestSlicer(t *testing.T) {
 		}
 	}
 }
+
+func TestHyperslab(t *testing.T) {
+	fileName := "testdata/testhyperslab.nc"
+	_ = os.Remove(fileName)
+	cw, err := OpenWriter(fileName)
+	defer os.Remove(fileName)
+	defer closeCW(t, &cw) // can be called twice
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// temp[time][lat][lon] = time*100 + lat*10 + lon
+	temp := make([][][]int16, 3)
+	for i := range temp {
+		temp[i] = make([][]int16, 4)
+		for j := range temp[i] {
+			temp[i][j] = make([]int16, 5)
+			for k := range temp[i][j] {
+				temp[i][j][k] = int16(i*100 + j*10 + k)
+			}
+		}
+	}
+	err = cw.AddVar("temp", api.Variable{
+		Values:     temp,
+		Dimensions: []string{"time", "lat", "lon"},
+		Attributes: nilMap})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = cw.AddVar("names", api.Variable{
+		Values:     []string{"abcd", "efgh", "ijkl"},
+		Dimensions: []string{"time", "len"},
+		Attributes: nilMap})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	closeCW(t, &cw) // this writes out the data
+
+	nc, err := Open(fileName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer nc.Close()
+
+	slicer, err := nc.GetVarGetter("temp")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	tests := []struct {
+		start, count, stride []int64
+		exp                  interface{}
+	}{
+		{[]int64{0, 0, 0}, []int64{3, 4, 5}, nil, temp},
+		{[]int64{1, 1, 2}, []int64{2, 2, 2}, nil,
+			[][][]int16{{{112, 113}, {122, 123}}, {{212, 213}, {222, 223}}}},
+		{[]int64{0, 3, 0}, []int64{2, 1, 3}, []int64{2, 1, 2},
+			[][][]int16{{{30, 32, 34}}, {{230, 232, 234}}}},
+		{[]int64{2, 0, 4}, []int64{1, 4, 1}, nil,
+			[][][]int16{{{204}, {214}, {224}, {234}}}},
+		{[]int64{1, 0, 0}, []int64{0, 4, 5}, nil, [][][]int16{}},
+	}
+	for _, test := range tests {
+		slab, err := slicer.GetHyperslab(test.start, test.count, test.stride)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !reflect.DeepEqual(slab, test.exp) {
+			t.Error("hyperslab", test.start, test.count, test.stride,
+				"got", slab, "exp", test.exp)
+		}
+	}
+
+	// invalid parameters
+	bad := [][3][]int64{
+		{{0, 0}, {1, 1}, nil},
+		{{0, 0, 5}, {1, 1, 1}, nil},
+		{{0, 0, 0}, {1, 1, 4}, []int64{1, 1, 2}},
+		{{0, 0, 0}, {1, 1, 1}, []int64{1, 0, 1}},
+		{{-1, 0, 0}, {1, 1, 1}, nil},
+	}
+	for _, b := range bad {
+		_, err := slicer.GetHyperslab(b[0], b[1], b[2])
+		if err == nil {
+			t.Error("expected error", b)
+		}
+	}
+
+	slicer, err = nc.GetVarGetter("names")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	slab, err := slicer.GetHyperslab([]int64{0, 1}, []int64{2, 2}, []int64{2, 2})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(slab, []string{"bd", "jl"}) {
+		t.Error("names hyperslab", slab)
+	}
+}
+
+func TestReadInto(t *testing.T) {
+	fileName := "testdata/testreadinto.nc"
+	_ = os.Remove(fileName)
+	cw, err := OpenWriter(fileName)
+	defer os.Remove(fileName)
+	defer closeCW(t, &cw) // can be called twice
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// temp[time][lat][lon] = time*100 + lat*10 + lon
+	temp := make([][][]int16, 3)
+	flat := make([]int16, 0, 60)
+	for i := range temp {
+		temp[i] = make([][]int16, 4)
+		for j := range temp[i] {
+			temp[i][j] = make([]int16, 5)
+			for k := range temp[i][j] {
+				temp[i][j][k] = int16(i*100 + j*10 + k)
+				flat = append(flat, temp[i][j][k])
+			}
+		}
+	}
+	err = cw.AddVar("temp", api.Variable{
+		Values:     temp,
+		Dimensions: []string{"time", "lat", "lon"},
+		Attributes: nilMap})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = cw.AddVar("names", api.Variable{
+		Values:     []string{"abcd", "efgh", "ijkl"},
+		Dimensions: []string{"time", "len"},
+		Attributes: nilMap})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	closeCW(t, &cw) // this writes out the data
+
+	nc, err := Open(fileName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer nc.Close()
+
+	slicer, err := nc.GetVarGetter("temp")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	dst := make([]int16, 60)
+	err = slicer.ReadInto(dst, nil, nil)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(dst, flat) {
+		t.Error("got", dst)
+	}
+	// dst is reused, and only the start of it is filled
+	err = slicer.ReadInto(dst, []int64{1, 1, 2}, []int64{2, 2, 2})
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(dst[:8],
+		[]int16{112, 113, 122, 123, 212, 213, 222, 223}) || dst[8] != flat[8] {
+		t.Error("got", dst)
+	}
+
+	bad := []struct {
+		dst          interface{}
+		start, count []int64
+	}{
+		{make([]int32, 60), nil, nil},
+		{make([]int16, 59), nil, nil},
+		{int16(0), []int64{0, 0, 0}, []int64{1, 1, 1}},
+		{dst, []int64{0, 0, 5}, []int64{1, 1, 1}},
+		{dst, []int64{0, 0}, nil},
+	}
+	for _, b := range bad {
+		err := slicer.ReadInto(b.dst, b.start, b.count)
+		if err == nil {
+			t.Errorf("expected error %T %v %v", b.dst, b.start, b.count)
+		}
+	}
+
+	slicer, err = nc.GetVarGetter("names")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	chars := make([]byte, 4)
+	err = slicer.ReadInto(chars, []int64{1, 1}, []int64{2, 2})
+	if err != nil {
+		t.Error(err)
+	} else if string(chars) != "fgjk" {
+		t.Error("names got", string(chars))
+	}
+}
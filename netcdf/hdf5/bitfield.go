@@ -2,9 +2,9 @@ package hdf5
 
 import (
 	"encoding/binary"
+	"fmt"
 	"io"
-
-	"github.com/batchatco/go-thrower"
+	"reflect"
 )
 
 type bitfieldManagerType struct{}
@@ -16,17 +16,79 @@ var (
 
 func (bitfieldManagerType) cdlTypeString(sh sigHelper, name string, attr *attribute, origNames map[string]bool) string {
 	// Not NetCDF
-	return "uchar" // same as uint8
+	switch attr.length {
+	case 1:
+		return "uchar" // same as uint8
+	case 2:
+		return "ushort"
+	case 4:
+		return "uint"
+	case 8:
+		return "uint64"
+	default:
+		panic("bad bitfield length")
+	}
 }
 
 func (bitfieldManagerType) goTypeString(sh sigHelper, typeName string, attr *attribute, origNames map[string]bool) string {
 	// Not NetCDF
-	return "uint8" // bitfield same as uint8
+	switch attr.length {
+	case 1:
+		return "uint8"
+	case 2:
+		return "uint16"
+	case 4:
+		return "uint32"
+	case 8:
+		return "uint64"
+	default:
+		panic("bad bitfield length")
+	}
 }
 
 func (bitfieldManagerType) alloc(hr heapReader, c caster, bf io.Reader, attr *attribute,
 	dimensions []uint64) interface{} {
-	values := allocInt8s(bf, dimensions, false, nil)
+	assertError(allowBitfields, ErrBitfield, "bitfields are only read with SetNonNetCDFTypes")
+	var values interface{}
+	switch attr.length {
+	case 1:
+		values = allocInt8s(bf, dimensions, false, nil)
+	case 2:
+		values = allocShorts(bf, dimensions, attr.endian, false, nil)
+	case 4:
+		values = allocInts(bf, dimensions, attr.endian, false, nil)
+	case 8:
+		values = allocInt64s(bf, dimensions, attr.endian, false, nil)
+	default:
+		fail(fmt.Sprintf("bad size bitfield: %d (%v)", attr.length, attr))
+	}
+	if attr.bitOffset > 0 || uint32(attr.bitPrecision) < attr.length*8 {
+		// The padding bits may be ones, so they are masked off.
+		values = extractBits(values, uint(attr.bitOffset), uint(attr.bitPrecision))
+	}
+	return values
+}
+
+// extractBits replaces the unsigned integers in values, which may be a scalar
+// or nested slices, with the bits from offset to offset+precision.
+func extractBits(values interface{}, offset uint, precision uint) interface{} {
+	mask := uint64(1)<<precision - 1
+	v := reflect.ValueOf(values)
+	if v.Kind() != reflect.Slice {
+		return reflect.ValueOf(v.Uint() >> offset & mask).Convert(v.Type()).Interface()
+	}
+	var extract func(v reflect.Value)
+	extract = func(v reflect.Value) {
+		for i := 0; i < v.Len(); i++ {
+			e := v.Index(i)
+			if e.Kind() == reflect.Slice {
+				extract(e)
+				continue
+			}
+			e.SetUint(e.Uint() >> offset & mask)
+		}
+	}
+	extract(v)
 	return values
 }
 
@@ -35,6 +97,7 @@ func (bitfieldManagerType) defaultFillValue(obj *object, objFillValue []byte, un
 }
 
 func (bitfieldManagerType) parse(hr heapReader, c caster, attr *attribute, bitFields uint32, bf remReader, df remReader) {
+	logger.Info("* bitfield")
 	endian := hasFlag8(uint8(bitFields), 0)
 	switch endian {
 	case false:
@@ -43,26 +106,30 @@ func (bitfieldManagerType) parse(hr heapReader, c caster, attr *attribute, bitFi
 		attr.endian = binary.BigEndian
 	}
 	loPad := hasFlag8(uint8(bitFields), 1)
-	assert(!loPad, "low pad not supported")
 	hiPad := hasFlag8(uint8(bitFields), 2)
-	assert(!hiPad, "high pad not supported")
-	bitOffset := read16(bf)
-	checkVal(0, bitOffset, "bit offset must be zero")
-	bitPrecision := read16(bf)
-	logger.Infof("BitField offset %d, precision %d", bitOffset, bitPrecision)
+	attr.bitOffset = read16(bf)
+	attr.bitPrecision = read16(bf)
+	logger.Infof("BitField offset %d, precision %d, low pad %v, high pad %v", attr.bitOffset,
+		attr.bitPrecision, loPad, hiPad)
+	switch attr.length {
+	case 1, 2, 4, 8:
+		break
+	default:
+		failError(ErrBitfield, fmt.Sprint("bad bitfield size: ", attr.length))
+	}
+	assertError(attr.bitPrecision > 0 &&
+		uint32(attr.bitOffset)+uint32(attr.bitPrecision) <= attr.length*8,
+		ErrCorrupted, "bitfield bits don't fit")
 	if df == nil || df.Rem() == 0 {
 		logger.Infof("no data")
 		return
 	}
 	logger.Info("bitfield rem: ", df.Rem())
 	if !allowBitfields {
-		if df != nil {
-			b := make([]byte, df.Rem())
-			read(df, b)
-			logger.Infof("bitfield value: %#x", b)
-		}
-		logger.Infof("Bitfields ignored")
-		thrower.Throw(ErrBitfield)
+		b := make([]byte, df.Rem())
+		read(df, b)
+		logger.Infof("bitfield value: %#x", b)
+		failError(ErrBitfield, "bitfields are only read with SetNonNetCDFTypes")
 	}
 	if df.Rem() >= int64(attr.length) {
 		attr.df = newResetReaderSave(df, df.Rem())
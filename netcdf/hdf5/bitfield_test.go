@@ -0,0 +1,109 @@
+package hdf5
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// bitfieldFile returns a file with a variable named mask of four bitfields
+// of the given size, bit offset and precision.  The data is raw, so it can be
+// in either byte order.
+func bitfieldFile(bigEndian bool, size uint32, offset, precision uint16, data []byte) []byte {
+	flags := 0
+	if bigEndian {
+		flags = 1
+	}
+	b := newFileBuilder(0, 8, 8)
+	b.addVar("mask", []uint64{4},
+		v1Message(typeDatatype, 0x10|typeBitField, flags, 0, 0, size, offset, precision),
+		data)
+	return b.bytes()
+}
+
+func TestBitfieldSizes(t *testing.T) {
+	defer setBitfields(setBitfields(true))
+	for _, test := range []struct {
+		name      string
+		bigEndian bool
+		size      uint32
+		offset    uint16
+		precision uint16
+		data      []byte
+		exp       interface{}
+		cdl       string
+	}{
+		{"8-bit", false, 1, 0, 8, []byte{0, 1, 0x80, 0xff}, []uint8{0, 1, 0x80, 0xff}, "uchar"},
+		{"8-bit masked", false, 1, 2, 3, []byte{0xff, 0x04, 0x1c, 0xe3},
+			[]uint8{7, 1, 7, 0}, "uchar"},
+		{"16-bit", false, 2, 0, 16, []byte{1, 0, 0, 1, 0xff, 0xff, 0x34, 0x12},
+			[]uint16{1, 0x100, 0xffff, 0x1234}, "ushort"},
+		{"16-bit big endian", true, 2, 4, 8, []byte{0xf1, 0x2f, 0, 0x10, 0, 0, 0xff, 0xff},
+			[]uint16{0x12, 1, 0, 0xff}, "ushort"},
+		{"32-bit", true, 4, 0, 32,
+			[]byte{0, 0, 0, 1, 0x80, 0, 0, 0, 0xde, 0xad, 0xbe, 0xef, 0, 1, 0, 0},
+			[]uint32{1, 0x80000000, 0xdeadbeef, 0x10000}, "uint"},
+		{"32-bit masked", false, 4, 8, 12,
+			[]byte{0xff, 0x34, 0xf2, 0xff, 0, 0, 0, 0, 0, 0xff, 0x0f, 0, 0xff, 0, 0x10, 0},
+			[]uint32{0x234, 0, 0xfff, 0}, "uint"},
+	} {
+		file := bitfieldFile(test.bigEndian, test.size, test.offset, test.precision, test.data)
+		nc, err := New(nopCloser{bytes.NewReader(file)})
+		if err != nil {
+			t.Error(test.name, err)
+			continue
+		}
+		vr, err := nc.GetVariable("mask")
+		if err != nil {
+			t.Error(test.name, err)
+		} else if !reflect.DeepEqual(vr.Values, test.exp) {
+			t.Errorf("%s: got %#x exp %#x", test.name, vr.Values, test.exp)
+		}
+		vg, err := nc.GetVarGetter("mask")
+		if err != nil {
+			t.Error(test.name, err)
+		} else if vg.Type() != test.cdl {
+			t.Error(test.name, "got type", vg.Type(), "exp", test.cdl)
+		}
+		nc.Close()
+	}
+}
+
+func TestBitfieldsNotAllowed(t *testing.T) {
+	defer setBitfields(setBitfields(false))
+	file := bitfieldFile(false, 2, 0, 16, make([]byte, 8))
+	nc, err := New(nopCloser{bytes.NewReader(file)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	_, err = nc.GetVariable("mask")
+	if err != ErrBitfield {
+		t.Error("expected bitfield error, got", err)
+	}
+}
+
+func TestBadBitfield(t *testing.T) {
+	defer setBitfields(setBitfields(true))
+	for _, test := range []struct {
+		size      uint32
+		offset    uint16
+		precision uint16
+		err       error
+	}{
+		{3, 0, 24, ErrBitfield},
+		{2, 8, 9, ErrCorrupted},
+		{4, 0, 0, ErrCorrupted},
+	} {
+		file := bitfieldFile(false, test.size, test.offset, test.precision,
+			make([]byte, 4*test.size))
+		nc, err := New(nopCloser{bytes.NewReader(file)})
+		if err == nil {
+			_, err = nc.GetVariable("mask")
+			nc.Close()
+		}
+		if err != test.err {
+			t.Error(test.size, test.offset, test.precision, "expected", test.err, "got", err)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package hdf5
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+)
+
+// Some features can't be made with the HDF5 tools, or only in ways that
+// don't cover everything, so tests build files, or parts of them, by hand.
+
+type indexBuilder struct {
+	buf bytes.Buffer
+}
+
+func (b *indexBuilder) addr() uint64 {
+	return uint64(b.buf.Len())
+}
+
+// put appends values.  Ints are written as single bytes, strings as is, and
+// everything else in little-endian order.
+func (b *indexBuilder) put(vals ...interface{}) {
+	for _, v := range vals {
+		switch v := v.(type) {
+		case string:
+			b.buf.WriteString(v)
+		case int:
+			b.buf.WriteByte(byte(v))
+		case []interface{}:
+			b.put(v...)
+		default:
+			err := binary.Write(&b.buf, binary.LittleEndian, v)
+			if err != nil {
+				panic(err)
+			}
+		}
+	}
+}
+
+// block appends values followed by their checksum.
+func (b *indexBuilder) block(vals ...interface{}) {
+	start := b.addr()
+	b.put(vals...)
+	data := b.buf.Bytes()[start:]
+	b.put(computeChecksumStream(newResetReaderFromBytes(data), len(data)))
+}
+
+// sized returns v as an integer of the given size.  Truncating the undefined
+// address gives all ones.
+func sized(size int, v uint64) interface{} {
+	switch size {
+	case 2:
+		return uint16(v)
+	case 4:
+		return uint32(v)
+	}
+	return v
+}
+
+// v1Message returns a version 1 object header message, padded to a
+// multiple of 8 bytes.
+func v1Message(ty uint16, vals ...interface{}) []interface{} {
+	var data indexBuilder
+	data.put(vals...)
+	data.put(make([]byte, (8-data.buf.Len()%8)%8))
+	return []interface{}{ty, uint16(data.buf.Len()), 0, 0, 0, 0, data.buf.Bytes()}
+}
+
+// v1ObjectHeader returns a version 1 object header with the messages.
+func v1ObjectHeader(messages ...[]interface{}) []interface{} {
+	var msgs indexBuilder
+	for _, m := range messages {
+		msgs.put(m...)
+	}
+	return []interface{}{1, 0, uint16(len(messages)), uint32(1), uint32(msgs.buf.Len()),
+		uint32(0), msgs.buf.Bytes()}
+}
+
+// int32Datatype is the datatype message of a little-endian int32.
+func int32Datatype() []interface{} {
+	return v1Message(typeDatatype, 0x10, 0x08, 0, 0, uint32(4), uint16(0), uint16(32))
+}
+
+// fileBuilder builds a file whose root group is an old-style group with a
+// symbol table, holding the variables added to it.  Everything after the
+// superblock is put in the embedded builder, whose addresses are relative to
+// the end of the superblock.
+type fileBuilder struct {
+	indexBuilder
+	version    int // of the superblock, 0 or 2
+	offsetSize int
+	lengthSize int
+	leafK      uint16 // the K values in a version 0 superblock
+	internalK  uint16
+	perLeaf    int    // symbol table entries per leaf
+	perNode    int    // children per group B-tree node
+	extension  uint64 // address of the superblock extension
+	vars       map[string]uint64
+}
+
+// newFileBuilder returns a builder with the given superblock version and
+// sizes of offsets and lengths.  The group B-tree has the default K values
+// and a single leaf.
+func newFileBuilder(version, offsetSize, lengthSize int) *fileBuilder {
+	return &fileBuilder{
+		version:    version,
+		offsetSize: offsetSize,
+		lengthSize: lengthSize,
+		leafK:      4,
+		internalK:  16,
+		perLeaf:    8,
+		perNode:    32,
+		extension:  invalidAddress,
+		vars:       make(map[string]uint64),
+	}
+}
+
+func (b *fileBuilder) sbSize() uint64 {
+	if b.version == 0 {
+		return uint64(48 + 6*b.offsetSize)
+	}
+	return uint64(16 + 4*b.offsetSize)
+}
+
+// addr returns the address in the file of the next value put.
+func (b *fileBuilder) addr() uint64 {
+	return b.sbSize() + b.indexBuilder.addr()
+}
+
+// o returns v as an offset.
+func (b *fileBuilder) o(v uint64) interface{} {
+	return sized(b.offsetSize, v)
+}
+
+// l returns v as a length.
+func (b *fileBuilder) l(v uint64) interface{} {
+	return sized(b.lengthSize, v)
+}
+
+// addExtension adds the superblock extension, with the messages.
+func (b *fileBuilder) addExtension(messages ...[]interface{}) {
+	b.extension = b.addr()
+	b.put(v1ObjectHeader(messages...))
+}
+
+// addVar adds a contiguous variable with the given dimensions, datatype
+// message and data, and any other messages for its object header.
+func (b *fileBuilder) addVar(name string, dims []uint64, datatype []interface{},
+	data interface{}, messages ...[]interface{}) {
+	var raw indexBuilder
+	raw.put(data)
+	dataAddr := b.addr()
+	b.put(raw.buf.Bytes())
+	layout := v1Message(typeDataLayout, 3, classContiguous, b.o(dataAddr), b.l(raw.addr()))
+	b.addObject(name, append([][]interface{}{b.dataspace(dims), datatype, layout},
+		messages...)...)
+}
+
+// dataspace returns the dataspace message for the dimensions.
+func (b *fileBuilder) dataspace(dims []uint64) []interface{} {
+	vals := []interface{}{1, len(dims), 0, 0, uint32(0)}
+	for _, d := range dims {
+		vals = append(vals, b.l(d))
+	}
+	return v1Message(typeDataspace, vals...)
+}
+
+// addObject adds an object to the root group with the messages in its
+// object header.
+func (b *fileBuilder) addObject(name string, messages ...[]interface{}) {
+	b.vars[name] = b.addr()
+	b.put(v1ObjectHeader(messages...))
+}
+
+// groupNode is a symbol table leaf or group B-tree node, with the local heap
+// offset of the last name under it.
+type groupNode struct {
+	addr     uint64
+	lastName uint64
+}
+
+// putGroupTree adds the group B-tree nodes above the children, with at most
+// perNode children each, and returns the root.
+func (b *fileBuilder) putGroupTree(children []groupNode, level int) groupNode {
+	var sizes []uint64
+	for i := 0; i < len(children); i += b.perNode {
+		n := b.perNode
+		if len(children)-i < n {
+			n = len(children) - i
+		}
+		sizes = append(sizes, uint64(8+2*b.offsetSize+n*(b.offsetSize+b.lengthSize)+b.lengthSize))
+	}
+	var nodes []groupNode
+	addr := b.addr()
+	for j, size := range sizes {
+		left, right := invalidAddress, invalidAddress
+		if j > 0 {
+			left = addr - sizes[j-1]
+		}
+		if j < len(sizes)-1 {
+			right = addr + size
+		}
+		kids := children[j*b.perNode:]
+		if len(kids) > b.perNode {
+			kids = kids[:b.perNode]
+		}
+		key := uint64(0)
+		if j > 0 {
+			key = nodes[j-1].lastName
+		}
+		b.put("TREE", 0, level, uint16(len(kids)), b.o(left), b.o(right))
+		for _, kid := range kids {
+			b.put(b.l(key), b.o(kid.addr))
+			key = kid.lastName
+		}
+		b.put(b.l(key))
+		nodes = append(nodes, groupNode{addr, key})
+		addr += size
+	}
+	if len(nodes) == 1 {
+		return nodes[0]
+	}
+	return b.putGroupTree(nodes, level+1)
+}
+
+// bytes adds the root group and returns the file.
+func (b *fileBuilder) bytes() []byte {
+	var names []string
+	for name := range b.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var heapData indexBuilder
+	heapData.put(make([]byte, 8))
+	offsets := make(map[string]uint64)
+	for _, name := range names {
+		offsets[name] = heapData.addr()
+		heapData.put(name, make([]byte, 8-len(name)%8))
+	}
+	data := b.addr()
+	b.put(heapData.buf.Bytes())
+	heap := b.addr()
+	b.put("HEAP", 0, 0, 0, 0, b.l(heapData.addr()), b.l(invalidAddress), b.o(data))
+
+	var leaves []groupNode
+	for i := 0; i < len(names); i += b.perLeaf {
+		leafNames := names[i:]
+		if len(leafNames) > b.perLeaf {
+			leafNames = leafNames[:b.perLeaf]
+		}
+		leaf := b.addr()
+		b.put("SNOD", 1, 0, uint16(len(leafNames)))
+		for _, name := range leafNames {
+			b.put(b.o(offsets[name]), b.o(b.vars[name]), uint32(0), uint32(0),
+				make([]byte, 16))
+		}
+		leaves = append(leaves, groupNode{leaf, offsets[leafNames[len(leafNames)-1]]})
+	}
+	tree := b.putGroupTree(leaves, 0).addr
+	root := b.addr()
+	b.put(v1ObjectHeader(v1Message(typeSymbolTableMessage, b.o(tree), b.o(heap))))
+
+	var sb indexBuilder
+	if b.version == 0 {
+		sb.put(magic, 0, 0, 0, 0, 0, b.offsetSize, b.lengthSize, 0, b.leafK, b.internalK,
+			uint32(0))
+		sb.put(b.o(0), b.o(invalidAddress), b.o(b.addr()), b.o(invalidAddress))
+		// root group symbol table entry
+		sb.put(b.o(0), b.o(root), uint32(1), uint32(0), b.o(tree), b.o(heap),
+			make([]byte, 16-2*b.offsetSize))
+	} else {
+		sb.block(magic, b.version, b.offsetSize, b.lengthSize, 0, b.o(0), b.o(b.extension),
+			b.o(b.addr()), b.o(root))
+	}
+	return append(sb.buf.Bytes(), b.buf.Bytes()...)
+}
@@ -0,0 +1,660 @@
+package hdf5
+
+// Chunk indexes for version 4 of the data layout message.
+//
+// Version 3 layouts always index chunks with a version 1 B-tree.  Version 4
+// layouts can use one of five indexes, depending on the dataset's maximum
+// dimensions and the library version bounds used to write the file:
+//
+//   single chunk:      the whole dataset is one chunk
+//   implicit:          chunks are stored contiguously, in order
+//   fixed array:       FAHD header and FADB data block (possibly paged)
+//   extensible array:  EAHD header, EAIB index block, EASB super blocks
+//                      and EADB data blocks (possibly paged)
+//   version 2 B-tree:  BTHD header, BTIN internal nodes and BTLF leaves
+//
+// Whichever index is used, the chunks end up in the object's dataBlocks,
+// in row-major order, the same as for version 3 layouts.
+
+import (
+	"fmt"
+	"io"
+)
+
+// chunk indexing types
+const (
+	chunkIndexSingle = iota + 1
+	chunkIndexImplicit
+	chunkIndexFixedArray
+	chunkIndexExtensibleArray
+	chunkIndexBTree2
+)
+
+// version 2 B-tree record types for chunks
+const (
+	btreeChunks         = 10
+	btreeFilteredChunks = 11
+)
+
+// Size of the signature, version, type and checksum of a version 2 B-tree node.
+const btree2PrefixSize = 10
+
+type chunkIndex struct {
+	parent           *object
+	layout           []uint64 // size of a chunk in each dimension, in elements
+	dtSize           uint64   // size of one element
+	numberOfElements uint64   // number of elements in a chunk
+	filtered         bool     // entries have a chunk size and filter mask
+}
+
+// addChunk adds a chunk to the object's data blocks.  The offsets are the
+// dataset coordinates of the chunk's first element.
+func addChunk(parent *object, addr uint64, size uint64, filterMask uint32,
+	offsets []uint64, dtSize uint64, numberOfElements uint64) {
+	if parent.unfilteredEdges && isEdgeChunk(parent, offsets) {
+		logger.Info("unfiltered edge chunk at", offsets)
+		filterMask = ^uint32(0) // skip all the filters
+	}
+	dso := uint64(0)
+	sizes := dtSize
+	if parent.objAttr.dimensions != nil {
+		for d := len(offsets) - 1; d >= 0; d-- {
+			dso += offsets[d] * sizes
+			logger.Info("d=", d, "dim=", len(offsets), "parent dim=", parent.objAttr.dimensions)
+			sizes *= parent.objAttr.dimensions[d]
+		}
+	}
+	pending := dataBlock{addr, size, 0, 0, filterMask, nil, nil}
+	pending.dsOffset = dso
+	pending.dsLength = numberOfElements * dtSize
+	pending.offsets = offsets
+	logger.Info("dsoffset", dso, "dslength", pending.dsLength, "dtsize", dtSize)
+	parent.dataBlocks = append(parent.dataBlocks, pending)
+}
+
+// isEdgeChunk returns true if the chunk at the offsets goes past the end of
+// the dataset in any dimension.
+func isEdgeChunk(parent *object, offsets []uint64) bool {
+	dims := parent.objAttr.dimensions
+	layout := parent.objAttr.layout
+	assertError(len(dims) == len(offsets) && len(layout) >= len(offsets), ErrLayout,
+		"can't find the partial edge chunks without the dimensions")
+	for d, offset := range offsets {
+		if offset+layout[d] > dims[d] {
+			return true
+		}
+	}
+	return false
+}
+
+// readUint reads an unsigned little-endian integer of size bytes.
+func readUint(r io.Reader, size int) uint64 {
+	assert(size >= 0 && size <= 8, fmt.Sprint("bad integer size: ", size))
+	b := make([]byte, size)
+	read(r, b)
+	v := uint64(0)
+	for i := size - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	return v
+}
+
+// bitIsSet returns whether bit n of a page bitmap is set.  The bits are
+// numbered starting with the high bit of the first byte.
+func bitIsSet(bitmap []byte, n uint64) bool {
+	return bitmap[n/8]&(0x80>>(n%8)) != 0
+}
+
+// chunksPerDim returns the number of chunks in each dimension.
+func (ci *chunkIndex) chunksPerDim() []uint64 {
+	dims := ci.parent.objAttr.dimensions
+	assertError(len(dims) == len(ci.layout), ErrLayout,
+		fmt.Sprint("chunk dimensions ", ci.layout, " don't match dataset ", dims))
+	n := make([]uint64, len(dims))
+	for d := range dims {
+		n[d] = (dims[d] + ci.layout[d] - 1) / ci.layout[d]
+	}
+	return n
+}
+
+// numChunks returns the number of chunks needed to cover the dataset.
+func (ci *chunkIndex) numChunks() uint64 {
+	total := uint64(1)
+	for _, n := range ci.chunksPerDim() {
+		total *= n
+	}
+	return total
+}
+
+// offsets converts the row-major index of a chunk to the dataset
+// coordinates of its first element.
+func (ci *chunkIndex) offsets(index uint64) []uint64 {
+	n := ci.chunksPerDim()
+	offsets := make([]uint64, len(n))
+	for d := len(n) - 1; d > 0; d-- {
+		offsets[d] = (index % n[d]) * ci.layout[d]
+		index /= n[d]
+	}
+	if len(n) > 0 {
+		offsets[0] = index * ci.layout[0]
+	}
+	return offsets
+}
+
+func (ci *chunkIndex) chunkSize() uint64 {
+	return ci.numberOfElements * ci.dtSize
+}
+
+// readEntry reads a fixed or extensible array entry for the chunk with the
+// given row-major index, and adds the chunk if it has been written.
+func (h5 *HDF5) readEntry(ci *chunkIndex, bf io.Reader, index uint64, entrySize uint8) {
+	addr := h5.readAddr(bf)
+	size := ci.chunkSize()
+	filterMask := uint32(0)
+	if ci.filtered {
+		size = readUint(bf, int(entrySize)-int(h5.sizeOfOffsets)-4)
+		filterMask = read32(bf)
+	}
+	if addr == invalidAddress {
+		logger.Info("chunk", index, "not written")
+		return
+	}
+	logger.Infof("chunk %d addr=0x%x size=%d mask=0x%x", index, addr, size, filterMask)
+	addChunk(ci.parent, addr, size, filterMask, ci.offsets(index), ci.dtSize,
+		ci.numberOfElements)
+}
+
+func (h5 *HDF5) readSingleChunk(ci *chunkIndex, addr uint64, size uint64, filterMask uint32) {
+	logger.Infof("single chunk addr=0x%x size=%d", addr, size)
+	if addr == invalidAddress {
+		return
+	}
+	addChunk(ci.parent, addr, size, filterMask, make([]uint64, len(ci.layout)),
+		ci.dtSize, ci.numberOfElements)
+}
+
+func (h5 *HDF5) readImplicitIndex(ci *chunkIndex, addr uint64) {
+	logger.Infof("implicit index addr=0x%x", addr)
+	if addr == invalidAddress {
+		return
+	}
+	size := ci.chunkSize()
+	n := ci.numChunks()
+	for i := uint64(0); i < n; i++ {
+		addChunk(ci.parent, addr+i*size, size, 0, ci.offsets(i), ci.dtSize,
+			ci.numberOfElements)
+	}
+}
+
+func (h5 *HDF5) readFixedArray(ci *chunkIndex, addr uint64) {
+	headerSize := 8 + int64(h5.sizeOfLengths) + int64(h5.sizeOfOffsets)
+	bf := h5.newSeek(addr, headerSize+4)
+	checkMagic(bf, 4, "FAHD")
+	version := read8(bf)
+	checkVal(0, version, "fixed array header version")
+	clientID := read8(bf)
+	entrySize := read8(bf)
+	pageBits := read8(bf)
+	nEntries := h5.readLength(bf)
+	dataBlockAddr := h5.readAddr(bf)
+	logger.Infof("fixed array client=%d entry size=%d page bits=%d entries=%d block=0x%x",
+		clientID, entrySize, pageBits, nEntries, dataBlockAddr)
+	h5.checkChecksum(addr, int(headerSize))
+	assertError(clientID <= 1, ErrLayout, fmt.Sprint("bad fixed array client: ", clientID))
+	ci.filtered = clientID == 1
+	// The array is indexed by the maximum dimensions, which we assume to be
+	// the same as the current ones.
+	assertError(nEntries == ci.numChunks(), ErrLayout,
+		fmt.Sprint("fixed array has ", nEntries, " entries, expected ", ci.numChunks()))
+	if dataBlockAddr == invalidAddress {
+		logger.Info("fixed array has no data block")
+		return
+	}
+
+	// signature, version, client, header address
+	prefixSize := 4 + 1 + 1 + uint64(h5.sizeOfOffsets)
+	pageEntries := uint64(1) << pageBits
+	nPages := uint64(0)
+	bitmapSize := uint64(0)
+	if nEntries > pageEntries {
+		nPages = (nEntries + pageEntries - 1) / pageEntries
+		bitmapSize = (nPages + 7) / 8
+	}
+	blockSize := prefixSize + bitmapSize
+	if nPages == 0 {
+		blockSize += nEntries * uint64(entrySize)
+	}
+	bf = h5.newSeek(dataBlockAddr, int64(blockSize)+4)
+	checkMagic(bf, 4, "FADB")
+	version = read8(bf)
+	checkVal(0, version, "fixed array data block version")
+	checkVal(clientID, read8(bf), "fixed array data block client")
+	checkVal(addr, h5.readAddr(bf), "fixed array header address")
+	if nPages == 0 {
+		for i := uint64(0); i < nEntries; i++ {
+			h5.readEntry(ci, bf, i, entrySize)
+		}
+		h5.checkChecksum(dataBlockAddr, int(blockSize))
+		return
+	}
+	bitmap := make([]byte, bitmapSize)
+	read(bf, bitmap)
+	h5.checkChecksum(dataBlockAddr, int(blockSize))
+
+	// The pages follow the data block, each with its own checksum.
+	pageSize := pageEntries*uint64(entrySize) + 4
+	pageAddr := dataBlockAddr + blockSize + 4
+	for p := uint64(0); p < nPages; p++ {
+		n := pageEntries
+		if p == nPages-1 {
+			n = nEntries - p*pageEntries
+		}
+		if bitIsSet(bitmap, p) {
+			bf := h5.newSeek(pageAddr, int64(n*uint64(entrySize))+4)
+			for i := uint64(0); i < n; i++ {
+				h5.readEntry(ci, bf, p*pageEntries+i, entrySize)
+			}
+			h5.checkChecksum(pageAddr, int(n*uint64(entrySize)))
+		} else {
+			logger.Info("fixed array page", p, "not initialized")
+		}
+		pageAddr += pageSize
+	}
+}
+
+// extensibleArray holds the parameters from an extensible array header.
+type extensibleArray struct {
+	ci                *chunkIndex
+	addr              uint64 // header address
+	clientID          uint8
+	entrySize         uint8
+	arrayOffsetSize   int // size of the block offset field
+	pageEntries       uint64
+	indexBlockEntries uint64
+	// minimum number of data block pointers in a super block
+	superBlockMinPointers uint64
+	nEntries              uint64 // entries to read
+	superBlocks           []eaSuperBlockInfo
+}
+
+// eaSuperBlockInfo describes the data blocks of one super block.
+type eaSuperBlockInfo struct {
+	nDataBlocks      uint64
+	dataBlockEntries uint64 // entries in each data block
+	startIndex       uint64 // first entry, not counting the index block entries
+	startDataBlock   uint64
+}
+
+// The unlimited dimension is assumed to be the first one, which is the only
+// place netCDF puts it, so chunks are in row-major order.
+func (h5 *HDF5) readExtensibleArray(ci *chunkIndex, addr uint64) {
+	headerSize := 12 + 6*int64(h5.sizeOfLengths) + int64(h5.sizeOfOffsets)
+	bf := h5.newSeek(addr, headerSize+4)
+	checkMagic(bf, 4, "EAHD")
+	version := read8(bf)
+	checkVal(0, version, "extensible array header version")
+	clientID := read8(bf)
+	entrySize := read8(bf)
+	maxBits := read8(bf)
+	indexBlockEntries := read8(bf)
+	dataBlockMinEntries := read8(bf)
+	superBlockMinPointers := read8(bf)
+	pageBits := read8(bf)
+	nSuperBlocks := h5.readLength(bf)
+	superBlocksSize := h5.readLength(bf)
+	nDataBlocks := h5.readLength(bf)
+	dataBlocksSize := h5.readLength(bf)
+	maxIndexSet := h5.readLength(bf)
+	nElements := h5.readLength(bf)
+	indexBlockAddr := h5.readAddr(bf)
+	logger.Infof("extensible array client=%d entry size=%d max bits=%d index entries=%d",
+		clientID, entrySize, maxBits, indexBlockEntries)
+	logger.Infof("min data block entries=%d min super block pointers=%d page bits=%d",
+		dataBlockMinEntries, superBlockMinPointers, pageBits)
+	logger.Infof("super blocks=%d (%d bytes) data blocks=%d (%d bytes) max index=%d elements=%d",
+		nSuperBlocks, superBlocksSize, nDataBlocks, dataBlocksSize, maxIndexSet, nElements)
+	h5.checkChecksum(addr, int(headerSize))
+	assertError(clientID <= 1, ErrLayout,
+		fmt.Sprint("bad extensible array client: ", clientID))
+	assertError(dataBlockMinEntries > 0 && superBlockMinPointers > 0, ErrLayout,
+		"bad extensible array parameters")
+	ci.filtered = clientID == 1
+	if indexBlockAddr == invalidAddress {
+		logger.Info("extensible array has no index block")
+		return
+	}
+	ea := &extensibleArray{
+		ci:                    ci,
+		addr:                  addr,
+		clientID:              clientID,
+		entrySize:             entrySize,
+		arrayOffsetSize:       (int(maxBits) + 7) / 8,
+		pageEntries:           uint64(1) << pageBits,
+		indexBlockEntries:     uint64(indexBlockEntries),
+		superBlockMinPointers: uint64(superBlockMinPointers),
+		nEntries:              ci.numChunks(),
+	}
+	if maxIndexSet < ea.nEntries {
+		ea.nEntries = maxIndexSet
+	}
+	nSuper := 1 + int(maxBits) - log2(uint64(dataBlockMinEntries))
+	startIndex := uint64(0)
+	startDataBlock := uint64(0)
+	for u := 0; u < nSuper; u++ {
+		info := eaSuperBlockInfo{
+			nDataBlocks:      uint64(1) << (u / 2),
+			dataBlockEntries: (uint64(1) << ((u + 1) / 2)) * uint64(dataBlockMinEntries),
+			startIndex:       startIndex,
+			startDataBlock:   startDataBlock,
+		}
+		ea.superBlocks = append(ea.superBlocks, info)
+		startIndex += info.nDataBlocks * info.dataBlockEntries
+		startDataBlock += info.nDataBlocks
+	}
+	h5.readEAIndexBlock(ea, indexBlockAddr)
+}
+
+func (h5 *HDF5) readEAIndexBlock(ea *extensibleArray, addr uint64) {
+	// The first super blocks have their data block addresses in the index
+	// block, the rest have their own super block.
+	nIndexSuperBlocks := 2 * log2(ea.superBlockMinPointers)
+	if nIndexSuperBlocks > len(ea.superBlocks) {
+		nIndexSuperBlocks = len(ea.superBlocks)
+	}
+	nDataBlockAddrs := 2 * (ea.superBlockMinPointers - 1)
+	nSuperBlockAddrs := uint64(len(ea.superBlocks) - nIndexSuperBlocks)
+	offsetSize := uint64(h5.sizeOfOffsets)
+	blockSize := 4 + 1 + 1 + offsetSize + ea.indexBlockEntries*uint64(ea.entrySize) +
+		(nDataBlockAddrs+nSuperBlockAddrs)*offsetSize
+	bf := h5.newSeek(addr, int64(blockSize)+4)
+	checkMagic(bf, 4, "EAIB")
+	version := read8(bf)
+	checkVal(0, version, "extensible array index block version")
+	checkVal(ea.clientID, read8(bf), "extensible array index block client")
+	checkVal(ea.addr, h5.readAddr(bf), "extensible array header address")
+	for i := uint64(0); i < ea.indexBlockEntries; i++ {
+		if i < ea.nEntries {
+			h5.readEntry(ea.ci, bf, i, ea.entrySize)
+		} else {
+			skip(bf, int64(ea.entrySize))
+		}
+	}
+	dataBlockAddrs := make([]uint64, nDataBlockAddrs)
+	for i := range dataBlockAddrs {
+		dataBlockAddrs[i] = h5.readAddr(bf)
+	}
+	superBlockAddrs := make([]uint64, nSuperBlockAddrs)
+	for i := range superBlockAddrs {
+		superBlockAddrs[i] = h5.readAddr(bf)
+	}
+	h5.checkChecksum(addr, int(blockSize))
+
+	for u, info := range ea.superBlocks {
+		if ea.indexBlockEntries+info.startIndex >= ea.nEntries {
+			break
+		}
+		if u < nIndexSuperBlocks {
+			for k := uint64(0); k < info.nDataBlocks; k++ {
+				h5.readEADataBlock(ea, dataBlockAddrs[info.startDataBlock+k], info, k, nil)
+			}
+			continue
+		}
+		h5.readEASuperBlock(ea, superBlockAddrs[u-nIndexSuperBlocks], info)
+	}
+}
+
+func (h5 *HDF5) readEASuperBlock(ea *extensibleArray, addr uint64, info eaSuperBlockInfo) {
+	if addr == invalidAddress {
+		logger.Info("extensible array super block not allocated")
+		return
+	}
+	nPages := uint64(0)
+	if info.dataBlockEntries > ea.pageEntries {
+		nPages = info.dataBlockEntries / ea.pageEntries
+	}
+	bitmapSize := info.nDataBlocks * ((nPages + 7) / 8)
+	offsetSize := uint64(h5.sizeOfOffsets)
+	blockSize := 4 + 1 + 1 + offsetSize + uint64(ea.arrayOffsetSize) + bitmapSize +
+		info.nDataBlocks*offsetSize
+	bf := h5.newSeek(addr, int64(blockSize)+4)
+	checkMagic(bf, 4, "EASB")
+	version := read8(bf)
+	checkVal(0, version, "extensible array super block version")
+	checkVal(ea.clientID, read8(bf), "extensible array super block client")
+	checkVal(ea.addr, h5.readAddr(bf), "extensible array header address")
+	offset := readUint(bf, ea.arrayOffsetSize)
+	logger.Info("super block offset", offset)
+	bitmap := make([]byte, bitmapSize)
+	read(bf, bitmap)
+	dataBlockAddrs := make([]uint64, info.nDataBlocks)
+	for i := range dataBlockAddrs {
+		dataBlockAddrs[i] = h5.readAddr(bf)
+	}
+	h5.checkChecksum(addr, int(blockSize))
+	for k, dataBlockAddr := range dataBlockAddrs {
+		if nPages > 0 {
+			// Page bits are in one bitmap for all the data blocks.
+			pageBits := make([]bool, nPages)
+			for p := range pageBits {
+				pageBits[p] = bitIsSet(bitmap, uint64(k)*nPages+uint64(p))
+			}
+			h5.readEADataBlock(ea, dataBlockAddr, info, uint64(k), pageBits)
+			continue
+		}
+		h5.readEADataBlock(ea, dataBlockAddr, info, uint64(k), nil)
+	}
+}
+
+// readEADataBlock reads data block k of a super block.  For paged data
+// blocks in super blocks, pageInit says which pages have been written.
+func (h5 *HDF5) readEADataBlock(ea *extensibleArray, addr uint64, info eaSuperBlockInfo,
+	k uint64, pageInit []bool) {
+	first := ea.indexBlockEntries + info.startIndex + k*info.dataBlockEntries
+	if first >= ea.nEntries {
+		return
+	}
+	if addr == invalidAddress {
+		logger.Info("extensible array data block not allocated")
+		return
+	}
+	n := info.dataBlockEntries
+	paged := n > ea.pageEntries
+	prefixSize := 4 + 1 + 1 + uint64(h5.sizeOfOffsets) + uint64(ea.arrayOffsetSize)
+	blockSize := prefixSize
+	if !paged {
+		blockSize += n * uint64(ea.entrySize)
+	}
+	bf := h5.newSeek(addr, int64(blockSize)+4)
+	checkMagic(bf, 4, "EADB")
+	version := read8(bf)
+	checkVal(0, version, "extensible array data block version")
+	checkVal(ea.clientID, read8(bf), "extensible array data block client")
+	checkVal(ea.addr, h5.readAddr(bf), "extensible array header address")
+	offset := readUint(bf, ea.arrayOffsetSize)
+	logger.Info("data block offset", offset)
+	if !paged {
+		for i := uint64(0); i < n && first+i < ea.nEntries; i++ {
+			h5.readEntry(ea.ci, bf, first+i, ea.entrySize)
+		}
+		h5.checkChecksum(addr, int(blockSize))
+		return
+	}
+	h5.checkChecksum(addr, int(blockSize))
+
+	// The pages follow the data block, each with its own checksum.
+	pageSize := ea.pageEntries*uint64(ea.entrySize) + 4
+	pageAddr := addr + blockSize + 4
+	nPages := n / ea.pageEntries
+	for p := uint64(0); p < nPages; p++ {
+		pageFirst := first + p*ea.pageEntries
+		if pageFirst >= ea.nEntries {
+			break
+		}
+		if pageInit == nil || pageInit[p] {
+			bf := h5.newSeek(pageAddr, int64(pageSize))
+			for i := uint64(0); i < ea.pageEntries && pageFirst+i < ea.nEntries; i++ {
+				h5.readEntry(ea.ci, bf, pageFirst+i, ea.entrySize)
+			}
+			h5.checkChecksum(pageAddr, int(pageSize-4))
+		} else {
+			logger.Info("extensible array page", p, "not initialized")
+		}
+		pageAddr += pageSize
+	}
+}
+
+// btree2 holds the parameters from a version 2 B-tree header that are needed
+// to read its nodes.
+type btree2 struct {
+	ty          uint8
+	recordSize  uint64
+	rootAddr    uint64
+	rootRecords uint64
+	depth       uint16
+	// Sizes of the number of records fields in child pointers.  nrecSize is
+	// for the number of records in the child, totalSize[d] is for the total
+	// number of records below a child at depth d.
+	nrecSize  int
+	totalSize []int
+	// readRecord reads one record, which is recordSize bytes.
+	readRecord func(bf io.Reader)
+}
+
+// readBTree2Header reads the header of the version 2 B-tree at addr.  The
+// caller checks the type and sets readRecord before reading the nodes.
+func (h5 *HDF5) readBTree2Header(addr uint64) *btree2 {
+	headerSize := 18 + int64(h5.sizeOfOffsets) + int64(h5.sizeOfLengths)
+	bf := h5.newSeek(addr, headerSize+4)
+	checkMagic(bf, 4, "BTHD")
+	version := read8(bf)
+	checkVal(0, version, "btree header version")
+	ty := read8(bf)
+	nodeSize := uint64(read32(bf))
+	recordSize := uint64(read16(bf))
+	depth := read16(bf)
+	splitPercent := read8(bf)
+	mergePercent := read8(bf)
+	rootAddr := h5.readAddr(bf)
+	rootRecords := read16(bf)
+	totalRecords := h5.readLength(bf)
+	logger.Infof("btree type=%d node size=%d record size=%d depth=%d split=%d merge=%d",
+		ty, nodeSize, recordSize, depth, splitPercent, mergePercent)
+	logger.Infof("btree root=0x%x root records=%d total records=%d",
+		rootAddr, rootRecords, totalRecords)
+	h5.checkChecksum(addr, int(headerSize))
+	assertError(recordSize > 0 && nodeSize > btree2PrefixSize+recordSize, ErrCorrupted,
+		"bad btree node or record size")
+	bt := &btree2{ty: ty, recordSize: recordSize, rootAddr: rootAddr,
+		rootRecords: uint64(rootRecords), depth: depth, totalSize: make([]int, depth+1)}
+	// Work out the sizes of the child pointer fields, which depend on the
+	// maximum number of records a node can hold at each depth.
+	maxRecords := (nodeSize - btree2PrefixSize) / recordSize
+	cumMaxRecords := maxRecords
+	bt.nrecSize = log2(maxRecords)/8 + 1
+	for d := 1; d <= int(depth); d++ {
+		pointerSize := uint64(int(h5.sizeOfOffsets) + bt.nrecSize)
+		if d > 1 {
+			pointerSize += uint64(bt.totalSize[d-1])
+		}
+		maxRecords = (nodeSize - (btree2PrefixSize + pointerSize)) / (recordSize + pointerSize)
+		cumMaxRecords = (maxRecords+1)*cumMaxRecords + maxRecords
+		bt.totalSize[d] = log2(cumMaxRecords)/8 + 1
+	}
+	return bt
+}
+
+// readBTree2 reads all the records in the tree, in order.
+func (h5 *HDF5) readBTree2(bt *btree2) {
+	if bt.rootAddr == invalidAddress {
+		logger.Info("btree is empty")
+		return
+	}
+	h5.readBTree2Node(bt, bt.rootAddr, bt.rootRecords, bt.depth)
+}
+
+func (h5 *HDF5) readBTree2Chunks(ci *chunkIndex, addr uint64) {
+	bt := h5.readBTree2Header(addr)
+	switch bt.ty {
+	case btreeChunks:
+		ci.filtered = false
+	case btreeFilteredChunks:
+		ci.filtered = true
+	default:
+		failError(ErrLayout, fmt.Sprint("unexpected btree type for chunks: ", bt.ty))
+	}
+	bt.readRecord = func(bf io.Reader) { h5.readBTree2ChunkRecord(ci, bt.recordSize, bf) }
+	h5.readBTree2(bt)
+}
+
+// readBTree2Node reads a node and its children in order.  For chunks, this
+// adds them in row-major order.
+func (h5 *HDF5) readBTree2Node(bt *btree2, addr uint64, nRecords uint64, depth uint16) {
+	pointerSize := uint64(0)
+	magic := "BTLF"
+	if depth > 0 {
+		magic = "BTIN"
+		pointerSize = uint64(int(h5.sizeOfOffsets) + bt.nrecSize)
+		if depth > 1 {
+			pointerSize += uint64(bt.totalSize[depth-1])
+		}
+	}
+	nodeSize := 4 + 1 + 1 + nRecords*bt.recordSize
+	if depth > 0 {
+		nodeSize += (nRecords + 1) * pointerSize
+	}
+	bf := h5.newSeek(addr, int64(nodeSize)+4)
+	checkMagic(bf, 4, magic)
+	version := read8(bf)
+	checkVal(0, version, "btree node version")
+	ty := read8(bf)
+	logger.Infof("btree node %s type=%d records=%d depth=%d", magic, ty, nRecords, depth)
+	records := make([]byte, nRecords*bt.recordSize)
+	read(bf, records)
+	type child struct {
+		addr     uint64
+		nRecords uint64
+	}
+	var children []child
+	if depth > 0 {
+		children = make([]child, nRecords+1)
+		for i := range children {
+			children[i].addr = h5.readAddr(bf)
+			children[i].nRecords = readUint(bf, bt.nrecSize)
+			if depth > 1 {
+				total := readUint(bf, bt.totalSize[depth-1])
+				logger.Info("child total records", total)
+			}
+		}
+	}
+	h5.checkChecksum(addr, int(nodeSize))
+
+	rf := newResetReaderFromBytes(records)
+	for i := uint64(0); i <= nRecords; i++ {
+		if depth > 0 {
+			h5.readBTree2Node(bt, children[i].addr, children[i].nRecords, depth-1)
+		}
+		if i < nRecords {
+			bt.readRecord(rf)
+		}
+	}
+}
+
+func (h5 *HDF5) readBTree2ChunkRecord(ci *chunkIndex, recordSize uint64, bf io.Reader) {
+	addr := h5.readAddr(bf)
+	size := ci.chunkSize()
+	filterMask := uint32(0)
+	if ci.filtered {
+		sizeLen := int(recordSize) - int(h5.sizeOfOffsets) - 4 - 8*len(ci.layout)
+		size = readUint(bf, sizeLen)
+		filterMask = read32(bf)
+	}
+	offsets := make([]uint64, len(ci.layout))
+	for d := range offsets {
+		offsets[d] = read64(bf) * ci.layout[d] // scaled
+	}
+	logger.Infof("chunk addr=0x%x size=%d mask=0x%x offsets=%v", addr, size, filterMask, offsets)
+	if addr == invalidAddress {
+		return
+	}
+	addChunk(ci.parent, addr, size, filterMask, offsets, ci.dtSize, ci.numberOfElements)
+}
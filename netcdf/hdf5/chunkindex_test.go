@@ -0,0 +1,332 @@
+package hdf5
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The HDF5 tools only write the v4 chunk indexes when asked for the latest
+// file format, which TestLatestFormat does.  The other tests build the index
+// structures by hand, to cover paging, unwritten chunks and the implicit
+// index, which the tools can't be made to write.
+
+// The tests use a 5x7 dataset of 2-byte elements, in 2x3 chunks.
+var (
+	indexDims   = []uint64{5, 7}
+	indexLayout = []uint64{2, 3}
+)
+
+const indexChunkSize = 2 * 2 * 3
+
+// layoutMessage returns a v4 layout message for the test dataset.
+func layoutMessage(flags uint8, indexType uint8, vals ...interface{}) []byte {
+	var b indexBuilder
+	b.put(4, int(classChunked), int(flags), len(indexLayout)+1, 4)
+	for _, l := range indexLayout {
+		b.put(uint32(l))
+	}
+	b.put(uint32(2), indexType)
+	b.put(vals...)
+	return b.buf.Bytes()
+}
+
+type chunkInfo struct {
+	addr    uint64
+	size    uint64
+	mask    uint32
+	offsets []uint64
+}
+
+func readIndex(b *indexBuilder, msg []byte) []chunkInfo {
+	file := b.buf.Bytes()
+	h5 := &HDF5{
+		file:          newRaFile(bytes.NewReader(file)),
+		fileSize:      int64(len(file)),
+		sizeOfOffsets: 8,
+		sizeOfLengths: 8,
+	}
+	obj := newObject()
+	obj.objAttr.dimensions = indexDims
+	h5.readDataLayout(obj, newResetReaderFromBytes(msg))
+	var chunks []chunkInfo
+	for _, db := range obj.dataBlocks {
+		chunks = append(chunks, chunkInfo{db.offset, db.length, db.filterMask, db.offsets})
+	}
+	return chunks
+}
+
+// chunkAddr is the fake address of a chunk.  The chunks are never read.
+func chunkAddr(i int) uint64 {
+	return uint64(0x10000 + i*0x100)
+}
+
+// entries returns the index entries for the chunks, with invalid addresses
+// for the ones not written.  If filtered, each chunk has a size and mask.
+func entries(n int, filtered bool, written ...int) []interface{} {
+	var vals []interface{}
+	for i := 0; i < n; i++ {
+		addr := uint64(invalidAddress)
+		for _, w := range written {
+			if w == i {
+				addr = chunkAddr(i)
+			}
+		}
+		vals = append(vals, addr)
+		if filtered {
+			vals = append(vals, uint32(i+1), uint32(i))
+		}
+	}
+	return vals
+}
+
+// expectChunks returns the chunks with the given row-major indexes.
+func expectChunks(filtered bool, indexes ...int) []chunkInfo {
+	var chunks []chunkInfo
+	for _, i := range indexes {
+		chunk := chunkInfo{
+			addr:    chunkAddr(i),
+			size:    indexChunkSize,
+			offsets: []uint64{uint64(i/3) * indexLayout[0], uint64(i%3) * indexLayout[1]},
+		}
+		if filtered {
+			chunk.size = uint64(i + 1)
+			chunk.mask = uint32(i)
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+func checkChunks(t *testing.T, name string, got []chunkInfo, exp []chunkInfo) {
+	t.Helper()
+	if !reflect.DeepEqual(got, exp) {
+		t.Error(name, "got", got, "exp", exp)
+	}
+}
+
+func TestSingleChunkIndex(t *testing.T) {
+	var b indexBuilder
+	dims := indexDims
+	indexDims = indexLayout
+	defer func() { indexDims = dims }()
+	got := readIndex(&b, layoutMessage(0, chunkIndexSingle, chunkAddr(0)))
+	exp := []chunkInfo{{chunkAddr(0), indexChunkSize, 0, []uint64{0, 0}}}
+	checkChunks(t, "single", got, exp)
+
+	got = readIndex(&b, layoutMessage(2, chunkIndexSingle, uint64(5), uint32(1),
+		chunkAddr(0)))
+	exp = []chunkInfo{{chunkAddr(0), 5, 1, []uint64{0, 0}}}
+	checkChunks(t, "filtered single", got, exp)
+}
+
+func TestImplicitIndex(t *testing.T) {
+	var b indexBuilder
+	got := readIndex(&b, layoutMessage(0, chunkIndexImplicit, uint64(0x10000)))
+	var exp []chunkInfo
+	for i := 0; i < 9; i++ {
+		exp = append(exp, chunkInfo{0x10000 + uint64(i)*indexChunkSize, indexChunkSize, 0,
+			[]uint64{uint64(i/3) * 2, uint64(i%3) * 3}})
+	}
+	checkChunks(t, "implicit", got, exp)
+}
+
+func TestFixedArrayIndex(t *testing.T) {
+	const headerSize = 28
+	// Unpaged, with one chunk not written
+	var b indexBuilder
+	b.put("padding!")
+	header := b.addr()
+	b.block("FAHD", 0, 0, 8, 10, uint64(9), header+headerSize)
+	b.block("FADB", 0, 0, header, entries(9, false, 0, 1, 2, 3, 5, 6, 7, 8))
+	got := readIndex(&b, layoutMessage(0, chunkIndexFixedArray, 10, header))
+	checkChunks(t, "unpaged", got, expectChunks(false, 0, 1, 2, 3, 5, 6, 7, 8))
+
+	// Paged with four entries per page, and the middle page not written
+	b = indexBuilder{}
+	b.block("FAHD", 0, 1, 16, 2, uint64(9), uint64(headerSize))
+	b.block("FADB", 0, 1, uint64(0), 0xa0)
+	b.block(entries(4, true, 0, 1, 2, 3))
+	b.block(make([]byte, 4*16))
+	b.block(entries(9, true, 8)[8*3:])
+	got = readIndex(&b, layoutMessage(0, chunkIndexFixedArray, 2, uint64(0)))
+	checkChunks(t, "paged", got, expectChunks(true, 0, 1, 2, 3, 8))
+}
+
+func TestUnfilteredEdgeChunks(t *testing.T) {
+	// Filtered, but the chunks in the last row and column go past the end of
+	// the dataset and so aren't.
+	const headerSize = 28
+	var b indexBuilder
+	b.block("FAHD", 0, 1, 16, 10, uint64(9), uint64(headerSize))
+	b.block("FADB", 0, 1, uint64(0), entries(9, true, 0, 1, 2, 3, 4, 5, 6, 7, 8))
+	got := readIndex(&b, layoutMessage(1, chunkIndexFixedArray, 10, uint64(0)))
+	exp := expectChunks(true, 0, 1, 2, 3, 4, 5, 6, 7, 8)
+	for i := range exp {
+		if i/3 == 2 || i%3 == 2 {
+			exp[i].mask = ^uint32(0)
+		}
+	}
+	checkChunks(t, "unfiltered edges", got, exp)
+}
+
+func TestExtensibleArrayIndex(t *testing.T) {
+	// Two entries in the index block, then data blocks of 2 and 4 entries
+	// whose addresses are in the index block, then a super block with two
+	// data blocks of 4 entries.
+	const (
+		headerSize     = 72
+		maxBits        = 32
+		nSuperBlocks   = 1 + maxBits - 1
+		indexBlockSize = 14 + 2*8 + 2*8 + (nSuperBlocks-2)*8 + 4
+		dataBlock0Size = 18 + 2*8 + 4
+		dataBlock1Size = 18 + 4*8 + 4
+		superBlockSize = 18 + 2*8 + 4
+	)
+	var b indexBuilder
+	indexBlock := uint64(headerSize)
+	dataBlock0 := indexBlock + indexBlockSize
+	dataBlock1 := dataBlock0 + dataBlock0Size
+	superBlock := dataBlock1 + dataBlock1Size
+	dataBlock2 := superBlock + superBlockSize
+	b.block("EAHD", 0, 0, 8, maxBits, 2, 2, 2, 10,
+		uint64(1), uint64(superBlockSize), uint64(3), uint64(0), uint64(9), uint64(9),
+		indexBlock)
+	superBlockAddrs := []interface{}{superBlock}
+	for i := 1; i < nSuperBlocks-2; i++ {
+		superBlockAddrs = append(superBlockAddrs, uint64(invalidAddress))
+	}
+	b.block("EAIB", 0, 0, uint64(0), entries(2, false, 0, 1), dataBlock0, dataBlock1,
+		superBlockAddrs)
+	b.block("EADB", 0, 0, uint64(0), uint32(2), entries(4, false, 0, 2, 3)[2:])
+	b.block("EADB", 0, 0, uint64(0), uint32(4), entries(8, false, 4, 5, 7)[4:])
+	b.block("EASB", 0, 0, uint64(0), uint32(8), dataBlock2, uint64(invalidAddress))
+	b.block("EADB", 0, 0, uint64(0), uint32(8), entries(12, false, 8)[8:])
+	got := readIndex(&b, layoutMessage(0, chunkIndexExtensibleArray, maxBits, 2, 2, 2, 10,
+		uint64(0)))
+	checkChunks(t, "extensible array", got, expectChunks(false, 0, 1, 2, 3, 4, 5, 7, 8))
+}
+
+func TestBTree2Index(t *testing.T) {
+	// A root node with one record and two leaves
+	const (
+		headerSize = 38
+		recordSize = 8 + 4 + 4 + 2*8
+		rootSize   = 6 + recordSize + 2*(8+1) + 4
+		leafSize   = 6 + 4*recordSize + 4
+	)
+	record := func(i int) []interface{} {
+		vals := entries(i+1, true, i)[3*i:]
+		return append(vals, uint64(i/3), uint64(i%3))
+	}
+	records := func(first, n int) []interface{} {
+		var vals []interface{}
+		for i := first; i < first+n; i++ {
+			vals = append(vals, record(i)...)
+		}
+		return vals
+	}
+	var b indexBuilder
+	root := uint64(headerSize)
+	leaf0 := root + rootSize
+	leaf1 := leaf0 + leafSize
+	b.block("BTHD", 0, btreeFilteredChunks, uint32(512), uint16(recordSize), uint16(1), 100,
+		40, root, uint16(1), uint64(9))
+	b.block("BTIN", 0, btreeFilteredChunks, record(4), leaf0, 4, leaf1, 4)
+	b.block("BTLF", 0, btreeFilteredChunks, records(0, 4))
+	b.block("BTLF", 0, btreeFilteredChunks, records(5, 4))
+	got := readIndex(&b, layoutMessage(0, chunkIndexBTree2, uint32(512), 100, 40,
+		uint64(0)))
+	checkChunks(t, "btree", got, expectChunks(true, 0, 1, 2, 3, 4, 5, 6, 7, 8))
+}
+
+// h5repack writes a version 3 superblock, version 4 datatypes and v4 layouts
+// when asked for the latest file format.  The chunk index it uses depends on
+// the chunking and the maximum dimensions.
+func TestLatestFormat(t *testing.T) {
+	for _, test := range []struct {
+		fileNameNoExt string
+		args          []string
+		varName       string
+		indexType     uint8
+	}{
+		{"testlayout", []string{"-l", "a:CHUNK=20x20"}, "a", chunkIndexSingle},
+		{"testlayout", []string{"-l", "a:CHUNK=7x6"}, "a", chunkIndexFixedArray},
+		{"testlayout", []string{"-l", "a:CHUNK=7x6", "-f", "a:GZIP=1"}, "a",
+			chunkIndexFixedArray},
+		{"testunlimited", nil, "i8x1", chunkIndexExtensibleArray},
+		{"testunlimited2", nil, "a", chunkIndexBTree2},
+	} {
+		name := test.fileNameNoExt + " " + strings.Join(test.args, " ")
+		genName := ncGen(t, test.fileNameNoExt)
+		if genName == "" {
+			t.Error(errorNcGen)
+			continue
+		}
+		latestName := "testdata/" + test.fileNameNoExt + "_latest.nc"
+		cmdString := append([]string{"--latest"}, test.args...)
+		cmdString = append(cmdString, genName, latestName)
+		err := exec.Command("h5repack", cmdString...).Run()
+		if err != nil {
+			t.Error("h5repack", strings.Join(cmdString, " "), ":", err)
+			os.Remove(genName)
+			continue
+		}
+		checkLatest(t, name, genName, latestName, test.varName, test.indexType)
+		os.Remove(genName)
+		os.Remove(latestName)
+	}
+}
+
+// checkLatest checks that the file in the latest format has the same values
+// as the original, and that the variable uses the chunk index.
+func checkLatest(t *testing.T, name string, genName string, latestName string,
+	varName string, indexType uint8) {
+	t.Helper()
+	b, err := os.ReadFile(latestName)
+	if err != nil {
+		t.Error(name, err)
+		return
+	}
+	if len(b) < 9 || b[8] != 3 {
+		t.Error(name, "not a version 3 superblock")
+	}
+	nc, err := Open(genName)
+	if err != nil {
+		t.Error(name, err)
+		return
+	}
+	defer nc.Close()
+	lnc, err := Open(latestName)
+	if err != nil {
+		t.Error(name, err)
+		return
+	}
+	defer lnc.Close()
+	obj := lnc.(*HDF5).findVariable(varName)
+	if obj == nil {
+		t.Error(name, varName, "not found")
+		return
+	}
+	if obj.indexType != indexType {
+		t.Error(name, "got index type", obj.indexType, "exp", indexType)
+	}
+	for _, v := range nc.ListVariables() {
+		exp, err := nc.GetVariable(v)
+		if err != nil {
+			t.Error(name, v, err)
+			continue
+		}
+		got, err := lnc.GetVariable(v)
+		if err != nil {
+			t.Error(name, v, err)
+			continue
+		}
+		if !reflect.DeepEqual(got.Values, exp.Values) {
+			t.Error(name, v, "got", got.Values, "exp", exp.Values)
+		}
+	}
+}
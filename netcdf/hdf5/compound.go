@@ -17,6 +17,17 @@ type compoundField struct {
 }
 type compound []compoundField
 
+// Member returns the value of the named member of the compound, so that
+// netcdf.Unmarshal can fill structs from compounds.
+func (c compound) Member(name string) (interface{}, bool) {
+	for _, f := range c {
+		if f.Name == name {
+			return f.Val, true
+		}
+	}
+	return nil, false
+}
+
 var (
 	compoundManager             = compoundManagerType{}
 	_               typeManager = compoundManager
@@ -66,7 +77,7 @@ func (compoundManagerType) defaultFillValue(obj *object, objFillValue []byte, un
 func (compoundManagerType) parse(hr heapReader, c caster, attr *attribute, bitFields uint32, bf remReader, df remReader) {
 	logger.Info("* compound")
 	logger.Info("attr.dtversion", attr.dtversion)
-	assert(attr.dtversion >= 1 && attr.dtversion <= maxDTVersion,
+	assert(attr.dtversion >= 1 && attr.dtversion <= dtversionV4,
 		fmt.Sprintln("compound datatype version", attr.dtversion, "not supported"))
 	nmembers := bitFields & 0b11111111
 	logger.Info("* number of members:", nmembers)
@@ -27,15 +27,24 @@ var (
 	// ErrLinkType is returned for an unrecognized or unsupported link type
 	ErrLinkType = errors.New("link type not supported")
 
-	// ErrVirtualStorage is returned when the unsupported virtual storage feature is encountered
-	ErrVirtualStorage = errors.New("virtual storage not supported")
+	// ErrLinkCycle is returned when following links leads back to the same link,
+	// or there are too many nested links
+	ErrLinkCycle = errors.New("link cycle or too many nested links")
+
+	// ErrVirtualStorage is returned when a virtual dataset uses an unsupported feature,
+	// such as unlimited mappings
+	ErrVirtualStorage = errors.New("virtual storage feature not supported")
 
 	// ErrTruncated is returned when the file has fewer bytes than the superblock says
 	ErrTruncated = errors.New("file is too small, may be truncated")
 
-	// ErrOffsetSize is returned when offsets other than 64-bit are indicated.
-	// Only 64-bit is supported in this implementation.
-	ErrOffsetSize = errors.New("only 64-bit offsets are supported")
+	// ErrOffsetSize is returned when the superblock indicates offsets or lengths
+	// other than 16, 32 or 64-bit.
+	ErrOffsetSize = errors.New("only 16, 32 and 64-bit offsets and lengths are supported")
+
+	// ErrDriver is returned for files written by a driver that keeps the data
+	// in other files, such as the multi and family drivers.
+	ErrDriver = errors.New("file driver not supported")
 
 	// ErrDimensionality is returned when invalid dimensions are specified
 	ErrDimensionality = errors.New("invalid dimensionality")
@@ -49,21 +58,27 @@ var (
 	// ErrLayout is returned for unsupported data layouts
 	ErrLayout = errors.New("data layout version not supported")
 
-	// ErrSuperblock is returned for unsupported superblock versions
+	// ErrSuperblock was returned when a superblock extension was encountered.
+	//
+	// Deprecated: superblock extensions are supported now, so this is no longer returned.
 	ErrSuperblock = errors.New("superblock extension not supported")
 
 	// ErrBitfield is returned when bitfields are encountered.
-	// Bitfields are valid HDF5, but not valid NetCDF4.
+	// Bitfields are valid HDF5, but not valid NetCDF4, and are only read
+	// after calling SetNonNetCDFTypes.
 	ErrBitfield = errors.New("bitfields not supported")
 
-	// ErrExternal is returned when requests for external files are encountered, which is
-	// not supported.
+	// ErrExternal was returned when external data files were encountered.
+	//
+	// Deprecated: external data files are supported now, so this is no longer returned.
 	ErrExternal = errors.New("external data files not supported")
 
-	// ErrFloatingPoint is returned when non-standard floating point is encountered
+	// ErrFloatingPoint is returned when floating point that can't be decoded is
+	// encountered, such as one whose fields don't fit in it.
 	ErrFloatingPoint = errors.New("non-standard floating point not handled")
 
-	// ErrFloatingPointis returned when non-standard integers are encountered
+	// ErrFixedPoint is returned when integers that can't be decoded are
+	// encountered, such as ones larger than 8 bytes.
 	ErrFixedPoint = errors.New("non-standard fixed-point not handled")
 
 	// ErrReference is returned when references are encountered.
@@ -71,6 +86,27 @@ var (
 	ErrReference = errors.New("unsupported reference type")
 
 	// ErrNonExportedField is returned when a value cannot be assigned to user-supplied
-	// struct because it has non-exported fields.
+	// struct because it has non-exported fields.  netcdf.Unmarshal returns errors
+	// wrapping it for tagged fields that are not exported.
 	ErrNonExportedField = errors.New("can't assign to non-exported field")
 )
+
+// Errors returned by the writer
+var (
+	// ErrInvalidName is returned when a name is not a valid NetCDF name, or is
+	// already in use.
+	ErrInvalidName = errors.New("invalid name")
+
+	// ErrDimensionSize is returned when a dimension doesn't match the size of the data
+	ErrDimensionSize = errors.New("dimension doesn't match size")
+
+	// ErrAttribute is returned when an attribute cannot be written
+	ErrAttribute = errors.New("invalid attribute")
+
+	// ErrEmptySlice is returned when the size of a dimension can't be determined
+	// because of an empty slice.
+	ErrEmptySlice = errors.New("empty slice encountered")
+
+	// ErrUnknownType is returned when a Go type cannot be written out
+	ErrUnknownType = errors.New("unknown type")
+)
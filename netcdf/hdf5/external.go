@@ -0,0 +1,177 @@
+package hdf5
+
+// External data files.
+//
+// The raw data of a contiguous dataset can be stored in other files instead
+// of in the HDF5 file.  The External Data Files message lists the pieces of
+// the data in order: each one is a file name, stored in a local heap, and
+// the offset and size of the data in that file.  Reading past the end of an
+// external file gives zeros, the same as the HDF5 library.
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/batchatco/go-native-netcdf/netcdf/api"
+	"github.com/batchatco/go-thrower"
+)
+
+// The size of the last piece of external data can be unlimited.
+const externalUnlimited = invalidAddress
+
+// ExternalOpener opens a file that an HDF5 file refers to.  The path is the
+// name of the referring HDF5 file, or empty if it isn't known, such as when
+// it was opened with New from something other than an *os.File.  The name
+// is the one stored in the referring file.
+type ExternalOpener func(path string, name string) (api.ReadSeekerCloser, error)
+
+// openers are the functions set to open the files an HDF5 file refers to.
+// They are shared by all the groups of the file.
+type openers struct {
+	lock     sync.RWMutex
+	external ExternalOpener
+	link     ExternalOpener
+}
+
+// SetExternalOpener sets the function used to open the external data files
+// of the datasets in this file.  By default, names that aren't absolute are
+// looked up relative to the directory of the HDF5 file, and then relative to
+// the current directory.  Setting it to nil restores the default.
+func (h5 *HDF5) SetExternalOpener(opener ExternalOpener) {
+	h5.openers.lock.Lock()
+	defer h5.openers.lock.Unlock()
+	h5.openers.external = opener
+}
+
+func (h5 *HDF5) getExternalOpener() ExternalOpener {
+	if h5.openers == nil {
+		return nil
+	}
+	h5.openers.lock.RLock()
+	defer h5.openers.lock.RUnlock()
+	return h5.openers.external
+}
+
+type externalFile struct {
+	name     string
+	offset   uint64 // offset of the data in the file
+	size     uint64 // size of the data in the file
+	dsOffset uint64 // byte offset in dataset
+}
+
+// readExternalFileList reads an External Data Files message.
+func (h5 *HDF5) readExternalFileList(obj *object, bf io.Reader) {
+	version := read8(bf)
+	checkVal(1, version, "external data files version")
+	checkZeroes(bf, 3)
+	allocated := read16(bf)
+	used := read16(bf)
+	heapAddr := h5.readAddr(bf)
+	logger.Infof("external files allocated=%d used=%d heap=0x%x", allocated, used, heapAddr)
+	assertError(used <= allocated, ErrCorrupted, "more external files used than allocated")
+	dsOffset := uint64(0)
+	for i := uint16(0); i < used; i++ {
+		nameOffset := h5.readLength(bf)
+		offset := h5.readLength(bf)
+		size := h5.readUnlimitedLength(bf)
+		assertError(dsOffset != externalUnlimited, ErrCorrupted,
+			"only the last external file can be unlimited")
+		name := h5.readLocalHeap(heapAddr, nameOffset)
+		logger.Infof("external file %s offset=%d size=%d", name, offset, size)
+		obj.external = append(obj.external, externalFile{name, offset, size, dsOffset})
+		if size == externalUnlimited {
+			dsOffset = externalUnlimited
+		} else {
+			dsOffset += size
+		}
+	}
+}
+
+// externalFiles keeps the external files opened while reading a dataset.
+type externalFiles struct {
+	h5    *HDF5
+	files map[string]api.ReadSeekerCloser
+}
+
+func (h5 *HDF5) newExternalFiles() *externalFiles {
+	return &externalFiles{h5, make(map[string]api.ReadSeekerCloser)}
+}
+
+func (ef *externalFiles) close() {
+	for _, f := range ef.files {
+		f.Close()
+	}
+}
+
+func (ef *externalFiles) open(name string) api.ReadSeekerCloser {
+	if f, has := ef.files[name]; has {
+		return f
+	}
+	var f api.ReadSeekerCloser
+	var err error
+	if opener := ef.h5.getExternalOpener(); opener != nil {
+		f, err = opener(ef.h5.fname, name)
+	} else {
+		f, err = ef.h5.openExternal(name)
+	}
+	if err != nil {
+		logger.Error("can't open external file", name, err)
+		thrower.Throw(err)
+	}
+	ef.files[name] = f
+	return f
+}
+
+func (h5 *HDF5) openExternal(name string) (api.ReadSeekerCloser, error) {
+	if !filepath.IsAbs(name) && h5.fname != "" {
+		f, err := os.Open(filepath.Join(filepath.Dir(h5.fname), name))
+		if err == nil {
+			return f, nil
+		}
+	}
+	return os.Open(name)
+}
+
+// read reads the bytes of the object's data at the given offset into b.
+func (ef *externalFiles) read(obj *object, offset uint64, b []byte) {
+	end := offset + uint64(len(b))
+	for _, ext := range obj.external {
+		first := ext.dsOffset
+		if first < offset {
+			first = offset
+		}
+		last := end
+		if ext.size != externalUnlimited && ext.dsOffset+ext.size < last {
+			last = ext.dsOffset + ext.size
+		}
+		if first >= last {
+			continue
+		}
+		dst := b[first-offset : last-offset]
+		f := ef.open(ext.name)
+		_, err := f.Seek(int64(ext.offset+first-ext.dsOffset), io.SeekStart)
+		thrower.ThrowIfError(err)
+		n, err := io.ReadFull(f, dst)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			logger.Infof("external file %s is short by %d bytes", ext.name, len(dst)-n)
+			for i := n; i < len(dst); i++ {
+				dst[i] = 0
+			}
+			err = nil
+		}
+		thrower.ThrowIfError(err)
+	}
+}
+
+// newExternalReader returns a reader of size bytes of the object's data,
+// starting at offset.
+func (h5 *HDF5) newExternalReader(obj *object, offset uint64, size uint64) remReader {
+	buf := make([]byte, size)
+	read(makeFillValueReader(obj, nil, int64(size)), buf)
+	ef := h5.newExternalFiles()
+	defer ef.close()
+	ef.read(obj, offset, buf)
+	return newResetReaderFromBytes(buf)
+}
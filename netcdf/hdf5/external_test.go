@@ -0,0 +1,157 @@
+package hdf5
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/batchatco/go-native-netcdf/netcdf/api"
+	"github.com/batchatco/go-thrower"
+)
+
+// externalList returns a local heap with the names, and an External Data
+// Files message using it.  Each slot is a name, offset and size.
+func externalList(b *indexBuilder, slots ...interface{}) []byte {
+	var names indexBuilder
+	var offsets []uint64
+	for i := 0; i < len(slots); i += 3 {
+		offsets = append(offsets, names.addr())
+		names.put(slots[i].(string), 0)
+	}
+	heap := b.addr()
+	b.put("HEAP", 0, 0, 0, 0, uint64(names.buf.Len()), uint64(invalidAddress), heap+32)
+	b.put(names.buf.Bytes())
+	var msg indexBuilder
+	msg.put(1, 0, 0, 0, uint16(len(offsets)+1), uint16(len(offsets)), heap)
+	for i, off := range offsets {
+		msg.put(off, slots[3*i+1], slots[3*i+2])
+	}
+	return msg.buf.Bytes()
+}
+
+// readExternal makes a 2x3 dataset of the type in testdata/vdsday1.nc, with
+// its data in the external files.
+func readExternal(t *testing.T, slots ...interface{}) (h5 *HDF5, obj *object, err error) {
+	t.Helper()
+	defer thrower.RecoverError(&err)
+	nc, err := Open("testdata/vdsday1.nc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	src := nc.(*HDF5).rootObject.children["temp"]
+	var b indexBuilder
+	msg := externalList(&b, slots...)
+	file := b.buf.Bytes()
+	h5 = &HDF5{
+		fname:         "testdata/external.h5",
+		file:          newRaFile(bytes.NewReader(file)),
+		fileSize:      int64(len(file)),
+		sizeOfOffsets: 8,
+		sizeOfLengths: 8,
+	}
+	obj = newObject()
+	attr := *src.objAttr
+	obj.objAttr = &attr
+	h5.readExternalFileList(obj, newResetReaderFromBytes(msg))
+	return h5, obj, nil
+}
+
+func int32Bytes(vals ...int32) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, vals)
+	return buf.Bytes()
+}
+
+type nopCloser struct {
+	*bytes.Reader
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+func TestExternalFiles(t *testing.T) {
+	day1 := "testdata/vdsday1.nc"
+	ext1 := "testdata/external1.raw"
+	ext2 := "testdata/external2.raw"
+	defer os.Remove(day1)
+	defer os.Remove(ext1)
+	defer os.Remove(ext2)
+	writeVdsSource(t, day1, [][]int32{{0, 0, 0}, {0, 0, 0}})
+	// The first file has a header, and the second one is missing its last
+	// value, which reads as zero.
+	err := ioutil.WriteFile(ext1, append([]byte("header!!"), int32Bytes(0, 1, 2)...), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(ext2, int32Bytes(3, 4), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h5, obj, err := readExternal(t, "external1.raw", uint64(8), uint64(12),
+		"external2.raw", uint64(0), uint64(externalUnlimited))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := [][]int32{{0, 1, 2}, {3, 4, 0}}
+	got := h5.getData(obj)
+	if !reflect.DeepEqual(got, exp) {
+		t.Error("got", got, "exp", exp)
+	}
+	slice, err := h5.getHyperslab(obj, []int64{0, 1}, []int64{2, 2}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expSlice := [][]int32{{1, 2}, {4, 0}}
+	if !reflect.DeepEqual(slice, expSlice) {
+		t.Error("got", slice, "exp", expSlice)
+	}
+	obj.objAttr.isSlice = true
+	obj.objAttr.firstDim = 1
+	obj.objAttr.lastDim = 2
+	got = h5.getData(obj)
+	if !reflect.DeepEqual(got, exp[1:]) {
+		t.Error("got", got, "exp", exp[1:])
+	}
+
+	// A user-supplied opener
+	var opened []string
+	h5.openers = &openers{}
+	h5.SetExternalOpener(func(path string, name string) (api.ReadSeekerCloser, error) {
+		if path != "testdata/external.h5" {
+			t.Error("referring path", path)
+		}
+		opened = append(opened, name)
+		return nopCloser{bytes.NewReader(int32Bytes(0, 0, 7, 8, 9))}, nil
+	})
+	obj.objAttr.isSlice = false
+	got = h5.getData(obj)
+	exp = [][]int32{{7, 8, 9}, {0, 0, 7}}
+	if !reflect.DeepEqual(got, exp) {
+		t.Error("got", got, "exp", exp)
+	}
+	if !reflect.DeepEqual(opened, []string{"external1.raw", "external2.raw"}) {
+		t.Error("opened", opened)
+	}
+}
+
+func TestExternalFileMissing(t *testing.T) {
+	day1 := "testdata/vdsday1.nc"
+	defer os.Remove(day1)
+	writeVdsSource(t, day1, [][]int32{{0, 0, 0}, {0, 0, 0}})
+	h5, obj, err := readExternal(t, "missing.raw", uint64(0), uint64(24))
+	if err != nil {
+		t.Fatal(err)
+	}
+	func() {
+		defer thrower.RecoverError(&err)
+		h5.getData(obj)
+	}()
+	if !os.IsNotExist(err) {
+		t.Error("expected not exist, got", err)
+	}
+}
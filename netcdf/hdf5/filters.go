@@ -0,0 +1,253 @@
+package hdf5
+
+import (
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/batchatco/go-thrower"
+)
+
+// FilterFunc decodes the data of one chunk that was encoded by an HDF5 filter.
+// The params are the filter's client data values from the file, and r reads
+// the encoded data.  It returns a reader of the decoded data.
+type FilterFunc func(params []uint32, r io.Reader) (io.Reader, error)
+
+var (
+	filterLock     sync.RWMutex
+	filterRegistry = map[uint16]FilterFunc{}
+)
+
+func init() {
+	RegisterFilter(filterDeflate, deflateFilter)
+	RegisterFilter(filterShuffle, shuffleFilter)
+	RegisterFilter(filterFletcher32, fletcher32Filter)
+	RegisterFilter(filterSzip, szipFilter)
+	RegisterFilter(filterNbit, nbitFilter)
+	RegisterFilter(filterScaleOffset, scaleOffsetFilter)
+}
+
+// RegisterFilter registers a decoder for the HDF5 filter with the given
+// identification number, replacing any previous one.  The built-in deflate,
+// shuffle, fletcher32, SZIP, N-Bit and Scale-Offset decoders can be replaced too.
+// Registering a nil function removes the decoder.
+//
+// When a chunk is read, the filters in its pipeline are undone in the
+// reverse of the order they were applied in when writing.
+func RegisterFilter(id uint16, f FilterFunc) {
+	filterLock.Lock()
+	defer filterLock.Unlock()
+	if f == nil {
+		delete(filterRegistry, id)
+		return
+	}
+	filterRegistry[id] = f
+}
+
+func getFilter(id uint16) FilterFunc {
+	filterLock.RLock()
+	defer filterLock.RUnlock()
+	return filterRegistry[id]
+}
+
+// applyFilters undoes the object's filters on the data read by bf.  Filters
+// whose bit is set in filterMask were skipped when the data was written.
+// It returns false if no filter was applied.
+func applyFilters(obj *object, filterMask uint32, bf io.Reader) (io.Reader, bool) {
+	applied := false
+	for i := len(obj.filters) - 1; i >= 0; i-- {
+		if i < 32 && filterMask&(1<<uint(i)) != 0 {
+			logger.Info("filter", i, "skipped")
+			continue
+		}
+		fl := obj.filters[i]
+		f := getFilter(fl.kind)
+		if f == nil {
+			failError(ErrUnsupportedFilter, fmt.Sprint("no decoder for filter ", fl.kind))
+		}
+		logger.Info("applying filter", fl.kind, "params", fl.cdv)
+		var err error
+		bf, err = f(fl.cdv, bf)
+		thrower.ThrowIfError(err)
+		applied = true
+	}
+	return bf, applied
+}
+
+// sizedReader returns a reader that knows how many bytes remain, reading
+// all of r into memory if necessary.
+func sizedReader(r io.Reader) remReader {
+	if rr, ok := r.(remReader); ok {
+		return rr
+	}
+	b, err := ioutil.ReadAll(r)
+	thrower.ThrowIfError(err)
+	return newResetReaderFromBytes(b)
+}
+
+func deflateFilter(params []uint32, r io.Reader) (io.Reader, error) {
+	if len(params) > 0 {
+		logger.Info("zlib param", params[0])
+	}
+	zbf, err := zlib.NewReader(r)
+	if err != nil {
+		logger.Error("unknown compression:", err)
+		return nil, ErrUnknownCompression
+	}
+	return zbf, nil
+}
+
+func shuffleFilter(params []uint32, r io.Reader) (io.Reader, error) {
+	if len(params) != 1 {
+		logger.Error("expected one shuffle param, got", len(params))
+		return nil, ErrCorrupted
+	}
+	bf := sizedReader(r)
+	return newUnshuffleReader(bf, uint64(bf.Rem()), params[0]), nil
+}
+
+func fletcher32Filter(params []uint32, r io.Reader) (io.Reader, error) {
+	bf := sizedReader(r)
+	return newFletcher32Reader(bf, uint64(bf.Rem())), nil
+}
+
+// N-Bit parameters are the number of parameters, whether the data was left
+// uncompressed, the number of elements and then the datatype.  A datatype is
+// its class and size, followed by:
+//
+//	atomic:    byte order, precision and bit offset
+//	array:     the base datatype
+//	compound:  the number of members, then each member's offset and datatype
+//	no-op:     nothing, the data is stored as is
+func nbitFilter(params []uint32, r io.Reader) (io.Reader, error) {
+	if len(params) < 5 || params[0] != uint32(len(params)) {
+		logger.Error("bad n-bit params", params)
+		return nil, ErrCorrupted
+	}
+	if params[1] != 0 {
+		logger.Info("n-bit data not compressed")
+		return r, nil
+	}
+	i := 3
+	typ := parseNbitType(params, &i)
+	return newNbitReader(r, typ, uint64(params[2])), nil
+}
+
+func parseNbitType(params []uint32, i *int) *nbitType {
+	next := func() uint32 {
+		assertError(*i < len(params), ErrCorrupted, "too few n-bit params")
+		v := params[*i]
+		*i++
+		return v
+	}
+	t := &nbitType{class: next(), size: next()}
+	switch t.class {
+	case nbitAtomic:
+		t.order = next()
+		t.precision = next()
+		t.offset = next()
+		assertError(t.precision > 0 && t.precision+t.offset <= t.size*8, ErrCorrupted,
+			fmt.Sprintf("bad n-bit precision %d and offset %d for size %d",
+				t.precision, t.offset, t.size))
+	case nbitArray:
+		t.base = parseNbitType(params, i)
+		assertError(t.base.size > 0 && t.size%t.base.size == 0, ErrCorrupted,
+			"bad n-bit array size")
+	case nbitCompound:
+		nMembers := next()
+		for m := uint32(0); m < nMembers; m++ {
+			member := nbitMember{offset: next(), typ: parseNbitType(params, i)}
+			assertError(member.offset+member.typ.size <= t.size, ErrCorrupted,
+				"n-bit compound member is out of bounds")
+			t.members = append(t.members, member)
+		}
+	case nbitNoOpType:
+		break
+	default:
+		failError(ErrCorrupted, fmt.Sprint("bad n-bit class: ", t.class))
+	}
+	return t
+}
+
+// Scale-Offset scale types
+const (
+	scaleFloatDScale = iota // decimal scale factor
+	scaleFloatEScale        // not supported by HDF5 either
+	scaleInt
+)
+
+// Size of the minimum bits and minimum value stored before the data.
+const scaleOffsetHeaderSize = 21
+
+// Scale-Offset parameters are the scale type, scale factor, number of
+// elements, datatype class (0 for integer, 1 for float), size, sign, byte
+// order, whether there is a fill value and then the fill value's bytes.
+//
+// Each chunk starts with the number of bits per value and the minimum value.
+// The values are stored as offsets from the minimum, with floats first scaled
+// by a power of ten and rounded.  If there is a fill value, the largest
+// offset stands for it.
+func scaleOffsetFilter(params []uint32, r io.Reader) (io.Reader, error) {
+	if len(params) < 8 {
+		logger.Error("bad scale-offset params", params)
+		return nil, ErrCorrupted
+	}
+	scaleType := params[0]
+	nElements := uint64(params[2])
+	so := &scaleOffset{
+		float: params[3] == 1,
+		size:  params[4],
+		order: binary.LittleEndian,
+		scale: int32(params[1]),
+	}
+	if params[6] == filterOrderBE {
+		so.order = binary.BigEndian
+	}
+	switch {
+	case so.float && scaleType != scaleFloatDScale:
+		logger.Error("unsupported scale-offset scale type", scaleType)
+		return nil, ErrUnsupportedFilter
+	case so.float && so.size != 4 && so.size != 8,
+		!so.float && so.size != 1 && so.size != 2 && so.size != 4 && so.size != 8:
+		logger.Error("bad scale-offset datatype size", so.size)
+		return nil, ErrCorrupted
+	}
+	if params[7] != 0 {
+		// The fill value's bytes are packed into the remaining parameters.
+		fill := make([]byte, 4*len(params[8:]))
+		for i, p := range params[8:] {
+			binary.LittleEndian.PutUint32(fill[4*i:], p)
+		}
+		if len(fill) < int(so.size) {
+			logger.Error("scale-offset fill value is too short")
+			return nil, ErrCorrupted
+		}
+		so.fillValue = fill[:so.size]
+	}
+	header := make([]byte, scaleOffsetHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	minBits := binary.LittleEndian.Uint32(header)
+	minValSize := int(header[4])
+	if minValSize > 8 {
+		minValSize = 8
+	}
+	for i := minValSize - 1; i >= 0; i-- {
+		so.minVal = so.minVal<<8 | uint64(header[5+i])
+	}
+	logger.Infof("scale-offset min bits=%d min val=0x%x", minBits, so.minVal)
+	switch {
+	case minBits > so.size*8:
+		logger.Error("bad scale-offset min bits", minBits)
+		return nil, ErrCorrupted
+	case minBits == so.size*8:
+		// Stored as is
+		return r, nil
+	}
+	so.minBits = uint(minBits)
+	return newScaleOffsetReader(r, so, nElements), nil
+}
@@ -0,0 +1,337 @@
+package hdf5
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/batchatco/go-thrower"
+)
+
+// blockData reads a data block, filtered by the pipeline, from file.
+func blockData(file []byte, filters []filter, filterMask uint32, dsLength uint64) (b []byte, err error) {
+	defer thrower.RecoverError(&err)
+	h5 := &HDF5{
+		file:          newRaFile(bytes.NewReader(file)),
+		fileSize:      int64(len(file)),
+		sizeOfOffsets: 8,
+		sizeOfLengths: 8,
+	}
+	obj := newObject()
+	obj.filters = filters
+	val := dataBlock{
+		offset:     0,
+		length:     uint64(len(file)),
+		dsLength:   dsLength,
+		filterMask: filterMask,
+	}
+	bf, _ := h5.newBlockReader(obj, val)
+	return ioutil.ReadAll(bf)
+}
+
+func shuffle(b []byte, n int) []byte {
+	ret := make([]byte, len(b))
+	nelems := len(b) / n
+	for i := 0; i < nelems; i++ {
+		for j := 0; j < n; j++ {
+			ret[j*nelems+i] = b[i*n+j]
+		}
+	}
+	return ret
+}
+
+func deflate(b []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(b)
+	w.Close()
+	return buf.Bytes()
+}
+
+func addFletcher32(b []byte) []byte {
+	values := make([]uint16, (len(b)+1)/2)
+	for i := range values {
+		values[i] = uint16(b[2*i]) << 8
+		if 2*i+1 < len(b) {
+			values[i] |= uint16(b[2*i+1])
+		}
+	}
+	sum := make([]byte, 4)
+	binary.LittleEndian.PutUint32(sum, fletcher32(values))
+	return append(append([]byte{}, b...), sum...)
+}
+
+// The inverse of the filter registered in TestRegisterFilter
+func xor(b []byte, key byte) []byte {
+	ret := make([]byte, len(b))
+	for i := range b {
+		ret[i] = b[i] ^ key
+	}
+	return ret
+}
+
+func TestBuiltinFilters(t *testing.T) {
+	data := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}
+	// Filters are applied in the order of the pipeline when writing.
+	pipeline := []filter{
+		{filterShuffle, []uint32{4}},
+		{filterDeflate, []uint32{6}},
+		{filterFletcher32, nil},
+	}
+	file := addFletcher32(deflate(shuffle(data, 4)))
+	got, err := blockData(file, pipeline, 0, uint64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, data) {
+		t.Error("got", got, "exp", data)
+	}
+
+	// Skip the deflate filter
+	file = addFletcher32(shuffle(data, 4))
+	got, err = blockData(file, pipeline, 0b10, uint64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, data) {
+		t.Error("got", got, "exp", data)
+	}
+
+	file[0]++
+	_, err = blockData(file, pipeline, 0b10, uint64(len(data)))
+	if err != ErrFletcherChecksum {
+		t.Error("expected checksum failure, got", err)
+	}
+}
+
+func TestRegisterFilter(t *testing.T) {
+	const filterXor = 32000
+	data := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}
+	pipeline := []filter{
+		{filterXor, []uint32{0x55}},
+		{filterDeflate, nil},
+	}
+	file := deflate(xor(data, 0x55))
+	_, err := blockData(file, pipeline, 0, uint64(len(data)))
+	if err != ErrUnsupportedFilter {
+		t.Error("expected unsupported filter, got", err)
+	}
+
+	RegisterFilter(filterXor, func(params []uint32, r io.Reader) (io.Reader, error) {
+		if len(params) != 1 {
+			return nil, errors.New("bad params")
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(xor(b, byte(params[0]))), nil
+	})
+	defer RegisterFilter(filterXor, nil)
+	got, err := blockData(file, pipeline, 0, uint64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, data) {
+		t.Error("got", got, "exp", data)
+	}
+
+	// Errors from the filter are returned
+	pipeline[0].cdv = nil
+	_, err = blockData(file, pipeline, 0, uint64(len(data)))
+	if err == nil || err.Error() != "bad params" {
+		t.Error("expected bad params, got", err)
+	}
+}
+
+// bitWriter packs bits most significant bit first, like the N-Bit and
+// Scale-Offset filters do.
+type bitWriter struct {
+	b    []byte
+	used uint // bits used in the last byte
+}
+
+func (bw *bitWriter) writeBits(v uint64, n uint) {
+	for i := int(n) - 1; i >= 0; i-- {
+		if bw.used%8 == 0 {
+			bw.b = append(bw.b, 0)
+			bw.used = 0
+		}
+		if v&(1<<uint(i)) != 0 {
+			bw.b[len(bw.b)-1] |= 0x80 >> bw.used
+		}
+		bw.used++
+	}
+}
+
+func filterData(id uint16, params []uint32, in []byte) (b []byte, err error) {
+	defer thrower.RecoverError(&err)
+	r, err := getFilter(id)(params, bytes.NewReader(in))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+func TestNbitFilter(t *testing.T) {
+	// Little-endian 16-bit values with 12 bits of precision at offset 2, and
+	// big-endian 32-bit values with 7 bits at offset 20.
+	vals16 := []uint16{0x3ffc, 0x0004, 0x1234 &^ 3}
+	vals32 := []uint32{0x07f00000, 0x00100000, 0x05500000}
+	var bw bitWriter
+	var exp16, exp32 []byte
+	for i := range vals16 {
+		bw.writeBits(uint64(vals16[i]>>2), 12)
+		exp16 = append(exp16, byte(vals16[i]), byte(vals16[i]>>8))
+	}
+	params := []uint32{8, 0, 3, nbitAtomic, 2, filterOrderLE, 12, 2}
+	got, err := filterData(filterNbit, params, bw.b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, exp16) {
+		t.Errorf("got %x exp %x", got, exp16)
+	}
+
+	bw = bitWriter{}
+	for i := range vals32 {
+		bw.writeBits(uint64(vals32[i]>>20), 7)
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, vals32[i])
+		exp32 = append(exp32, b...)
+	}
+	params = []uint32{8, 0, 3, nbitAtomic, 4, filterOrderBE, 7, 20}
+	got, err = filterData(filterNbit, params, bw.b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, exp32) {
+		t.Errorf("got %x exp %x", got, exp32)
+	}
+
+	// A compound of a 2-element array of the 16-bit values at offset 0, a
+	// 2-byte no-op member at offset 4, and one 32-bit value at offset 8.
+	params = []uint32{0, 0, 2, nbitCompound, 12, 3,
+		0, nbitArray, 4, nbitAtomic, 2, filterOrderLE, 12, 2,
+		4, nbitNoOpType, 2,
+		8, nbitAtomic, 4, filterOrderBE, 7, 20}
+	params[0] = uint32(len(params))
+	bw = bitWriter{}
+	var exp []byte
+	for i := 0; i < 2; i++ {
+		bw.writeBits(uint64(vals16[i]>>2), 12)
+		bw.writeBits(uint64(vals16[i+1]>>2), 12)
+		bw.writeBits(0xab, 8)
+		bw.writeBits(uint64(i), 8)
+		bw.writeBits(uint64(vals32[i]>>20), 7)
+		exp = append(exp, exp16[2*i:2*i+4]...)
+		exp = append(exp, 0xab, byte(i), 0, 0)
+		exp = append(exp, exp32[4*i:4*i+4]...)
+	}
+	got, err = filterData(filterNbit, params, bw.b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %x exp %x", got, exp)
+	}
+
+	// Too few parameters for the type
+	params = []uint32{6, 0, 2, nbitAtomic, 4, filterOrderBE}
+	_, err = filterData(filterNbit, params, bw.b)
+	if err != ErrCorrupted {
+		t.Error("expected corrupted, got", err)
+	}
+}
+
+// scaleOffsetChunk returns a chunk with the given minimum bits and value.
+func scaleOffsetChunk(minBits uint, minVal uint64, vals []uint64) []byte {
+	header := make([]byte, scaleOffsetHeaderSize)
+	binary.LittleEndian.PutUint32(header, uint32(minBits))
+	header[4] = 8
+	binary.LittleEndian.PutUint64(header[5:], minVal)
+	var bw bitWriter
+	for _, v := range vals {
+		bw.writeBits(v, minBits)
+	}
+	return append(header, bw.b...)
+}
+
+func TestScaleOffsetFilter(t *testing.T) {
+	// Signed shorts with a fill value of -99
+	fill := int16(-99)
+	params := []uint32{scaleInt, 0, 4, 0, 2, 1, filterOrderLE, 1, uint32(uint16(fill))}
+	minVal := int64(-10)
+	chunk := scaleOffsetChunk(5, uint64(minVal), []uint64{0, 31, 5, 30})
+	got, err := filterData(filterScaleOffset, params, chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vals := make([]int16, 4)
+	binary.Read(bytes.NewReader(got), binary.LittleEndian, vals)
+	if !reflect.DeepEqual(vals, []int16{-10, fill, -5, 20}) {
+		t.Error("got", vals)
+	}
+
+	// All the same value, no fill value
+	params = []uint32{scaleInt, 0, 3, 0, 2, 1, filterOrderBE, 0}
+	chunk = scaleOffsetChunk(0, 7, nil)
+	got, err = filterData(filterScaleOffset, params, chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []byte{0, 7, 0, 7, 0, 7}) {
+		t.Errorf("got %x", got)
+	}
+
+	// Floats with two decimal digits
+	params = []uint32{scaleFloatDScale, 2, 3, 1, 4, 1, filterOrderLE, 0}
+	chunk = scaleOffsetChunk(10, uint64(math.Float32bits(1.5)), []uint64{0, 1, 525})
+	got, err = filterData(filterScaleOffset, params, chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	floats := make([]float32, 3)
+	binary.Read(bytes.NewReader(got), binary.LittleEndian, floats)
+	if !reflect.DeepEqual(floats, []float32{1.5, 1.51, 6.75}) {
+		t.Error("got", floats)
+	}
+
+	// Full precision is stored as is
+	params = []uint32{scaleFloatDScale, 2, 1, 1, 8, 1, filterOrderLE, 0}
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint64(data, math.Float64bits(math.Pi))
+	chunk = append(scaleOffsetChunk(64, 0, nil), data...)
+	got, err = filterData(filterScaleOffset, params, chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, data) {
+		t.Errorf("got %x exp %x", got, data)
+	}
+
+	// E-scaling isn't supported by HDF5 either
+	params = []uint32{scaleFloatEScale, 2, 1, 1, 8, 1, filterOrderLE, 0}
+	_, err = filterData(filterScaleOffset, params, chunk)
+	if err != ErrUnsupportedFilter {
+		t.Error("expected unsupported filter, got", err)
+	}
+}
+
+func TestSignExtend(t *testing.T) {
+	vals := [][]int16{{0x0fff, 0x07ff}, {0x0800, 0}}
+	got := signExtend(vals, 0, 12)
+	exp := [][]int16{{-1, 0x07ff}, {-0x800, 0}}
+	if !reflect.DeepEqual(got, exp) {
+		t.Error("got", got, "exp", exp)
+	}
+	if got := signExtend(int8(0x1f), 0, 5); got != int8(-1) {
+		t.Error("got", got)
+	}
+}
@@ -1,11 +1,9 @@
 package hdf5
 
 import (
-	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
-	"math"
 	"reflect"
 
 	"github.com/batchatco/go-thrower"
@@ -23,7 +21,7 @@ func (fixedPointManagerType) cdlTypeString(sh sigHelper, name string, attr *attr
 	if !attr.signed {
 		prefix = "u"
 	}
-	switch attr.length {
+	switch fixedPointSize(attr.length) {
 	case 1:
 		return prefix + "byte"
 	case 2:
@@ -42,7 +40,7 @@ func (fixedPointManagerType) goTypeString(sh sigHelper, name string, attr *attri
 	if !attr.signed {
 		prefix = "u"
 	}
-	switch attr.length {
+	switch fixedPointSize(attr.length) {
 	case 1:
 		return prefix + "int8"
 	case 2:
@@ -56,6 +54,21 @@ func (fixedPointManagerType) goTypeString(sh sigHelper, name string, attr *attri
 	}
 }
 
+// fixedPointSize returns the size of the Go integers that values of the given
+// length are read into.  Odd sizes are promoted to the next larger one.
+func fixedPointSize(length uint32) uint32 {
+	switch {
+	case length <= 1:
+		return 1
+	case length <= 2:
+		return 2
+	case length <= 4:
+		return 4
+	default:
+		return 8
+	}
+}
+
 func (fixedPointManagerType) alloc(hr heapReader, c caster, bf io.Reader, attr *attribute,
 	dimensions []uint64) interface{} {
 	var values interface{}
@@ -68,45 +81,107 @@ func (fixedPointManagerType) alloc(hr heapReader, c caster, bf io.Reader, attr *
 		values = allocInts(bf, dimensions, attr.endian, attr.signed, nil)
 	case 8:
 		values = allocInt64s(bf, dimensions, attr.endian, attr.signed, nil)
+	case 3, 5, 6, 7:
+		values = allocOddInts(bf, dimensions, attr)
 	default:
 		fail(fmt.Sprintf("bad size fixed: %d (%v)", attr.length, attr))
 	}
+	if attr.bitOffset > 0 || uint32(attr.bitPrecision) < fixedPointSize(attr.length)*8 {
+		// The padding bits may be anything, so they are removed.  Negative
+		// values also need sign extension.
+		if attr.signed {
+			values = signExtend(values, uint(attr.bitOffset), uint(attr.bitPrecision))
+		} else {
+			values = extractBits(values, uint(attr.bitOffset), uint(attr.bitPrecision))
+		}
+	}
 	return values // already converted
 }
 
-func (fixedPointManagerType) defaultFillValue(obj *object, objFillValue []byte, undefinedFillValue bool) []byte {
-	switch obj.objAttr.length {
-	case 1:
-		if undefinedFillValue {
-			fv := math.MinInt8 + 1
-			objFillValue = []byte{byte(fv)}
+// signExtend replaces the signed integers in values, which may be a scalar
+// or nested slices, with the bits from offset to offset+precision,
+// sign-extended.  It shifts left to drop the higher bits and then right.
+func signExtend(values interface{}, offset uint, precision uint) interface{} {
+	left := 64 - offset - precision
+	right := 64 - precision
+	v := reflect.ValueOf(values)
+	if v.Kind() != reflect.Slice {
+		return reflect.ValueOf(v.Int() << left >> right).Convert(v.Type()).Interface()
+	}
+	var extend func(v reflect.Value)
+	extend = func(v reflect.Value) {
+		for i := 0; i < v.Len(); i++ {
+			e := v.Index(i)
+			if e.Kind() == reflect.Slice {
+				extend(e)
+				continue
+			}
+			e.SetInt(e.Int() << left >> right)
 		}
-	case 2:
-		if undefinedFillValue {
-			fv := int16(math.MinInt16 + 1)
-			var bb bytes.Buffer
-			err := binary.Write(&bb, obj.objAttr.endian, fv)
-			thrower.ThrowIfError(err)
-			objFillValue = bb.Bytes()
+	}
+	extend(v)
+	return values
+}
+
+// allocOddInts reads integers of 3, 5, 6 or 7 bytes into the next larger Go
+// integers.  Sign extension is left to the caller.
+func allocOddInts(bf io.Reader, dimLengths []uint64, attr *attribute) interface{} {
+	var cast reflect.Type
+	switch {
+	case attr.signed && attr.length == 3:
+		cast = reflect.TypeOf(int32(0))
+	case attr.length == 3:
+		cast = reflect.TypeOf(uint32(0))
+	case attr.signed:
+		cast = reflect.TypeOf(int64(0))
+	default:
+		cast = reflect.TypeOf(uint64(0))
+	}
+	b := make([]byte, 8)
+	readValue := func() reflect.Value {
+		for i := range b {
+			b[i] = 0
 		}
-	case 4:
-		if undefinedFillValue {
-			fv := int32(math.MinInt32 + 1)
-			var bb bytes.Buffer
-			err := binary.Write(&bb, obj.objAttr.endian, fv)
-			thrower.ThrowIfError(err)
-			objFillValue = bb.Bytes()
+		if attr.endian == binary.BigEndian {
+			read(bf, b[8-attr.length:])
+		} else {
+			read(bf, b[:attr.length])
 		}
-	case 8:
-		if undefinedFillValue {
-			fv := int64(math.MinInt64 + 1)
-			var bb bytes.Buffer
-			err := binary.Write(&bb, obj.objAttr.endian, fv)
-			thrower.ThrowIfError(err)
-			objFillValue = bb.Bytes()
+		return reflect.ValueOf(attr.endian.Uint64(b)).Convert(cast)
+	}
+	if len(dimLengths) == 0 {
+		return readValue().Interface()
+	}
+	var alloc func(dimLengths []uint64) reflect.Value
+	alloc = func(dimLengths []uint64) reflect.Value {
+		vals := makeSlices(cast, dimLengths)
+		for i := 0; i < int(dimLengths[0]); i++ {
+			if len(dimLengths) == 1 {
+				vals.Index(i).Set(readValue())
+				continue
+			}
+			vals.Index(i).Set(alloc(dimLengths[1:]))
 		}
+		return vals
+	}
+	return alloc(dimLengths).Interface()
+}
+
+func (fixedPointManagerType) defaultFillValue(obj *object, objFillValue []byte, undefinedFillValue bool) []byte {
+	if !undefinedFillValue {
+		return objFillValue
+	}
+	// The smallest integer of the size plus one, like the NetCDF defaults.
+	// Integers of 3, 5, 6 and 7 bytes get the fill value for their own size,
+	// which is sign-extended into the larger Go integer they're read as.
+	length := obj.objAttr.length
+	fv := uint64(1) - uint64(1)<<(8*length-1)
+	b := make([]byte, 8)
+	obj.objAttr.endian.PutUint64(b, fv)
+	if obj.objAttr.endian == binary.BigEndian {
+		return b[8-length:]
 	}
-	return objFillValue
+	return b[:length]
 }
 
 func (fixedPointManagerType) parse(hr heapReader, c caster, attr *attribute, bitFields uint32, bf remReader, df remReader) {
@@ -122,21 +197,21 @@ func (fixedPointManagerType) parse(hr heapReader, c caster, attr *attribute, bit
 	} else {
 		attr.endian = binary.LittleEndian
 	}
-	assertError(paddingType == 0, ErrFixedPoint,
-		fmt.Sprintf("fixed point padding must be zero 0x%x", bitFields))
 	logger.Info("len properties", bf.Rem())
 	assert(bf.Rem() > 0, "properties should be here")
-	bitOffset := read16(bf)
-	bitPrecision := read16(bf)
-	logger.Infof("bitOffset=%d bitPrecision=%d blen=%d", bitOffset, bitPrecision,
+	attr.bitOffset = read16(bf)
+	attr.bitPrecision = read16(bf)
+	logger.Infof("bitOffset=%d bitPrecision=%d blen=%d", attr.bitOffset, attr.bitPrecision,
 		bf.Count())
-	assertError(bitOffset == 0, ErrFixedPoint, "bit offset must be zero")
 	switch attr.length {
-	case 1, 2, 4, 8:
+	case 1, 2, 3, 4, 5, 6, 7, 8:
 		break
 	default:
 		thrower.Throw(ErrFixedPoint)
 	}
+	assertError(attr.bitPrecision > 0 &&
+		uint32(attr.bitOffset)+uint32(attr.bitPrecision) <= attr.length*8,
+		ErrFixedPoint, "fixed-point bits don't fit")
 	if df == nil {
 		logger.Infof("no data")
 		return
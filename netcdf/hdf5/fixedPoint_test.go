@@ -0,0 +1,146 @@
+package hdf5
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// fixedPointFile returns a file with a variable named x of four integers
+// with the given layout.  Flags are the datatype class bits.
+func fixedPointFile(flags uint8, size uint32, offset, precision uint16, data []byte) []byte {
+	b := newFileBuilder(0, 8, 8)
+	b.addVar("x", []uint64{4},
+		v1Message(typeDatatype, 0x10|typeFixedPoint, flags, 0, 0, size, offset, precision),
+		data)
+	return b.bytes()
+}
+
+// flags for fixedPointFile
+const (
+	fixedBigEndian = 0x1
+	fixedLoPad     = 0x2
+	fixedHiPad     = 0x4
+	fixedSigned    = 0x8
+)
+
+func TestFixedPointLayouts(t *testing.T) {
+	le := func(vals ...interface{}) []byte {
+		var b indexBuilder
+		b.put(vals...)
+		return b.buf.Bytes()
+	}
+	for _, test := range []struct {
+		name      string
+		flags     uint8
+		size      uint32
+		offset    uint16
+		precision uint16
+		data      []byte
+		exp       interface{}
+		goType    string
+	}{
+		{"12-bit signed", fixedSigned | fixedHiPad, 2, 0, 12,
+			le(uint16(0x07ff), uint16(0xf800), uint16(0xffff), uint16(0xf001)),
+			[]int16{2047, -2048, -1, 1}, "int16"},
+		{"12-bit unsigned big endian", fixedBigEndian | fixedLoPad, 2, 4, 12,
+			[]byte{0xab, 0xcf, 0x00, 0x1f, 0xff, 0xff, 0x00, 0x0f},
+			[]uint16{0xabc, 1, 0xfff, 0}, "uint16"},
+		{"24-bit signed", fixedSigned | fixedLoPad, 4, 8, 24,
+			le(uint32(0x123456ff), uint32(0xffffff00), uint32(0x80000000), uint32(0x00000100)),
+			[]int32{0x123456, -1, -0x800000, 1}, "int32"},
+		{"3-byte signed", fixedSigned, 3, 0, 24,
+			[]byte{0xff, 0xff, 0x7f, 0, 0, 0x80, 0xfe, 0xff, 0xff, 1, 0, 0},
+			[]int32{0x7fffff, -0x800000, -2, 1}, "int32"},
+		{"3-byte unsigned big endian", fixedBigEndian, 3, 0, 24,
+			[]byte{0x12, 0x34, 0x56, 0xff, 0xff, 0xff, 0, 0, 0, 0, 0, 1},
+			[]uint32{0x123456, 0xffffff, 0, 1}, "uint32"},
+		{"5-byte signed big endian", fixedSigned | fixedBigEndian, 5, 0, 40,
+			[]byte{0xff, 0xff, 0xff, 0xff, 0xfe, 0x7f, 0xff, 0xff, 0xff, 0xff,
+				0x80, 0, 0, 0, 0, 0, 0, 0, 0, 5},
+			[]int64{-2, 1<<39 - 1, -1 << 39, 5}, "int64"},
+		{"50 bits in 7 bytes", fixedHiPad, 7, 0, 50,
+			le(uint32(0xffffffff), uint16(0xffff), 0xff, make([]byte, 7),
+				uint32(1), uint16(0), 0xfc, uint32(0), uint16(0), 0x02),
+			[]uint64{1<<50 - 1, 0, 1, 1 << 49}, "uint64"},
+	} {
+		file := fixedPointFile(test.flags, test.size, test.offset, test.precision, test.data)
+		nc, err := New(nopCloser{bytes.NewReader(file)})
+		if err != nil {
+			t.Error(test.name, err)
+			continue
+		}
+		vr, err := nc.GetVariable("x")
+		if err != nil {
+			t.Error(test.name, err)
+		} else if !reflect.DeepEqual(vr.Values, test.exp) {
+			t.Errorf("%s: got %#x exp %#x", test.name, vr.Values, test.exp)
+		}
+		vg, err := nc.GetVarGetter("x")
+		if err != nil {
+			t.Error(test.name, err)
+		} else if vg.GoType() != test.goType {
+			t.Error(test.name, "got type", vg.GoType(), "exp", test.goType)
+		}
+		nc.Close()
+	}
+}
+
+func TestBadFixedPoint(t *testing.T) {
+	for _, test := range []struct {
+		size      uint32
+		offset    uint16
+		precision uint16
+	}{
+		{2, 4, 16},
+		{4, 0, 0},
+		{9, 0, 72},
+	} {
+		file := fixedPointFile(0, test.size, test.offset, test.precision,
+			make([]byte, 4*test.size))
+		nc, err := New(nopCloser{bytes.NewReader(file)})
+		if err == nil {
+			_, err = nc.GetVariable("x")
+			nc.Close()
+		}
+		if err != ErrFixedPoint {
+			t.Error(test.size, test.offset, test.precision, "expected fixed-point error, got", err)
+		}
+	}
+}
+
+func TestOddFixedPointFill(t *testing.T) {
+	for _, test := range []struct {
+		flags uint8
+		size  uint32
+		exp   interface{}
+	}{
+		{fixedSigned, 3, []int32{-0x7fffff, -0x7fffff, -0x7fffff, -0x7fffff}},
+		{fixedSigned | fixedBigEndian, 3, []int32{-0x7fffff, -0x7fffff, -0x7fffff, -0x7fffff}},
+		{fixedSigned, 5, []int64{-0x7fffffffff, -0x7fffffffff, -0x7fffffffff, -0x7fffffffff}},
+		{fixedSigned, 4, []int32{math.MinInt32 + 1, math.MinInt32 + 1, math.MinInt32 + 1,
+			math.MinInt32 + 1}},
+	} {
+		// The two chunks haven't been written, and the fill value is undefined.
+		b := newFileBuilder(0, 8, 8)
+		b.addObject("x", b.dataspace([]uint64{4}),
+			v1Message(typeDatatype, 0x10|typeFixedPoint, test.flags, 0, 0, test.size,
+				uint16(0), uint16(8*test.size)),
+			v1Message(typeDataStorageFillValue, 3, 0x12),
+			v1Message(typeDataLayout, 3, classChunked, 2, uint64(invalidAddress), uint32(2),
+				test.size))
+		nc, err := New(nopCloser{bytes.NewReader(b.bytes())})
+		if err != nil {
+			t.Error(test.size, err)
+			continue
+		}
+		vr, err := nc.GetVariable("x")
+		if err != nil {
+			t.Error(test.size, err)
+		} else if !reflect.DeepEqual(vr.Values, test.exp) {
+			t.Error(test.size, test.flags, "got", vr.Values, "exp", test.exp)
+		}
+		nc.Close()
+	}
+}
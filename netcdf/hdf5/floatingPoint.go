@@ -19,6 +19,12 @@ var (
 )
 
 func (floatingPointManagerType) cdlTypeString(sh sigHelper, name string, attr *attribute, origNames map[string]bool) string {
+	if attr.float != nil {
+		if attr.float.isFloat32() {
+			return "float"
+		}
+		return "double"
+	}
 	switch attr.length {
 	case 4:
 		return "float"
@@ -30,6 +36,12 @@ func (floatingPointManagerType) cdlTypeString(sh sigHelper, name string, attr *a
 }
 
 func (floatingPointManagerType) goTypeString(sh sigHelper, name string, attr *attribute, origNames map[string]bool) string {
+	if attr.float != nil {
+		if attr.float.isFloat32() {
+			return "float32"
+		}
+		return "float64"
+	}
 	switch attr.length {
 	case 4:
 		return "float32"
@@ -42,6 +54,9 @@ func (floatingPointManagerType) goTypeString(sh sigHelper, name string, attr *at
 
 func (floatingPointManagerType) alloc(hr heapReader, c caster, bf io.Reader, attr *attribute,
 	dimensions []uint64) interface{} {
+	if attr.float != nil {
+		return allocFloatFormat(bf, dimensions, attr)
+	}
 	var values interface{}
 	switch attr.length {
 	case 4:
@@ -56,6 +71,12 @@ func (floatingPointManagerType) alloc(hr heapReader, c caster, bf io.Reader, att
 }
 
 func (floatingPointManagerType) defaultFillValue(obj *object, objFillValue []byte, undefinedFillValue bool) []byte {
+	if obj.objAttr.float != nil {
+		if undefinedFillValue {
+			objFillValue = obj.objAttr.float.nan(obj.objAttr)
+		}
+		return objFillValue
+	}
 	switch obj.objAttr.length {
 	case 4:
 		var fv float32
@@ -86,21 +107,23 @@ func (floatingPointManagerType) defaultFillValue(obj *object, objFillValue []byt
 func (floatingPointManagerType) parse(hr heapReader, c caster, attr *attribute, bitFields uint32, bf remReader, df remReader) {
 	assertError(attr.dtversion == 1, ErrFloatingPoint, "Only support version 1 of float")
 	logger.Info("* floating-point")
+	vax := false
 	endian := ((bitFields >> 5) & 0b10) | (bitFields & 0b1)
 	switch endian {
 	case 0:
 		attr.endian = binary.LittleEndian
 	case 1:
 		attr.endian = binary.BigEndian
+	case 3:
+		attr.endian = binary.LittleEndian // within each 16-bit word
+		vax = true
 	default:
-		fail(fmt.Sprint("unhandled byte order: ", endian))
+		failError(ErrFloatingPoint, fmt.Sprint("unhandled byte order: ", endian))
 	}
 	loPad := (bitFields & 0b10) == 0b10
-	assertError(!loPad, ErrFloatingPoint, "low pad not supported")
 	hiPad := (bitFields & 0b100) == 0b100
-	assertError(!hiPad, ErrFloatingPoint, "high pad not supported")
 	intPad := (bitFields & 0b1000) == 0b1000
-	assertError(!intPad, ErrFloatingPoint, "internal pad not supported")
+	logger.Info("* pad low:", loPad, "high:", hiPad, "internal:", intPad)
 	mantissaNormalization := (bitFields >> 4) & 0b11
 	logger.Info("* mantissa normalization:", mantissaNormalization)
 	sign := (bitFields >> 8) & 0b11111111
@@ -123,24 +146,26 @@ func (floatingPointManagerType) parse(hr heapReader, c caster, attr *attribute,
 		mantissaLocation,
 		mantissaSize,
 		exponentBias)
-	assertError(bitOffset == 0, ErrFloatingPoint, "bit offset must be zero")
-	assertError(mantissaNormalization == 2, ErrFloatingPoint, "mantissa normalization must be 2")
-	switch attr.length {
-	case 4:
-		assertError(sign == 31, ErrFloatingPoint, "float32 sign location must be 31")
-		assertError(bitPrecision == 32, ErrFloatingPoint, "float32 precision must be 32")
-		assertError(exponentLocation == 23, ErrFloatingPoint, "float32 exponent location must be 23")
-		assertError(exponentSize == 8, ErrFloatingPoint, "float32 exponent size must be 8")
-		assertError(exponentBias == 127, ErrFloatingPoint, "float32 exponent bias must be 127")
-	case 8:
-		assertError(sign == 63, ErrFloatingPoint, "float64 sign location must be 63")
-		assertError(bitPrecision == 64, ErrFloatingPoint, "float64 precision must be 64")
-		assertError(exponentLocation == 52, ErrFloatingPoint, "float64 exponent location must be 52")
-		assertError(exponentSize == 11, ErrFloatingPoint, "float64 exponent size must be 11")
-		assertError(exponentBias == 1023, ErrFloatingPoint, "float64 exponent bias must be 1023")
+	f := floatFormat{
+		vax:              vax,
+		normalization:    uint8(mantissaNormalization),
+		sign:             uint8(sign),
+		exponentLocation: exponentLocation,
+		exponentSize:     exponentSize,
+		mantissaLocation: mantissaLocation,
+		mantissaSize:     mantissaSize,
+		exponentBias:     exponentBias,
+	}
+	standard := !vax && !loPad && !hiPad && !intPad && bitOffset == 0 &&
+		uint32(bitPrecision) == 8*attr.length
+	switch {
+	case standard && attr.length == 4 && f == float32Format:
+		logger.Info("* IEEE float32")
+	case standard && attr.length == 8 && f == float64Format:
+		logger.Info("* IEEE float64")
 	default:
-		logger.Error("bad dtlenth for fp", attr.length)
-		thrower.Throw(ErrFloatingPoint)
+		f.check(attr.length, bitOffset, bitPrecision)
+		attr.float = &f
 	}
 	if df == nil {
 		logger.Infof("no data")
@@ -192,3 +217,189 @@ func allocDoubles(bf io.Reader, dimLengths []uint64, endian binary.ByteOrder) in
 	}
 	return vals.Interface()
 }
+
+// floatFormat is the layout of a floating-point type that isn't IEEE
+// binary32 or binary64, such as float16 or bfloat16.  Bit locations are from
+// the least significant bit of the value, after putting it in little-endian
+// order.
+type floatFormat struct {
+	vax              bool  // VAX byte order
+	normalization    uint8 // one of the norm constants
+	sign             uint8
+	exponentLocation uint8
+	exponentSize     uint8
+	mantissaLocation uint8
+	mantissaSize     uint8
+	exponentBias     uint32
+}
+
+// mantissa normalization
+const (
+	normNone    = 0 // no leading one
+	normMSBSet  = 1 // the most significant bit of the mantissa is always set
+	normImplied = 2 // the leading one is not stored
+)
+
+var (
+	float32Format = floatFormat{normalization: normImplied, sign: 31, exponentLocation: 23,
+		exponentSize: 8, mantissaSize: 23, exponentBias: 127}
+	float64Format = floatFormat{normalization: normImplied, sign: 63, exponentLocation: 52,
+		exponentSize: 11, mantissaSize: 52, exponentBias: 1023}
+)
+
+// check fails if the fields don't fit in the value, or can't be decoded.
+func (f *floatFormat) check(length uint32, bitOffset uint16, bitPrecision uint16) {
+	assertError(f.normalization <= normImplied, ErrFloatingPoint,
+		fmt.Sprint("bad mantissa normalization: ", f.normalization))
+	assertError(!f.vax || length%2 == 0, ErrFloatingPoint, "VAX floats must be an even size")
+	assertError(uint32(bitOffset)+uint32(bitPrecision) <= 8*length, ErrFloatingPoint,
+		"floating-point precision larger than size")
+	end := uint32(bitOffset) + uint32(bitPrecision)
+	inside := func(location uint8, size uint8) bool {
+		return uint32(location) >= uint32(bitOffset) && uint32(location)+uint32(size) <= end
+	}
+	assertError(inside(f.sign, 1), ErrFloatingPoint, "sign location outside of value")
+	assertError(f.exponentSize > 0 && f.exponentSize <= 32 &&
+		inside(f.exponentLocation, f.exponentSize),
+		ErrFloatingPoint, "bad exponent location or size")
+	assertError(f.mantissaSize > 0 && f.mantissaSize <= 64 &&
+		inside(f.mantissaLocation, f.mantissaSize),
+		ErrFloatingPoint, "bad mantissa location or size")
+}
+
+// isFloat32 returns true if the values fit in a float32, otherwise they are
+// returned as float64s.
+func (f *floatFormat) isFloat32() bool {
+	significand := int(f.mantissaSize)
+	if f.normalization == normImplied {
+		significand++
+	}
+	// The unbiased exponents of the most significant bit of normal numbers.
+	// The largest exponent is for infinities and NaNs, except in VAX floats.
+	minExponent := 1 - int(f.exponentBias)
+	maxExponent := int(uint64(1)<<f.exponentSize-1) - int(f.exponentBias)
+	if !f.vax {
+		maxExponent--
+	}
+	// The least significant bit of the smallest denormalized number must fit
+	// too.
+	return significand <= 24 && maxExponent <= 127 && minExponent-(significand-1) >= -149
+}
+
+// littleEndian puts the bytes of a value in little-endian order.
+func (f *floatFormat) littleEndian(b []byte, endian binary.ByteOrder) {
+	switch {
+	case f.vax:
+		// 16-bit words, most significant first
+		for i, j := 0, len(b)-2; i < j; i, j = i+2, j-2 {
+			b[i], b[i+1], b[j], b[j+1] = b[j], b[j+1], b[i], b[i+1]
+		}
+	case endian == binary.BigEndian:
+		for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+			b[i], b[j] = b[j], b[i]
+		}
+	}
+}
+
+// getBits returns size bits from the little-endian value, starting at bit
+// location.
+func getBits(b []byte, location uint8, size uint8) uint64 {
+	var v uint64
+	for i := uint(0); i < uint(size); i++ {
+		p := uint(location) + i
+		v |= uint64(b[p/8]>>(p%8)&1) << i
+	}
+	return v
+}
+
+// setBits is the opposite of getBits.
+func setBits(b []byte, location uint8, size uint8, v uint64) {
+	for i := uint(0); i < uint(size); i++ {
+		p := uint(location) + i
+		b[p/8] |= byte(v>>i&1) << (p % 8)
+	}
+}
+
+// decode returns the value in b, which is in little-endian order.
+func (f *floatFormat) decode(b []byte) float64 {
+	negative := getBits(b, f.sign, 1) == 1
+	exponent := int(getBits(b, f.exponentLocation, f.exponentSize))
+	mantissa := getBits(b, f.mantissaLocation, f.mantissaSize)
+	maxExponent := int(uint64(1)<<f.exponentSize - 1)
+	sign := 1
+	if negative {
+		sign = -1
+	}
+	if f.vax && exponent == 0 {
+		// VAX floats have no infinities, NaNs or denormalized numbers.
+		return math.Copysign(0, float64(sign))
+	}
+	if !f.vax && exponent == maxExponent {
+		fraction := mantissa
+		if f.normalization != normImplied {
+			fraction &= uint64(1)<<(f.mantissaSize-1) - 1
+		}
+		if fraction != 0 {
+			return math.NaN()
+		}
+		return math.Inf(sign)
+	}
+	// Denormalized numbers have the same scale as the smallest normal ones.
+	scale := exponent - int(f.exponentBias) - int(f.mantissaSize)
+	if exponent == 0 {
+		scale++
+	}
+	value := float64(mantissa)
+	switch f.normalization {
+	case normImplied:
+		if exponent != 0 {
+			value += math.Ldexp(1, int(f.mantissaSize))
+		}
+	default:
+		// The leading one is in the mantissa.
+		scale++
+	}
+	return math.Copysign(math.Ldexp(value, scale), float64(sign))
+}
+
+// nan returns a NaN in the format, in the file's byte order.
+func (f *floatFormat) nan(attr *attribute) []byte {
+	b := make([]byte, attr.length)
+	setBits(b, f.exponentLocation, f.exponentSize, ^uint64(0))
+	setBits(b, f.mantissaLocation, f.mantissaSize, ^uint64(0))
+	// Byte swapping is its own inverse.
+	f.littleEndian(b, attr.endian)
+	return b
+}
+
+// allocFloatFormat reads values in the attribute's float format, and returns
+// them as float32s or float64s.
+func allocFloatFormat(bf io.Reader, dimLengths []uint64, attr *attribute) interface{} {
+	f := attr.float
+	cast := reflect.TypeOf(float64(0))
+	if f.isFloat32() {
+		cast = reflect.TypeOf(float32(0))
+	}
+	b := make([]byte, attr.length)
+	readValue := func() float64 {
+		read(bf, b)
+		f.littleEndian(b, attr.endian)
+		return f.decode(b)
+	}
+	if len(dimLengths) == 0 {
+		return reflect.ValueOf(readValue()).Convert(cast).Interface()
+	}
+	var alloc func(dimLengths []uint64) reflect.Value
+	alloc = func(dimLengths []uint64) reflect.Value {
+		vals := makeSlices(cast, dimLengths)
+		for i := 0; i < int(dimLengths[0]); i++ {
+			if len(dimLengths) == 1 {
+				vals.Index(i).SetFloat(readValue())
+				continue
+			}
+			vals.Index(i).Set(alloc(dimLengths[1:]))
+		}
+		return vals
+	}
+	return alloc(dimLengths).Interface()
+}
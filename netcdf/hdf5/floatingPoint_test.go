@@ -0,0 +1,170 @@
+package hdf5
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// floatFile returns a file with a variable named x of four floating-point
+// values with the given layout.  Flags are the datatype class bits.
+func floatFile(flags uint8, size uint32, offset, precision uint16, f floatFormat,
+	data []byte) []byte {
+	b := newFileBuilder(0, 8, 8)
+	b.addVar("x", []uint64{4},
+		v1Message(typeDatatype, 0x10|typeFloatingPoint, flags|f.normalization<<4, f.sign, 0,
+			size, offset, precision, f.exponentLocation, f.exponentSize,
+			f.mantissaLocation, f.mantissaSize, f.exponentBias),
+		data)
+	return b.bytes()
+}
+
+var (
+	float16Format = floatFormat{normalization: normImplied, sign: 15, exponentLocation: 10,
+		exponentSize: 5, mantissaSize: 10, exponentBias: 15}
+	bfloat16Format = floatFormat{normalization: normImplied, sign: 15, exponentLocation: 7,
+		exponentSize: 8, mantissaSize: 7, exponentBias: 127}
+	// a bfloat16 whose exponents go past those of a float32
+	wideFormat = floatFormat{normalization: normImplied, sign: 15, exponentLocation: 7,
+		exponentSize: 8, mantissaSize: 7, exponentBias: 100}
+	x87Format = floatFormat{normalization: normNone, sign: 79, exponentLocation: 64,
+		exponentSize: 15, mantissaSize: 64, exponentBias: 16383}
+	vaxFormat = floatFormat{normalization: normImplied, sign: 31, exponentLocation: 23,
+		exponentSize: 8, mantissaSize: 23, exponentBias: 129}
+	// a float32 with the low 8 bits of its mantissa cut off and padded with ones
+	float24Format = floatFormat{normalization: normImplied, sign: 31, exponentLocation: 23,
+		exponentSize: 8, mantissaLocation: 8, mantissaSize: 15, exponentBias: 127}
+)
+
+// flags for floatFile
+const (
+	floatBigEndian = 0x1
+	floatLoPad     = 0x2
+	floatVAX       = 0x41
+)
+
+func TestFloatFormats(t *testing.T) {
+	le := func(vals ...interface{}) []byte {
+		var b indexBuilder
+		b.put(vals...)
+		return b.buf.Bytes()
+	}
+	be := func(vals ...interface{}) []byte {
+		var b bytes.Buffer
+		for _, v := range vals {
+			err := binary.Write(&b, binary.BigEndian, v)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return b.Bytes()
+	}
+	for _, test := range []struct {
+		name      string
+		flags     uint8
+		size      uint32
+		offset    uint16
+		precision uint16
+		format    floatFormat
+		data      []byte
+		exp       interface{}
+		goType    string
+	}{
+		{"float16", 0, 2, 0, 16, float16Format,
+			le(uint16(0x3c00), uint16(0xc000), uint16(0x7bff), uint16(0x0001)),
+			[]float32{1, -2, 65504, float32(math.Ldexp(1, -24))}, "float32"},
+		{"float16 big endian", floatBigEndian, 2, 0, 16, float16Format,
+			be(uint16(0x3555), uint16(0x8000), uint16(0xfc00), uint16(0x03ff)),
+			[]float32{1365.0 / 4096, float32(math.Copysign(0, -1)), float32(math.Inf(-1)),
+				float32(math.Ldexp(1023, -24))}, "float32"},
+		{"bfloat16", 0, 2, 0, 16, bfloat16Format,
+			le(uint16(0x3f80), uint16(0xc040), uint16(0x4049), uint16(0x7f80)),
+			[]float32{1, -3, 3.140625, float32(math.Inf(1))}, "float32"},
+		{"wide exponent", 0, 2, 0, 16, wideFormat,
+			le(uint16(0x3f80), uint16(0x7f00), uint16(0x0080), uint16(0x0001)),
+			[]float64{math.Ldexp(1, 27), math.Ldexp(1, 154), math.Ldexp(1, -99),
+				math.Ldexp(1, -106)}, "float64"},
+		{"x87 long double", 0, 16, 0, 80, x87Format,
+			le(uint64(1<<63), uint16(0x3fff), make([]byte, 6),
+				uint64(1<<63), uint16(0xbffe), make([]byte, 6),
+				uint64(0xc000000000000000), uint16(0x4000), make([]byte, 6),
+				uint64(1<<63), uint16(0x3c00), make([]byte, 6)),
+			[]float64{1, -0.5, 3, math.Ldexp(1, -1023)}, "float64"},
+		{"VAX", floatVAX, 4, 0, 32, vaxFormat,
+			le(uint16(0x4080), uint16(0), uint16(0xc100), uint16(0),
+				uint16(0x4149), uint16(0x0fdb), uint16(0), uint16(0)),
+			// The smallest VAX floats are too small for a float32.
+			[]float64{1, -2, float64(float32(math.Pi)), 0}, "float64"},
+		{"padded float32", floatLoPad, 4, 8, 24, float24Format,
+			le(uint32(0x3fc000ff), uint32(0xc2c800ff), uint32(0x7f8000ff), uint32(0x000100ff)),
+			[]float32{1.5, -100, float32(math.Inf(1)), float32(math.Ldexp(1, -133))}, "float32"},
+	} {
+		file := floatFile(test.flags, test.size, test.offset, test.precision, test.format,
+			test.data)
+		nc, err := New(nopCloser{bytes.NewReader(file)})
+		if err != nil {
+			t.Error(test.name, err)
+			continue
+		}
+		vr, err := nc.GetVariable("x")
+		if err != nil {
+			t.Error(test.name, err)
+		} else if !reflect.DeepEqual(vr.Values, test.exp) {
+			t.Error(test.name, "got", vr.Values, "exp", test.exp)
+		}
+		vg, err := nc.GetVarGetter("x")
+		if err != nil {
+			t.Error(test.name, err)
+		} else if vg.GoType() != test.goType {
+			t.Error(test.name, "got type", vg.GoType(), "exp", test.goType)
+		}
+		nc.Close()
+	}
+}
+
+func TestFloatNaN(t *testing.T) {
+	for _, f := range []floatFormat{float16Format, bfloat16Format, x87Format, float24Format} {
+		f := f
+		for _, endian := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			attr := &attribute{length: 2, endian: endian, float: &f}
+			if f == x87Format {
+				attr.length = 16
+			} else if f == float24Format {
+				attr.length = 4
+			}
+			b := f.nan(attr)
+			f.littleEndian(b, endian)
+			if v := f.decode(b); !math.IsNaN(v) {
+				t.Error(f, endian, "got", v)
+			}
+		}
+	}
+}
+
+func TestBadFloats(t *testing.T) {
+	bad := float16Format
+	bad.normalization = 3
+	big := float16Format
+	big.mantissaLocation = 8
+	for _, test := range []struct {
+		name   string
+		flags  uint8
+		format floatFormat
+	}{
+		{"normalization", 0, bad},
+		{"mantissa", 0, big},
+		{"byte order", 0x40, float16Format},
+	} {
+		file := floatFile(test.flags, 2, 0, 16, test.format, make([]byte, 8))
+		nc, err := New(nopCloser{bytes.NewReader(file)})
+		if err == nil {
+			_, err = nc.GetVariable("x")
+			nc.Close()
+		}
+		if err != ErrFloatingPoint {
+			t.Error(test.name, "expected floating-point error, got", err)
+		}
+	}
+}
@@ -7,7 +7,6 @@
 package hdf5
 
 import (
-	"compress/zlib"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -41,7 +40,7 @@ const (
 	dtversionStandard = iota + 1 // not what the doc calls it
 	dtversionArray
 	dtversionPacked
-	dtversionV4 // undocumented V4 datatype version
+	dtversionV4 // written for the latest file format
 )
 
 // For disabling/enabling code
@@ -61,29 +60,17 @@ const (
 // and so the code is disabled.
 // They are vars so they can be unit tested.
 var (
-	// We don't implement any extended types, so we don't allow the superblock extension
-	parseSBExtension = false
-
 	// Bitfields are not part of NetCDF, but they are part of HDF5.
+	// They are allowed by SetNonNetCDFTypes.
 	allowBitfields = false
 
-	// References are not part of NetCDF, but they are part of HDF5.
-	allowReferences = false
-
 	// Allow a few non-standard things for testing, such as ignoring non-standard headers
 	allowNonStandard = false
 
-	// We have not fully implemented V3 of the superblock.  Enabling this allows some
-	// undocumented things to appear, like datatype V4, which we do not support.
-	superblockV3 = false
-
 	// We don't need to parse heap direct blocks
 	parseHeapDirectBlock = false
 )
 
-// undocumented datatype version 4 is enabled with superblockV3
-var maxDTVersion byte = 3
-
 // The hidden attribute which identifies what software wrote the file out.
 const ncpKey = "_NCProperties"
 
@@ -92,9 +79,9 @@ const (
 	filterDeflate = iota + 1 // zlib
 	filterShuffle
 	filterFletcher32
-	filterSzip        // not supported
-	filterNbit        // not supported
-	filterScaleOffset // not supported
+	filterSzip
+	filterNbit
+	filterScaleOffset
 )
 
 // data types
@@ -158,6 +145,7 @@ const (
 	typeDriverInfo
 	typeAttributeInfo
 	typeObjectReferenceCount
+	typeFileSpaceInfo
 )
 
 // Header type to string (htts)
@@ -184,10 +172,11 @@ var htts = []string{
 	"Symbol Table Message",
 	"Object Modification Time",
 	"B-tree ‘K’ Values",
-	// 20-22
+	// 20-23
 	"Driver Info",
 	"Attribute Info",
 	"Object Reference Count",
+	"File Space Info",
 }
 
 // types of data layout classes
@@ -207,8 +196,11 @@ type attribute struct {
 	children      []*attribute // for variable, compound, enums, vlen.
 	enumNames     []string
 	enumValues    []interface{}
-	shared        bool   // if shared
-	length        uint32 // datatype length
+	shared        bool         // if shared
+	length        uint32       // datatype length
+	bitPrecision  uint16       // for fixed-point and bitfields
+	bitOffset     uint16       // for bitfields
+	float         *floatFormat // for floating-point that isn't IEEE float32 or float64
 	layout        []uint64
 	dimensions    []uint64 // for compound
 	byteOffset    uint32   // for compound
@@ -218,6 +210,7 @@ type attribute struct {
 	endian        binary.ByteOrder
 	dtversion     uint8
 	creationOrder uint64
+	refType       uint8 // for references
 	df            io.Reader
 	noDf          bool
 }
@@ -239,18 +232,26 @@ type filter struct {
 
 // HDF5 implements api.Group for HDF5
 type HDF5 struct {
-	fname         string
-	fileSize      int64
-	file          *raFile
-	groupName     string // fully-qualified
-	rootAddr      uint64
-	root          *linkInfo
-	attribute     *linkInfo
-	rootObject    *object
-	groupObject   *object
-	sharedAttrs   map[uint64]*attribute
-	registrations map[string]interface{}
-	addrs         map[uint64]bool
+	fname          string
+	fileSize       int64
+	file           *raFile
+	sizeOfOffsets  uint8  // size of addresses, from the superblock
+	sizeOfLengths  uint8  // size of lengths, from the superblock
+	groupLeafK     uint16 // B-tree K values, from the superblock or its extension
+	groupInternalK uint16
+	chunkK         uint16
+	groupName      string // fully-qualified
+	rootAddr       uint64
+	root           *linkInfo
+	attribute      *linkInfo
+	rootObject     *object
+	groupObject    *object
+	sharedAttrs    map[uint64]*attribute
+	sharedMessages *sharedMessageTable // from the superblock extension
+	registrations  map[string]interface{}
+	addrs          map[uint64]bool
+	linked         *linkedFiles
+	openers        *openers
 }
 
 type linkInfo struct {
@@ -276,7 +277,12 @@ type object struct {
 	name             string
 	attrlist         []*attribute
 	dataBlocks       []dataBlock
+	virtual          []virtualMapping // for virtual datasets
+	external         []externalFile   // for data in external files
+	linkTarget       *linkTarget      // for soft and external links
 	filters          []filter
+	unfilteredEdges  bool  // partial edge chunks are stored unfiltered
+	indexType        uint8 // chunk indexing type of v4 layouts
 	objAttr          *attribute
 	fillValue        []byte // takes precedence over old fill value
 	fillValueOld     []byte
@@ -291,6 +297,17 @@ var fillValueUndefinedConstant = []byte{0xff}
 
 var logger = internal.NewLogger()
 
+// SetNonNetCDFTypes sets whether types that are valid HDF5, but not valid
+// NetCDF4, are read, and returns the old setting.  The default is not to,
+// and to return ErrBitfield for bitfields.  When set, bitfields are read as
+// unsigned integers of the same size, shifted down by their bit offset and
+// masked to their precision.
+func SetNonNetCDFTypes(allow bool) bool {
+	old := allowBitfields
+	allowBitfields = allow
+	return old
+}
+
 // Prevent usage of the standard log package.
 type log struct{}
 
@@ -360,6 +377,33 @@ func read64(r io.Reader) uint64 {
 	return data
 }
 
+// readAddr reads an address, which is the size of offsets in the superblock.
+// The undefined address is all ones, whatever its size.
+func (h5 *HDF5) readAddr(r io.Reader) uint64 {
+	return readUndefined(r, h5.sizeOfOffsets)
+}
+
+// readLength reads a length, which is the size of lengths in the superblock.
+func (h5 *HDF5) readLength(r io.Reader) uint64 {
+	return readEnc(r, h5.sizeOfLengths)
+}
+
+// readUnlimitedLength reads a length that can be unlimited, such as a
+// maximum dimension size.  An unlimited length is all ones, whatever its size.
+func (h5 *HDF5) readUnlimitedLength(r io.Reader) uint64 {
+	return readUndefined(r, h5.sizeOfLengths)
+}
+
+// readUndefined reads an integer of the given size, extending all ones to
+// 64 bits.
+func readUndefined(r io.Reader, size uint8) uint64 {
+	v := readEnc(r, size)
+	if size < 8 && v == 1<<(8*uint(size))-1 {
+		return invalidAddress
+	}
+	return v
+}
+
 func readEnc(r io.Reader, e uint8) uint64 {
 	switch e {
 	case 1:
@@ -408,33 +452,51 @@ func binaryToString(val uint64) string {
 	return strconv.FormatInt(int64(val), 2)
 }
 
+// The HDF5 library's default B-tree K values.  A node of a version 1 B-tree
+// has at most 2K children, and a symbol table leaf at most 2K symbols.
+const (
+	defaultGroupLeafK     = 4
+	defaultGroupInternalK = 16
+	defaultChunkK         = 32
+)
+
+func (h5 *HDF5) checkKValues() {
+	assertError(h5.groupLeafK > 0 && h5.groupInternalK > 0 && h5.chunkK > 0, ErrCorrupted,
+		fmt.Sprint("B-tree K values must be greater than zero: ", h5.groupLeafK, " ",
+			h5.groupInternalK, " ", h5.chunkK))
+}
+
 func (h5 *HDF5) readSuperblock() {
+	// The size of the superblock depends on the sizes of offsets and lengths,
+	// so first read up to them.
 	const (
-		v0SBSize  = 96  // v0, 56 in superblock + 40 in symbol table
-		v1SBSize  = 100 // v1,60 in superblock + 40 in symbol table
-		v23SBSize = 48  // v2&v3,48 in superblock, no symbol table
+		v01Prefix = 15 // signature, 5 versions and the 2 sizes
+		v23Prefix = 11 // signature, version and the 2 sizes
 	)
-	sbSize := int64(v23SBSize)
-	assertError(sbSize <= h5.fileSize, ErrCorrupted, "File is too small to have a superblock")
+	assertError(v23Prefix <= h5.fileSize, ErrCorrupted, "File is too small to have a superblock")
+	// Newer superblocks only have K values in the extension, if they aren't
+	// the defaults.
+	h5.groupLeafK = defaultGroupLeafK
+	h5.groupInternalK = defaultGroupInternalK
+	h5.chunkK = defaultChunkK
 
-	bf := h5.newSeek(0, sbSize)
+	bf := h5.newSeek(0, v23Prefix)
 
 	checkMagic(bf, 8, magic)
 
 	version := read8(bf)
 	logger.Info("superblock version=", version)
-	// adjust size now that we know the version
+	prefixSize := int64(v23Prefix)
 	switch version {
-	case 0:
-		bf = h5.newSeek(uint64(bf.Count()), v0SBSize-bf.Count())
-	case 1:
-		bf = h5.newSeek(uint64(bf.Count()), v1SBSize-bf.Count())
-	case 2:
+	case 0, 1:
+		prefixSize = v01Prefix
+		assertError(prefixSize <= h5.fileSize, ErrCorrupted,
+			"File is too small to have a superblock")
+		bf = h5.newSeek(uint64(bf.Count()), prefixSize-bf.Count())
+	case 2, 3:
 		break
 	default:
-		if !superblockV3 {
-			thrower.Throw(ErrVersion)
-		}
+		thrower.Throw(ErrVersion)
 	}
 	if version < 2 {
 		// we've read 9 bytes of a 64 byte chunk
@@ -454,22 +516,39 @@ func (h5 *HDF5) readSuperblock() {
 	}
 	b := read8(bf)
 	logger.Info("size of offsets=", b)
-	assertError(b == 8, ErrOffsetSize, "only accept 64-bit offsets")
+	assertError(b == 2 || b == 4 || b == 8, ErrOffsetSize,
+		fmt.Sprint("unsupported size of offsets: ", b))
+	h5.sizeOfOffsets = b
 
 	b = read8(bf)
 	logger.Info("size of lengths=", b)
-	checkVal(8, b, "only accept 64-bit lengths")
+	assertError(b == 2 || b == 4 || b == 8, ErrOffsetSize,
+		fmt.Sprint("unsupported size of lengths: ", b))
+	h5.sizeOfLengths = b
+
+	// The rest of the superblock has 4 addresses, and for versions 0 and 1,
+	// the root group symbol table entry.
+	sbSize := prefixSize + 4*int64(h5.sizeOfOffsets)
+	switch version {
+	case 0:
+		sbSize += 9 + h5.symbolTableEntrySize()
+	case 1:
+		sbSize += 13 + h5.symbolTableEntrySize()
+	default:
+		sbSize += 1 + 4 // flags and checksum
+	}
+	assertError(sbSize <= h5.fileSize, ErrCorrupted, "File is too small to have a superblock")
+	bf = h5.newSeek(uint64(prefixSize), sbSize-prefixSize)
 
 	switch version {
 	case 0, 1:
 		b = read8(bf)
 		checkVal(0, b, "reserved must always be zero")
 
-		s := read16(bf)
-		logger.Info("Group leaf node k", s)
-		assert(s == 4, "Group leaf node K assumed to be 4 always")
-		s = read16(bf)
-		logger.Info("Group internal node k", s)
+		h5.groupLeafK = read16(bf)
+		logger.Info("Group leaf node k", h5.groupLeafK)
+		h5.groupInternalK = read16(bf)
+		logger.Info("Group internal node k", h5.groupInternalK)
 
 		flags := read32(bf)
 		logger.Infof("file consistency flags=%s", binaryToString(uint64(flags)))
@@ -477,36 +556,42 @@ func (h5 *HDF5) readSuperblock() {
 			logger.Info("flags ignored", flags)
 		}
 		if version == 1 {
+			h5.chunkK = read16(bf)
+			logger.Info("Indexed storage internal node k", h5.chunkK)
 			s := read16(bf)
-			logger.Info("Indexed storage internal node k", s)
-			assert(s > 0, "must be greater than zero")
-			s = read16(bf)
 			checkVal(0, s, "reserved must be zero")
 		}
+		h5.checkKValues()
 	case 2, 3:
 		flags := read8(bf)
-		if version == 2 && flags != 0 {
-			logger.Warn("v2 ignores flags", flags)
-		}
 		logger.Infof("file consistency flags=%s", binaryToString(uint64(flags)))
+		switch {
+		case version == 2:
+			warnAssert(flags == 0, fmt.Sprint("v2 ignores flags ", flags))
+		default:
+			// Bit 0 is set while the file is open for writing, and bit 2
+			// while it is open for SWMR writing.
+			checkVal(0, flags&^0b101, "reserved flags must be zero")
+			warnAssert(flags == 0, "file is open for writing and may be inconsistent")
+		}
 	}
 
-	baseAddress := read64(bf)
+	baseAddress := h5.readAddr(bf)
 	logger.Info("base address=", baseAddress)
 	checkVal(0, baseAddress, "only support base address of zero")
 
 	sbExtension := invalidAddress
 	switch version {
 	case 0, 1:
-		fsIndexAddr := read64(bf)
+		fsIndexAddr := h5.readAddr(bf)
 		logger.Infof("free-space index address=%x", fsIndexAddr)
 		checkVal(invalidAddress, fsIndexAddr, "free-space index address not supported")
 	case 2, 3:
-		sbExtension = read64(bf)
+		sbExtension = h5.readAddr(bf)
 		logger.Infof("superblock extension address=%x", sbExtension)
 	}
 
-	eofAddr := read64(bf)
+	eofAddr := h5.readAddr(bf)
 	logger.Infof("end of file address=0x%x", eofAddr)
 	assertError(eofAddr <= uint64(h5.fileSize),
 		ErrTruncated,
@@ -517,12 +602,12 @@ func (h5 *HDF5) readSuperblock() {
 
 	switch version {
 	case 0, 1:
-		driverInfoAddress := read64(bf)
+		driverInfoAddress := h5.readAddr(bf)
 		logger.Infof("driver info address=0x%x", driverInfoAddress)
 
 		// get the root address
-		linkNameOffset := read64(bf) // link name offset
-		objectHeaderAddress := read64(bf)
+		linkNameOffset := h5.readAddr(bf) // link name offset
+		objectHeaderAddress := h5.readAddr(bf)
 		logger.Infof("Root group STE link name offset=%d header addr=0x%x",
 			linkNameOffset, objectHeaderAddress)
 		cacheType := read32(bf)
@@ -530,26 +615,22 @@ func (h5 *HDF5) readSuperblock() {
 		reserved := read32(bf)
 		checkVal(0, reserved, "reserved sb")
 		if cacheType == 1 {
-			btreeAddr := read64(bf)
-			heapAddr := read64(bf)
+			btreeAddr := h5.readAddr(bf)
+			heapAddr := h5.readAddr(bf)
 			logger.Infof("btree addr=0x%x heap addr=0x%x", btreeAddr, heapAddr)
 		}
 		h5.rootAddr = objectHeaderAddress
 	case 2, 3:
-		rootAddr := read64(bf)
+		rootAddr := h5.readAddr(bf)
 		logger.Infof("root group object header address=%d", rootAddr)
 		h5.rootAddr = rootAddr
-		h5.checkChecksum(0, 44)
+		h5.checkChecksum(0, int(sbSize-4))
 	}
 	if sbExtension != invalidAddress {
-		if parseSBExtension {
-			logger.Warn("parsing unsupported superblock extension")
-			obj := newObject()
-			h5.readDataObjectHeader(obj, sbExtension)
-		} else {
-			logger.Warn("superblock extension not supported")
-			thrower.Throw(ErrSuperblock)
-		}
+		// The extension's messages are read in sbextension.go and sohm.go.
+		logger.Info("reading superblock extension")
+		obj := newObject()
+		h5.readDataObjectHeader(obj, sbExtension)
 	}
 }
 
@@ -674,12 +755,19 @@ func (h5 *HDF5) readAttribute(obj *object, obf io.Reader, creationOrder uint64)
 	}
 	var dims []uint64
 	var count int64
-	if sharedSpace {
+	if sharedSpace && dataspaceSize == 10 && h5.sharedMessages != nil {
+		// Dataspaces are only shared in the shared message heap.
+		sf := h5.readSharedMessage(obj, newResetReader(bf, int64(dataspaceSize)),
+			typeDataspace)
+		assert(sf != nil, "shared dataspace not in heap")
+		dims, count = h5.readDataspace(sf)
+		attr.dimensions = dims
+	} else if sharedSpace {
 		// This flag does't seem to ever get set.
 		checkVal(datatypeSize, 10, "datatype size must be 10 for shared")
 		sVersion := read8(bf)
 		sType := read8(bf)
-		addr := read64(bf)
+		addr := h5.readAddr(bf)
 		logger.Infof("shared space version=%v type=%v addr=%x", sVersion, sType, addr)
 		fail("don't handle shared dataspaces")
 	} else {
@@ -693,7 +781,11 @@ func (h5 *HDF5) readAttribute(obj *object, obf io.Reader, creationOrder uint64)
 		logger.Info("count objects=", count)
 	}
 	logger.Info("sizeRem=", bf.Rem())
-	if !sharedType {
+	if sharedType && len(dtb) == 10 && dtb[0] == 3 && dtb[1] == sharedInHeap {
+		logger.Info("shared datatype in heap")
+		pf := h5.readSharedMessage(obj, newResetReaderFromBytes(dtb), typeDatatype)
+		printDatatype(h5, h5, pf, bf, count, attr)
+	} else if !sharedType {
 		pf := newResetReaderFromBytes(dtb)
 		printDatatype(h5, h5, pf, bf, count, attr)
 	} else {
@@ -729,7 +821,7 @@ func (h5 *HDF5) readAttribute(obj *object, obf io.Reader, creationOrder uint64)
 				fail("Unimplemented shared message feature")
 			}
 		}
-		addr := read64(bff)
+		addr := h5.readAddr(bff)
 		logger.Infof("shared type addr=0x%x", addr)
 		oa := h5.getSharedAttr(obj, addr)
 		oa.dimensions = dims
@@ -874,18 +966,11 @@ func (h5 *HDF5) readLinkDirectFrom(parent *object, obf io.Reader, length uint16,
 	}
 	logger.Infof("start with link name=%s lenlen=%d", string(linkName), lenlen)
 	logger.Info("remlen=", bf.Rem())
-	if linkType != 0 {
-		switch linkType {
-		case 1:
-			logger.Error("soft links not supported")
-		case 64:
-			logger.Error("external links not supported")
-		default:
-			logger.Error("unsupported link type", linkType)
-		}
-		thrower.Throw(ErrLinkType)
+	if linkType != linkHard {
+		addLink(parent, string(linkName), readLinkTarget(bf, linkType), co)
+		return
 	}
-	hardAddr := read64(bf)
+	hardAddr := h5.readAddr(bf)
 	if bf.Rem() > 0 {
 		checkZeroes(bf, int(bf.Rem()))
 	}
@@ -918,7 +1003,8 @@ func (h5 *HDF5) readBTreeInternal(parent *object, bta uint64, numRec uint64, rec
 	if depth > 1 {
 		sub = 2
 	}
-	bsize := int64(4+2) + int64(nr)*int64(recordSize) + (int64(nr)+1)*int64(8+1+sub)
+	bsize := int64(4+2) + int64(nr)*int64(recordSize) +
+		(int64(nr)+1)*int64(int(h5.sizeOfOffsets)+1+sub)
 	bf := h5.newSeek(bta, bsize)
 	checkMagic(bf, 4, "BTIN")
 	version := read8(bf)
@@ -935,8 +1021,8 @@ func (h5 *HDF5) readBTreeInternal(parent *object, bta uint64, numRec uint64, rec
 	logger.Info("count after=", bf.Count())
 
 	for i := uint64(0); i <= nr; i++ {
-		cnp := read64(bf) // child node pointer
-		len += 8
+		cnp := h5.readAddr(bf) // child node pointer
+		len += uint64(h5.sizeOfOffsets)
 		logger.Infof("cnp=0x%x", cnp)
 		// not sure this calculation is right
 		fixedSizeOverhead := uint32(10)
@@ -1085,15 +1171,15 @@ func (h5 *HDF5) readBTreeNode(parent *object, bta uint64, dtSize uint64,
 
 func (h5 *HDF5) readBTreeNodeAny(parent *object, bta uint64, isTop bool,
 	dtSize uint64, numberOfElements uint64, dsOffset uint64, dimensionality uint8) uint64 {
-	bf := h5.newSeek(bta, 24) // adjust later
+	bf := h5.newSeek(bta, 8+2*int64(h5.sizeOfOffsets))
 	checkMagic(bf, 4, "TREE")
 	logger.Infof("readBTreeNode addr 0x%x dtSize %d\n", bta, dtSize)
 	nodeType := read8(bf)
 	checkVal(1, nodeType, "raw data only")
 	nodeLevel := read8(bf)
 	entriesUsed := read16(bf)
-	leftAddress := read64(bf)
-	rightAddress := read64(bf)
+	leftAddress := h5.readAddr(bf)
+	rightAddress := h5.readAddr(bf)
 	logger.Infof("dim=%d nodeSize=%v type=%v level=%v entries=%v left=0x%x right=0x%x",
 		dimensionality,
 		dtSize,
@@ -1101,6 +1187,8 @@ func (h5 *HDF5) readBTreeNodeAny(parent *object, bta uint64, isTop bool,
 	if leftAddress != invalidAddress || rightAddress != invalidAddress {
 		assert(!isTop, "Siblings unexpected")
 	}
+	assertError(entriesUsed <= 2*h5.chunkK, ErrCorrupted,
+		fmt.Sprint("too many entries in chunk B-tree node: ", entriesUsed))
 	if nodeLevel > 0 {
 		logger.Infof("Start level %d", nodeLevel)
 	}
@@ -1108,8 +1196,11 @@ func (h5 *HDF5) readBTreeNodeAny(parent *object, bta uint64, isTop bool,
 	if dimensionality > 0 {
 		dimDataSize = 8 * int(dimensionality-1)
 	}
+	// Each key is the chunk size, filter mask and offsets, and each child
+	// is an address.
+	keySize := 16 + dimDataSize
 	bf = h5.newSeek(bta+uint64(bf.Count()),
-		int64((int(entriesUsed)*(24+dimDataSize))+16+dimDataSize))
+		int64(int(entriesUsed)*(keySize+int(h5.sizeOfOffsets))+keySize))
 	for i := uint16(0); i < entriesUsed; i++ {
 		sizeChunk := read32(bf)
 		filterMask := read32(bf)
@@ -1131,7 +1222,7 @@ func (h5 *HDF5) readBTreeNodeAny(parent *object, bta uint64, isTop bool,
 				offset)
 		}
 		checkVal(0, offset, "last offset must be zero")
-		addr := read64(bf)
+		addr := h5.readAddr(bf)
 
 		if nodeLevel == 0 {
 			logger.Infof("[%d] addr: 0x%x, %d", i, addr, sizeChunk)
@@ -1142,22 +1233,8 @@ func (h5 *HDF5) readBTreeNodeAny(parent *object, bta uint64, isTop bool,
 				numberOfElements, dsOffset, dimensionality)
 			continue
 		}
-		dso := uint64(0)
-		sizes := uint64(dtSize)
-		if parent.objAttr.dimensions != nil {
-			for d := int(dimensionality) - 2; d >= 0; d-- {
-				dso += offsets[d] * sizes
-				logger.Info("d=", d, "dim=", dimensionality, "parent dim=", parent.objAttr.dimensions)
-				sizes *= parent.objAttr.dimensions[d]
-			}
-		}
-		pending := dataBlock{addr, uint64(sizeChunk), 0, 0, filterMask, nil, nil}
-		pending.dsOffset = dso
-		pending.dsLength = numberOfElements * dtSize
-		pending.offsets = offsets
-		logger.Info("dsoffset", dso, "dslength", pending.dsLength, "dtsize", dtSize)
-		parent.dataBlocks = append(parent.dataBlocks, pending)
-		dsOffset += pending.dsLength
+		addChunk(parent, addr, uint64(sizeChunk), filterMask, offsets, dtSize, numberOfElements)
+		dsOffset += numberOfElements * dtSize
 	}
 	if nodeLevel > 0 {
 		logger.Infof("Done level %d", nodeLevel)
@@ -1186,10 +1263,10 @@ func (h5 *HDF5) readHeapDirectBlock(link *linkInfo, addr uint64, flags uint8,
 		version := read8(bf)
 		logger.Info("heap direct version=", version)
 		checkVal(0, version, "version")
-		heapHeaderAddr := read64(bf)
+		heapHeaderAddr := h5.readAddr(bf)
 		logger.Infof("heap header addr=0x%x", heapHeaderAddr)
 		blockOffset := uint64(read32(bf))
-		checksumOffset := 13 + (link.maxHeapSize / 8)
+		checksumOffset := 5 + int(h5.sizeOfOffsets) + (link.maxHeapSize / 8)
 		logger.Info("maxheapsize", link.maxHeapSize)
 		if link.maxHeapSize == 40 {
 			logger.Info("1 more byte")
@@ -1232,14 +1309,15 @@ func (h5 *HDF5) readRootBlock(link *linkInfo, bta uint64, flags uint8, nrows uin
 	startBlockSize := link.blockSize
 	maxBlockSize := link.maximumBlockSize
 	// bytes in block
-	// signature=4 version=1 heapaddr=8 blockoffset=(calc) + variables=(calc) + checksum
-	bSize := 4 + 1 + 8 + int64(link.maxHeapSize/8) + int64(nrows*width*8) + 4
+	// signature=4 version=1 heapaddr=(offset) blockoffset=(calc) + variables=(calc) + checksum
+	offsetSize := int64(h5.sizeOfOffsets)
+	bSize := 4 + 1 + offsetSize + int64(link.maxHeapSize/8) + int64(nrows*width)*offsetSize + 4
 	bf := h5.newSeek(bta, bSize)
 	checkMagic(bf, 4, "FHIB")
 	version := read8(bf)
 	logger.Info("heap root block version=", version)
 	checkVal(0, version, "heap root block version must be zero")
-	heapHeaderAddr := read64(bf)
+	heapHeaderAddr := h5.readAddr(bf)
 	logger.Infof("heap header addr=0x%x", heapHeaderAddr)
 	blockOffset := uint64(read32(bf))
 	logger.Infof("block offset=0x%x", blockOffset)
@@ -1278,7 +1356,7 @@ func (h5 *HDF5) readRootBlock(link *linkInfo, bta uint64, flags uint8, nrows uin
 			}
 		}
 		for j := 0; j < int(width); j++ {
-			childDirectBlockAddress := read64(bf)
+			childDirectBlockAddress := h5.readAddr(bf)
 			logger.Infof("child block address=0x%x row=%d maxrows=%d", childDirectBlockAddress,
 				i, maxRowsDirect)
 			if i < maxRowsDirect {
@@ -1334,22 +1412,27 @@ func checkVal(expected, actual interface{}, comment string) {
 }
 
 func (h5 *HDF5) readGlobalHeap(heapAddress uint64, index uint32) (remReader, uint64) {
-	bf := h5.newSeek(heapAddress, 16) // adjust size later
+	// The collection header and each object header are 8 bytes and a length,
+	// with the collection header padded to a multiple of 8 bytes.
+	headerSize := 8 + uint64(h5.sizeOfLengths)
+	collectionHeaderSize := (headerSize + 7) & ^uint64(0x7)
+	bf := h5.newSeek(heapAddress, int64(collectionHeaderSize)) // adjust size later
 	checkMagic(bf, 4, "GCOL")
 	version := read8(bf)
 	checkVal(1, version, "version")
 	checkZeroes(bf, 3)
-	csize := read64(bf) // collection size, including these fields
-	csize -= 16
+	csize := h5.readLength(bf) // collection size, including these fields
+	checkZeroes(bf, int(bf.Rem()))
+	csize -= collectionHeaderSize
 	bf = h5.newSeek(heapAddress+uint64(bf.Count()), int64(csize))
-	for csize >= 16 {
+	for csize >= headerSize {
 		hoi := read16(bf) // heap object index
 		rc := read16(bf)  // reference count
 		checkVal(0, rc, "refcount")
 		zero := read32(bf) // reserved
 		checkVal(0, zero, "zero")
-		osize := read64(bf) // object size)
-		csize -= 16
+		osize := h5.readLength(bf) // object size)
+		csize -= headerSize
 		assert(osize <= csize, "object size invalid")
 		if osize > 0 {
 			// adjust size
@@ -1373,7 +1456,9 @@ func (h5 *HDF5) readGlobalHeap(heapAddress uint64, index uint32) (remReader, uin
 }
 
 func (h5 *HDF5) readHeap(link *linkInfo) {
-	bf := h5.newSeek(link.heapAddress, 144)
+	// 22 bytes of fixed-size fields, 12 lengths and 3 addresses
+	headerSize := 22 + 12*int64(h5.sizeOfLengths) + 3*int64(h5.sizeOfOffsets)
+	bf := h5.newSeek(link.heapAddress, headerSize)
 	checkMagic(bf, 4, "FRHP")
 	version := read8(bf)
 	logger.Info("fractal heap version=", version)
@@ -1390,38 +1475,38 @@ func (h5 *HDF5) readHeap(link *linkInfo) {
 	}
 	maxSizeObjects := read32(bf)
 	logger.Infof("maxSizeManagedObjects=%d", maxSizeObjects)
-	nextHuge := read64(bf)
+	nextHuge := h5.readLength(bf)
 	logger.Infof("nextHuge=0x%x", nextHuge)
-	btAddr := read64(bf)
+	btAddr := h5.readAddr(bf)
 	logger.Infof("btree address=0x%x", btAddr)
-	amountFree := read64(bf)
+	amountFree := h5.readLength(bf)
 	logger.Infof("amount free=%d", amountFree)
-	freeSpaceAddr := read64(bf)
+	freeSpaceAddr := h5.readAddr(bf)
 	logger.Infof("free space address=0x%x", freeSpaceAddr)
-	amountManaged := read64(bf)
+	amountManaged := h5.readLength(bf)
 	logger.Infof("amount managed=%d", amountManaged)
-	amountAllocated := read64(bf)
+	amountAllocated := h5.readLength(bf)
 	logger.Infof("amount allocated=%d", amountAllocated)
-	directBlockOffset := read64(bf)
+	directBlockOffset := h5.readLength(bf)
 	logger.Infof("direct block offset=0x%x", directBlockOffset)
-	numberManaged := read64(bf)
+	numberManaged := h5.readLength(bf)
 	logger.Infof("number managed object=%d", numberManaged)
-	sizeHugeObjects := read64(bf)
+	sizeHugeObjects := h5.readLength(bf)
 	logger.Infof("size huge objects=%d", sizeHugeObjects)
-	numberHuge := read64(bf)
+	numberHuge := h5.readLength(bf)
 	logger.Infof("number huge objects=%d", numberHuge)
-	sizeTinyObjects := read64(bf)
+	sizeTinyObjects := h5.readLength(bf)
 	logger.Infof("size tiny objects=%d", sizeTinyObjects)
-	numberTiny := read64(bf)
+	numberTiny := h5.readLength(bf)
 	logger.Infof("number tiny objects=%d", numberTiny)
 	tableWidth := read16(bf)
 	logger.Infof("table width=%d", tableWidth)
 	checkVal(4, tableWidth, "table width must be 4")
 	link.tableWidth = tableWidth
-	startingBlockSize := read64(bf)
+	startingBlockSize := h5.readLength(bf)
 	link.blockSize = startingBlockSize
 	logger.Infof("starting block size=%d", startingBlockSize)
-	maximumBlockSize := read64(bf)
+	maximumBlockSize := h5.readLength(bf)
 	logger.Infof("maximum direct block size=%d", maximumBlockSize)
 	link.maximumBlockSize = maximumBlockSize
 	maximumHeapSize := read16(bf)
@@ -1430,12 +1515,12 @@ func (h5 *HDF5) readHeap(link *linkInfo) {
 	link.maxHeapSize = int(maximumHeapSize)
 	startingNumberRows := read16(bf)
 	logger.Infof("starting number rows=%d", startingNumberRows)
-	rootBlockAddress := read64(bf)
+	rootBlockAddress := h5.readAddr(bf)
 	logger.Infof("root block address=0x%x", rootBlockAddress)
 	rowsRootIndirect := read16(bf)
 	logger.Infof("rows in root indirect block=%d", rowsRootIndirect)
 	link.rowsRootIndirect = rowsRootIndirect
-	h5.checkChecksum(link.heapAddress, 142)
+	h5.checkChecksum(link.heapAddress, int(headerSize))
 	if rowsRootIndirect > 0 {
 		logger.Info("Reading indirect heap block")
 		h5.readRootBlock(link, rootBlockAddress, flags, rowsRootIndirect)
@@ -1449,19 +1534,25 @@ func (h5 *HDF5) readHeap(link *linkInfo) {
 }
 
 func (h5 *HDF5) readLocalHeap(addr uint64, offset uint64) string {
-	bf := h5.newSeek(addr, 32)
+	bf := h5.newSeek(addr, 8+2*int64(h5.sizeOfLengths)+int64(h5.sizeOfOffsets))
 	checkMagic(bf, 4, "HEAP")
 	version := read8(bf)
 	checkVal(0, version, "version 0 expected for local heap")
 	checkZeroes(bf, 3)
-	dsSize := read64(bf)
-	flOffset := read64(bf)
-	dsAddr := read64(bf)
+	dsSize := h5.readLength(bf)
+	flOffset := h5.readLength(bf)
+	dsAddr := h5.readAddr(bf)
 	logger.Infof("dsSize=%d flOffset=0x%x dsAddr=0x%x", dsSize, flOffset, dsAddr)
 	bff := h5.newSeek(dsAddr+offset, int64(dsSize)-int64(offset))
 	return readNullTerminatedName(bff, 0)
 }
 
+// symbolTableEntrySize is the size of a symbol table entry: two addresses,
+// the cache type, a reserved field and 16 bytes of scratch-pad space.
+func (h5 *HDF5) symbolTableEntrySize() int64 {
+	return 2*int64(h5.sizeOfOffsets) + 24
+}
+
 func (h5 *HDF5) readSymbolTableLeaf(parent *object, addr uint64, size uint64, heapAddr uint64) {
 	bf := h5.newSeek(addr, 8)
 	checkMagic(bf, 4, "SNOD")
@@ -1470,25 +1561,27 @@ func (h5 *HDF5) readSymbolTableLeaf(parent *object, addr uint64, size uint64, he
 	reserved := read8(bf)
 	checkVal(0, reserved, "reserved must be zero")
 	numSymbols := read16(bf)
+	assertError(numSymbols <= 2*h5.groupLeafK, ErrCorrupted,
+		fmt.Sprint("too many symbols in group leaf: ", numSymbols))
 
-	thisSize := int64(numSymbols) * 40
+	thisSize := int64(numSymbols) * h5.symbolTableEntrySize()
 	logger.Info("number of symbols", numSymbols, "size=", size, "thisSize=", thisSize)
 	bf = h5.newSeek(addr+uint64(bf.Count()), thisSize)
 	for i := 0; i < int(numSymbols); i++ {
 		logger.Info("Start: count=", bf.Count(), "rem=", bf.Rem())
 		assert(bf.Rem() >= 24,
 			fmt.Sprintln(i, "not enough space to read another entry", bf.Rem()))
-		linkNameOffset := read64(bf) // 8
+		linkNameOffset := h5.readAddr(bf)
 		logger.Infof("%d: link name offset=0x%x", i, linkNameOffset)
 		linkName := h5.readLocalHeap(heapAddr, linkNameOffset)
 		logger.Infof("%d: link name=%s", i, linkName)
 		assert(len(linkName) > 0, "namelen cannot be zero")
-		objectHeaderAddress := read64(bf) // 16
+		objectHeaderAddress := h5.readAddr(bf)
 		logger.Infof("local symbol table entry=%d header addr=0x%x",
 			linkNameOffset, objectHeaderAddress)
-		cacheType := read32(bf) // 20
+		cacheType := read32(bf)
 		logger.Info("cacheType", cacheType)
-		reserved2 := read32(bf) // 24
+		reserved2 := read32(bf)
 		checkVal(0, reserved2, "reserved sb")
 		assert(cacheType <= 2, "invalid cache type")
 		switch cacheType {
@@ -1498,14 +1591,17 @@ func (h5 *HDF5) readSymbolTableLeaf(parent *object, addr uint64, size uint64, he
 			logger.Info("no data is cached")
 			checkZeroes(bf, rem)
 		case 1:
-			btreeAddr := read64(bf)
-			nameHeapAddr := read64(bf)
+			btreeAddr := h5.readAddr(bf)
+			nameHeapAddr := h5.readAddr(bf)
 			logger.Infof("btree addr=0x%x name heap addr=0x%x", btreeAddr, nameHeapAddr)
+			checkZeroes(bf, 16-2*int(h5.sizeOfOffsets))
 		case 2:
 			offset := read32(bf)
 			checkZeroes(bf, 12)
 			logger.Info("Symbolic link offset", offset)
-			thrower.Throw(ErrLinkType)
+			path := h5.readLocalHeap(heapAddr, uint64(offset))
+			addLink(parent, linkName, &linkTarget{path: path}, 0)
+			continue
 		}
 		_, has := parent.children[linkName]
 		assert(!has, "duplicate object")
@@ -1531,36 +1627,57 @@ func (h5 *HDF5) readSymbolTableLeaf(parent *object, addr uint64, size uint64, he
 }
 
 func (h5 *HDF5) readSymbolTable(parent *object, addr uint64, heapAddr uint64) {
-	bf := h5.newSeek(addr, 52) // adjust later
+	h5.readSymbolTableNode(parent, addr, heapAddr, true /*isTop*/)
+}
+
+func (h5 *HDF5) readSymbolTableNode(parent *object, addr uint64, heapAddr uint64, isTop bool) {
+	bf := h5.newSeek(addr, 8+2*int64(h5.sizeOfOffsets))
 
 	checkMagic(bf, 4, "TREE") // "SNOD"
 	nodeType := read8(bf)
 	nodeLevel := read8(bf)
 	entriesUsed := read16(bf)
-	leftAddress := read64(bf)
-	rightAddress := read64(bf)
+	leftAddress := h5.readAddr(bf)
+	rightAddress := h5.readAddr(bf)
 	logger.Infof("type=%v level=%v entries=%v left=0x%x right=0x%x",
 		nodeType, nodeLevel, entriesUsed, leftAddress, rightAddress)
 	if nodeLevel > 0 {
 		logger.Infof("Start level %d", nodeLevel)
 	}
-	assert(leftAddress == invalidAddress && rightAddress == invalidAddress,
-		"Siblings unexpected")
+	if leftAddress != invalidAddress || rightAddress != invalidAddress {
+		assert(!isTop, "Siblings unexpected")
+	}
 	assert(nodeType == 0, "what we expect")
+	assertError(entriesUsed <= 2*h5.groupInternalK, ErrCorrupted,
+		fmt.Sprint("too many entries in group B-tree node: ", entriesUsed))
+	// Nodes above the leaves point to other nodes, instead of symbol table leaves.
+	readChild := h5.readSymbolTableLeaf
+	if nodeLevel > 0 {
+		readChild = func(parent *object, addr uint64, size uint64, heapAddr uint64) {
+			h5.readSymbolTableNode(parent, addr, heapAddr, false /*not top*/)
+		}
+	}
+	if entriesUsed == 0 {
+		logger.Info("empty symbol table")
+		return
+	}
 	type keyAddr struct {
 		key  uint64
 		addr uint64
 	}
 	keyAddrs := []keyAddr{}
-	bf = h5.newSeek(addr+uint64(bf.Count()), 16*int64(entriesUsed)+8)
+	// The keys are offsets into the local heap, which are lengths.
+	keySize := int64(h5.sizeOfLengths)
+	bf = h5.newSeek(addr+uint64(bf.Count()),
+		(keySize+int64(h5.sizeOfOffsets))*int64(entriesUsed)+keySize)
 	for i := uint16(0); i < entriesUsed; i++ {
-		key := read64(bf)
-		childAddr := read64(bf)
+		key := h5.readLength(bf)
+		childAddr := h5.readAddr(bf)
 		logger.Info("key, childaddr", key, childAddr)
 		keyAddrs = append(keyAddrs, keyAddr{key, childAddr})
 	}
 	// Get lastkey by last keyAddrs
-	//lastKey := read64(bf)
+	//lastKey := h5.readLength(bf)
 	lastKey := keyAddrs[len(keyAddrs)-1].key
 
 	sort.SliceStable(keyAddrs, func(i, j int) bool {
@@ -1584,7 +1701,7 @@ func (h5 *HDF5) readSymbolTable(parent *object, addr uint64, heapAddr uint64) {
 	for _, v := range keyAddrs {
 		if prevAddr != invalidAddress {
 			if lastKey >= prevKey {
-				h5.readSymbolTableLeaf(parent, prevAddr, (v.key - prevKey), heapAddr)
+				readChild(parent, prevAddr, (v.key - prevKey), heapAddr)
 			}
 		}
 		prevKey = v.key
@@ -1592,13 +1709,14 @@ func (h5 *HDF5) readSymbolTable(parent *object, addr uint64, heapAddr uint64) {
 	}
 	if prevAddr != invalidAddress {
 		if lastKey >= prevKey {
-			h5.readSymbolTableLeaf(parent, prevAddr, (lastKey - prevKey), heapAddr)
+			readChild(parent, prevAddr, (lastKey - prevKey), heapAddr)
 		}
 	}
 }
 
 func (h5 *HDF5) readBTree(parent *object, addr uint64) {
-	bf := h5.newSeek(addr, 36)
+	headerSize := 18 + int64(h5.sizeOfOffsets) + int64(h5.sizeOfLengths)
+	bf := h5.newSeek(addr, headerSize+4)
 	checkMagic(bf, 4, "BTHD")
 	version := read8(bf)
 	logger.Info("btree version=", version)
@@ -1615,14 +1733,14 @@ func (h5 *HDF5) readBTree(parent *object, addr uint64) {
 	logger.Info("splitPercent=", splitPercent)
 	mergePercent := read8(bf)
 	logger.Info("mergePercent=", mergePercent)
-	rootNodeAddress := read64(bf)
+	rootNodeAddress := h5.readAddr(bf)
 	logger.Infof("rootNodeAddress=0x%x", rootNodeAddress)
 	numRecRootNode := read16(bf)
 	logger.Info("numRecRootNode=", numRecRootNode)
-	numRec := read64(bf)
+	numRec := h5.readLength(bf)
 	logger.Info("numRec=", numRec)
 
-	h5.checkChecksum(addr, 34)
+	h5.checkChecksum(addr, int(headerSize))
 	// TODO: indirect blocks for leaf
 	if depth > 0 {
 		h5.readBTreeInternal(parent, rootNodeAddress, uint64(numRecRootNode), recordSize, depth, nodeSize)
@@ -1641,13 +1759,13 @@ func (h5 *HDF5) readLinkInfo(bf io.Reader) *linkInfo {
 		ci = read64(bf)
 		logger.Infof("ci=%x", ci)
 	}
-	fha := read64(bf)
+	fha := h5.readAddr(bf)
 	logger.Infof("fda=0x%x", fha)
-	bta := read64(bf)
+	bta := h5.readAddr(bf)
 	logger.Infof("bta=0x%x", bta)
 	coi := invalidAddress
 	if hasFlag8(flags, 1) {
-		coi = read64(bf)
+		coi = h5.readAddr(bf)
 		logger.Infof("coi=0x%x", coi)
 	}
 	return &linkInfo{
@@ -1694,13 +1812,13 @@ func (h5 *HDF5) readAttributeInfo(bf io.Reader) *linkInfo {
 		ci := read16(bf)
 		logger.Infof("ci=0x%x", ci)
 	}
-	fha := read64(bf)
+	fha := h5.readAddr(bf)
 	logger.Infof("fda=0x%x", fha)
-	bta := read64(bf)
+	bta := h5.readAddr(bf)
 	logger.Infof("bta=0x%x", bta)
 	co := invalidAddress
 	if hasFlag8(flags, 1) {
-		co = read64(bf)
+		co = h5.readAddr(bf)
 		logger.Infof("co=0x%x", co)
 	}
 	return &linkInfo{
@@ -1793,14 +1911,14 @@ func (h5 *HDF5) readDataspace(obf io.Reader) ([]uint64, int64) {
 	ret := make([]uint64, d)
 	count := int64(1)
 	for i := 0; i < int(d); i++ {
-		sz := read64(bf)
+		sz := h5.readLength(bf)
 		logger.Infof("dataspace dimension %d/%d size=%d", i, d, sz)
 		ret[i] = sz
 		count *= int64(sz)
 	}
 	if hasFlag8(flags, 0) {
 		for i := 0; i < int(d); i++ {
-			sz := read64(bf)
+			sz := h5.readUnlimitedLength(bf)
 			if sz == unlimitedSize {
 				logger.Infof("dataspace maximum dimension %d/%d UNLIMITED", i, d)
 			} else {
@@ -1811,7 +1929,7 @@ func (h5 *HDF5) readDataspace(obf io.Reader) ([]uint64, int64) {
 	if version == 1 && hasFlag8(flags, 1) {
 		// has not been seen in the wild
 		for i := 0; i < int(d); i++ {
-			pi := read64(bf)
+			pi := h5.readLength(bf)
 			logger.Infof("dataspace permutation index %d/%d = %d", i, d, pi)
 		}
 		fail("permutation indices not supported")
@@ -1863,11 +1981,8 @@ func (h5 *HDF5) readFilterPipeline(obj *object, obf io.Reader) {
 			pad := read32(bf)
 			checkVal(0, pad, "pad is not zero")
 		}
-		switch fiv {
-		case filterDeflate, filterShuffle, filterFletcher32:
-
-		default:
-			thrower.Throw(ErrUnsupportedFilter)
+		if getFilter(fiv) == nil {
+			failError(ErrUnsupportedFilter, fmt.Sprint("unsupported filter: ", fiv))
 		}
 		obj.filters = append(obj.filters, filter{fiv, cdv})
 	}
@@ -1877,7 +1992,6 @@ func (h5 *HDF5) readDataLayout(parent *object, obf io.Reader) {
 	bf := obf.(remReader)
 	logger.Infof("layout size=%d", bf.Rem())
 	version := read8(bf)
-	// V4 is quite complex and not supported yet, but we parse some of it
 	switch version {
 	case 3, 4:
 		break
@@ -1905,8 +2019,8 @@ func (h5 *HDF5) readDataLayout(parent *object, obf io.Reader) {
 				rawData:    b,
 			})
 	case classContiguous:
-		address := read64(bf)
-		size := read64(bf)
+		address := h5.readAddr(bf)
+		size := h5.readLength(bf)
 		logger.Infof("layout contiguous address=0x%x size=%d", address, size)
 		if address != invalidAddress {
 			logger.Infof("alloc blocks")
@@ -1921,7 +2035,7 @@ func (h5 *HDF5) readDataLayout(parent *object, obf io.Reader) {
 		dimensionality := read8(bf)
 		switch version {
 		case 3:
-			address := read64(bf)
+			address := h5.readAddr(bf)
 			logger.Infof("layout dimensionality=%d address=0x%x", dimensionality, address)
 			numberOfElements := uint64(1)
 			assertError(dimensionality >= 2,
@@ -1948,47 +2062,58 @@ func (h5 *HDF5) readDataLayout(parent *object, obf io.Reader) {
 
 		case 4:
 			logger.Infof("V4 flags=%x", flags)
-			if hasFlag8(flags, 0) {
-				logger.Info("do not apply filter to partial edge trunk flag")
-			}
-			if hasFlag8(flags, 1) {
-				logger.Info("filtered chunk for single chunk indexing")
-			}
+			parent.unfilteredEdges = hasFlag8(flags, 0)
 			logger.Info("v4 dimensionality", dimensionality)
+			assertError(dimensionality >= 2,
+				ErrDimensionality,
+				fmt.Sprint("Invalid dimensionality ", dimensionality))
 			encodedLen := read8(bf)
 			logger.Info("encoded length", encodedLen)
 			assert(encodedLen > 0 && encodedLen <= 8, "invalid encoded length")
-			layout := make([]uint64, int(dimensionality))
+			layout := make([]uint64, int(dimensionality)-1)
 			numberOfElements := uint64(1)
-
-			for i := 0; i < int(dimensionality); i++ {
-				size := readEnc(bf, encodedLen)
-				numberOfElements *= uint64(size)
+			for i := 0; i < int(dimensionality)-1; i++ {
+				size := readUint(bf, int(encodedLen))
+				numberOfElements *= size
 				layout[i] = size
 				logger.Info("layout", i, "size", size)
 			}
 			parent.objAttr.layout = layout
+			// The last dimension is the size of a data element
+			size := readUint(bf, int(encodedLen))
+			logger.Infof("layout data element size=%d, number of elements=%d", size,
+				numberOfElements)
+			ci := &chunkIndex{
+				parent:           parent,
+				layout:           layout,
+				dtSize:           size,
+				numberOfElements: numberOfElements,
+			}
 			cit := read8(bf)
 			logger.Info("chunk indexing type", cit)
-			assertError(cit >= 1 && cit <= 5, ErrLayout,
-				"bad value for chunk indexing type")
+			parent.indexType = cit
 			switch cit {
-			case 1:
-				// Single-chunk indexing
-				fchunksize := read64(bf)
-				logger.Info("chunk size = ", fchunksize)
-				if hasFlag8(flags, 0) {
-					filters := read32(bf)
-					logger.Info("filters = ", filters)
+			case chunkIndexSingle:
+				chunkSize := ci.chunkSize()
+				filterMask := uint32(0)
+				if hasFlag8(flags, 1) {
+					chunkSize = h5.readLength(bf)
+					filterMask = read32(bf)
+					logger.Info("filtered chunk size=", chunkSize, "filters=", filterMask)
 				}
-				failError(ErrVersion, "single chunk indexing not supported")
-			case 2:
-				logger.Info("implicit indexing")
-			case 3:
+				address := h5.readAddr(bf)
+				h5.readSingleChunk(ci, address, chunkSize, filterMask)
+			case chunkIndexImplicit:
+				address := h5.readAddr(bf)
+				h5.readImplicitIndex(ci, address)
+			case chunkIndexFixedArray:
 				pageBits := read8(bf)
 				logger.Info("fixed array pagebits=", pageBits)
-			case 4:
-				// Extensible-array indexing is a superblock v3 feature
+				address := h5.readAddr(bf)
+				h5.readFixedArray(ci, address)
+			case chunkIndexExtensibleArray:
+				// These are repeated in the extensible array header, which is
+				// where we get them from.
 				maxbits := read8(bf)
 				indexElements := read8(bf)
 				minPointers := read8(bf)
@@ -1997,33 +2122,24 @@ func (h5 *HDF5) readDataLayout(parent *object, obf io.Reader) {
 				logger.Info("extensible array mb=", maxbits,
 					"ie=", indexElements, "mp=", minPointers, "me=", minElements,
 					"pb=", pageBits)
-				failError(ErrVersion, "extensible array indexing not supported")
-			case 5:
-				// btree array indexing is a superblock v3 feature
+				address := h5.readAddr(bf)
+				h5.readExtensibleArray(ci, address)
+			case chunkIndexBTree2:
+				// These are repeated in the B-tree header too.
 				nodeSize := read32(bf)
 				splitPercent := read8(bf)
 				mergePercent := read8(bf)
 				logger.Info("b-tree indexing size=", nodeSize, "split%=", splitPercent, "merge%=", mergePercent)
-				failError(ErrVersion, "Version 2 B-tree array indexing not supported")
-			}
-			rem := bf.Rem()
-			var address uint64
-			switch rem {
-			case 8:
-				address = read64(bf)
-				logger.Infof("v4 address=0x%x", address)
-				rem -= 8
+				address := h5.readAddr(bf)
+				h5.readBTree2Chunks(ci, address)
 			default:
-				logger.Infof("Expected an 8-byte address, got a %d-byte one", rem)
-				b := make([]byte, rem)
-				read(bf, b)
-				fail(fmt.Sprint("Remaining bytes len=", rem, " val=", b))
+				failError(ErrLayout, fmt.Sprint("bad value for chunk indexing type: ", cit))
 			}
-			thrower.Throw(ErrLayout)
 		}
 	case classVirtual:
-		logger.Error("Virtual storage not supported")
-		thrower.Throw(ErrVirtualStorage)
+		address := h5.readAddr(bf)
+		index := read32(bf)
+		h5.readVirtualMappings(parent, address, index)
 	default:
 		fail("bad class")
 	}
@@ -2181,26 +2297,21 @@ func (h5 *HDF5) readCommon(obj *object, obf io.Reader, version uint8, ohFlags by
 		}
 		assert(uint64(size) <= (chunkSize-uint64(nReadSave)),
 			fmt.Sprint("too big: ", size, chunkSize, nReadSave))
-		if hasFlag8(hFlags, 1) {
-			// var d = make([]byte, size)
-			// read(bf, d)
-			f := newResetReader(bf, int64(size))
-			length := read16(f)
-			logger.Info("shared message length", length)
-			addr := read64(f)
-			logger.Infof("shared message addr = 0x%x", addr)
-			_ = h5.getSharedAttr(obj, addr)
-			checkZeroes(f, int(f.Rem()))
-
-			// TODO: we need to store addr and dtb somewhere, it will get used later
-			logger.Info("shared attr dtversion", obj.objAttr.dtversion)
-			// TODO: what else might we need to copy? dimensions?
-			continue
-		}
 		if version == 1 {
 			logger.Info("About to read v=", version)
 		}
 		f := newResetReader(bf, int64(size))
+		if hasFlag8(hFlags, 1) {
+			sf := h5.readSharedMessage(obj, f, headerType)
+			if sf == nil {
+				// TODO: we need to store addr and dtb somewhere, it will get used later
+				logger.Info("shared attr dtversion", obj.objAttr.dtversion)
+				// TODO: what else might we need to copy? dimensions?
+				continue
+			}
+			// The message is in the shared message heap, read it from there.
+			f = sf
+		}
 		switch headerType {
 		case typeNIL:
 			skip(f, int64(size))
@@ -2256,8 +2367,7 @@ func (h5 *HDF5) readCommon(obj *object, obf io.Reader, version uint8, ohFlags by
 			h5.readLinkDirectFrom(obj, f, size, 0)
 
 		case typeExternalDataFiles:
-			logger.Error("We don't handle external data files")
-			thrower.Throw(ErrExternal)
+			h5.readExternalFileList(obj, f)
 
 		case typeDataLayout:
 			obj.isGroup = false
@@ -2298,15 +2408,16 @@ func (h5 *HDF5) readCommon(obj *object, obf io.Reader, version uint8, ohFlags by
 			logger.Infof("Old mod time %s-%s-%s %s:%s:%s", year, month, day, hour, minute, second)
 
 		case typeSharedMessageTable:
-			assertError(false, ErrSuperblock, "shared message table not handled")
+			assert(h5.sharedMessages == nil, "already have a shared message table")
+			h5.sharedMessages = h5.readSharedMessageTable(f)
 
 		case typeObjectHeaderContinuation:
 			h5.readContinuation(obj, f, version, ohFlags)
 
 		case typeSymbolTableMessage:
-			btreeAddr := read64(f)
+			btreeAddr := h5.readAddr(f)
 			heapAddr := uint64(math.MaxUint64)
-			heapAddr = read64(f)
+			heapAddr = h5.readAddr(f)
 			logger.Infof("Symbol table btree=0x%x heap=0x%x", btreeAddr, heapAddr)
 
 			h5.readSymbolTable(obj, btreeAddr, heapAddr)
@@ -2328,10 +2439,13 @@ func (h5 *HDF5) readCommon(obj *object, obf io.Reader, version uint8, ohFlags by
 			obj.attr = h5.readAttributeInfo(f)
 
 		case typeBtreeKValues:
-			assertError(false, ErrSuperblock, "we don't handle btree k values")
+			h5.readKValues(f)
 
 		case typeDriverInfo:
-			fail("we don't handle driver info")
+			h5.readDriverInfo(f)
+
+		case typeFileSpaceInfo:
+			h5.readFileSpaceInfo(f)
 
 		case typeObjectReferenceCount:
 			v := read8(f)
@@ -2378,8 +2492,8 @@ func (h5 *HDF5) readCommon(obj *object, obf io.Reader, version uint8, ohFlags by
 }
 
 func (h5 *HDF5) readContinuation(obj *object, obf io.Reader, version uint8, ohFlags byte) {
-	offset := read64(obf)
-	size := read64(obf)
+	offset := h5.readAddr(obf)
+	size := h5.readLength(obf)
 	logger.Infof("continuation offset=%08x length=%d", offset, size)
 	bf := h5.newSeek(offset, int64(size))
 	chunkSize := size
@@ -2545,6 +2659,7 @@ func (h5 *HDF5) readDataObjectHeaderV1(obj *object, addr uint64) {
 // Close closes this group and closes any underlying files if they are no
 // longer being used by any other groups.
 func (h5 *HDF5) Close() {
+	h5.linked.close(h5)
 	if h5.file != nil {
 		h5.file.Close()
 	}
@@ -2571,54 +2686,15 @@ func canonicalizePath(s string) string {
 // The group can start with "/" for absolute names, or relative.
 func (h5 *HDF5) GetGroup(group string) (g api.Group, err error) {
 	defer thrower.RecoverError(&err)
-	var groupName string
-	group = canonicalizePath(group)
-	toDescend := h5.groupObject
-	h5groupName := h5.groupName
-	switch {
-	case strings.HasPrefix(group, "/"):
-		// Absolute path
-		if group != "/" {
-			groupName = group + "/"
-		} else {
-			groupName = "/"
-		}
-		toDescend = h5.rootObject
-		h5groupName = "/"
-	default:
-		// Relative path
-		groupName = h5.groupName + group + "/"
-	}
-
-	var sgDescend func(obj *object, group string) *object
-	sgDescend = func(obj *object, group string) *object {
-		if !obj.isGroup {
-			return nil
-		}
-		if group == groupName {
-			return obj
-		}
-		desc := groupName[len(group):]
-		spl := strings.Split(desc, "/")
-		o, has := obj.children[spl[0]]
-		if has {
-			ret := sgDescend(o, group+o.name+"/")
-			if ret != nil {
-				return ret
-			}
-		}
-		return nil
-	}
-
-	o := sgDescend(toDescend, h5groupName)
-	if o == nil {
+	loc := h5.lookup(h5.groupObject, h5.groupName, canonicalizePath(group), 0)
+	if loc == nil || !loc.obj.isGroup {
 		return nil, ErrNotFound
 	}
 
-	hg := *h5
-	hg.groupName = groupName
-	hg.groupObject = o
-	hg.file = h5.file.dup()
+	hg := *loc.h5
+	hg.groupName = loc.groupName()
+	hg.groupObject = loc.obj
+	hg.file = loc.h5.file.dup()
 	return api.Group(&hg), nil
 }
 
@@ -2667,7 +2743,9 @@ func New(file api.ReadSeekerCloser) (nc api.Group, err error) {
 		sharedAttrs:   make(map[uint64]*attribute),
 		registrations: make(map[string]interface{}),
 		addrs:         make(map[uint64]bool),
+		openers:       &openers{},
 	}
+	h5.linked = &linkedFiles{owner: h5, files: make(map[string]*HDF5)}
 	h5.readSuperblock()
 	assert(h5.rootAddr != invalidAddress, "No root address")
 	h5.rootObject = newObject()
@@ -2733,8 +2811,7 @@ func readAll(bf io.Reader, b []byte) (uint64, error) {
 	return tot, nil
 }
 
-func (h5 *HDF5) newRecordReader(obj *object, zlibFound bool, zlibParam uint32,
-	shuffleFound bool, shuffleParam uint32, fletcher32Found bool) remReader {
+func (h5 *HDF5) newRecordReader(obj *object) remReader {
 	nBlocks := len(obj.dataBlocks)
 	size := uint64(calcAttrSize(obj.objAttr))
 	if size == 0 {
@@ -2750,13 +2827,16 @@ func (h5 *HDF5) newRecordReader(obj *object, zlibFound bool, zlibParam uint32,
 			firstOffset = uint64(obj.objAttr.firstDim) * dimSize
 			lastOffset = uint64(obj.objAttr.lastDim) * dimSize
 			size = lastOffset - firstOffset
-			if needsLayoutReader(obj.objAttr) {
-				// The above calculation could be wrong due to layout chunks.
-				// The calculation is not simple and is a TODO.
-				logger.Info("var slices with chunked layout not fully implemented")
-			}
+			// Slices of chunked data are read with getHyperslab instead.
+			assert(len(obj.objAttr.layout) == 0, "slice of chunked data")
 		}
 	}
+	if obj.virtual != nil && len(obj.objAttr.dimensions) > 0 {
+		return h5.newVirtualReader(obj)
+	}
+	if obj.external != nil {
+		return h5.newExternalReader(obj, firstOffset, size)
+	}
 	if nBlocks == 0 {
 		logger.Info("No blocks, filling only", size, obj.objAttr.dimensions)
 		return makeFillValueReader(obj, nil, int64(size))
@@ -2782,8 +2862,6 @@ func (h5 *HDF5) newRecordReader(obj *object, zlibFound bool, zlibParam uint32,
 			skipEnd = offset + dsLength - lastOffset
 		}
 
-		assert(val.filterMask == 0,
-			fmt.Sprintf("filter mask = 0x%x", val.filterMask))
 		logger.Infof("block %d is 0x%x, len %d (%d, %d), mask 0x%x size %d",
 			i, val.offset, val.length, val.dsOffset, val.dsLength, val.filterMask, size)
 		var bf io.Reader
@@ -2792,33 +2870,7 @@ func (h5 *HDF5) newRecordReader(obj *object, zlibFound bool, zlibParam uint32,
 			thisSize := int64(dsLength - skipEnd)
 			bf = newResetReaderFromBytes(val.rawData[:thisSize])
 		} else {
-			logger.Infof("offset=0x%x length=%d offset+length=0x%x filesize=0x%x",
-				valOffset, val.length,
-				valOffset+val.length, h5.fileSize)
-			bf = h5.newSeek(valOffset, int64(val.length))
-			canSeek = true
-		}
-		if fletcher32Found {
-			logger.Info("Found fletcher32", val.length)
-			bf = newFletcher32Reader(bf, val.length)
-			canSeek = false
-		}
-		if zlibFound {
-			logger.Info("trying zlib")
-			if zlibParam != 0 {
-				logger.Info("zlib param", zlibParam)
-			}
-			zbf, err := zlib.NewReader(bf)
-			if err != nil {
-				failError(ErrUnknownCompression, fmt.Sprintf("unknown compression: %v", err))
-			}
-			bf = newResetReader(zbf, int64(dsLength))
-			canSeek = false
-		}
-		if shuffleFound {
-			logger.Info("using shuffle", dsLength)
-			bf = newUnshuffleReader(bf, dsLength, shuffleParam)
-			canSeek = false
+			bf, canSeek = h5.newBlockReader(obj, val)
 		}
 		if skipBegin > 0 {
 			if canSeek {
@@ -2862,9 +2914,21 @@ func (h5 *HDF5) newRecordReader(obj *object, zlibFound bool, zlibParam uint32,
 	return newResetReader(io.MultiReader(readers...), int64(size))
 }
 
-func (h5 *HDF5) newMaybeLayoutRecordReader(obj *object, zlibFound bool, zlibParam uint32, shuffleFound bool, shuffleParam uint32, fletcher32Found bool) io.Reader {
-	r := h5.newRecordReader(obj, zlibFound, zlibParam, shuffleFound,
-		shuffleParam, fletcher32Found)
+// newBlockReader returns a reader of the unfiltered contents of a data block
+// stored in the file, and whether that reader can be replaced by a seek.
+func (h5 *HDF5) newBlockReader(obj *object, val dataBlock) (io.Reader, bool) {
+	logger.Infof("offset=0x%x length=%d offset+length=0x%x filesize=0x%x",
+		val.offset, val.length,
+		val.offset+val.length, h5.fileSize)
+	bf, applied := applyFilters(obj, val.filterMask, h5.newSeek(val.offset, int64(val.length)))
+	if !applied {
+		return bf, true
+	}
+	return newResetReader(bf, int64(val.dsLength)), false
+}
+
+func (h5 *HDF5) newMaybeLayoutRecordReader(obj *object) io.Reader {
+	r := h5.newRecordReader(obj)
 	if needsLayoutReader(obj.objAttr) {
 		return newLayoutReader(r, obj)
 	}
@@ -2919,34 +2983,12 @@ func makeFillValueReader(obj *object, bf io.Reader, length int64) remReader {
 }
 
 func (h5 *HDF5) getData(obj *object) interface{} {
-	zlibFound := false
-	shuffleFound := false
-	fletcher32Found := false
-	var shuffleParam uint32
-	zlibParam := uint32(0)
-	for _, val := range obj.filters {
-		switch val.kind {
-		case filterDeflate:
-			zlibFound = true
-			if val.cdv != nil {
-				checkVal(1, len(val.cdv), "expected at most one zlib param")
-				zlibParam = val.cdv[0]
-			}
-		case filterShuffle:
-			shuffleFound = true
-			checkVal(1, len(val.cdv), "expected one shuffle param")
-			shuffleParam = val.cdv[0]
-
-		case filterFletcher32:
-			fletcher32Found = true
-		}
-	}
-	// TODO if !zlibFound && !shuffleFound && !fletcher32Found && isSlice {
+	// TODO if there are no filters && isSlice {
 	// we can seek first to save time.  Otherwise, it is slow inefficent reading to get to the
 	// place we want (or some complicated algorithm).
 	attr := obj.objAttr
 	sz := calcAttrSize(obj.objAttr)
-	bf := h5.newMaybeLayoutRecordReader(obj, zlibFound, zlibParam, shuffleFound, shuffleParam, fletcher32Found)
+	bf := h5.newMaybeLayoutRecordReader(obj)
 	logger.Info("about to getdataattr rem=", bf.(remReader).Rem(), "size=", sz)
 	if int64(sz) > bf.(remReader).Rem() {
 		length := int64(sz) - bf.(remReader).Rem()
@@ -2964,11 +3006,6 @@ func (h5 *HDF5) getData(obj *object) interface{} {
 			chunkSize = 0
 		default:
 			chunkSize = int64(sz) / int64(attr.dimensions[0])
-			if needsLayoutReader(attr) {
-				// The above calculation could be wrong due to layout chunks.
-				// The calculation is not simple and is a TODO.
-				logger.Info("var slices with chunked layout not fully implemented")
-			}
 		}
 		sliceSize := chunkSize * (attr.lastDim - attr.firstDim)
 		bff = newResetReader(bf, sliceSize)
@@ -2978,6 +3015,351 @@ func (h5 *HDF5) getData(obj *object) interface{} {
 	return getDataAttr(h5, h5, bff, *attr)
 }
 
+// getHyperslab gets the part of the object selected by the hyperslab.
+// Only the data that is needed is read: for contiguous data, just the bytes
+// in the hyperslab (in this file or external ones), for chunked data, just the
+// chunks that intersect it, and for virtual datasets, just the sources mapped
+// into it.
+func (h5 *HDF5) getHyperslab(obj *object, start, count, stride []int64) (interface{}, error) {
+	attr := obj.objAttr
+	stride, ok := internal.CheckHyperslab(attr.dimensions, start, count, stride)
+	if !ok {
+		return nil, errors.New("invalid hyperslab parameters")
+	}
+	if len(attr.dimensions) == 0 {
+		data := h5.getData(obj)
+		if data == nil {
+			return nil, ErrNotFound
+		}
+		return data, nil
+	}
+	buf := h5.readHyperslab(obj, start, count, stride)
+	dimensions := make([]uint64, len(count))
+	for i := range count {
+		dimensions[i] = uint64(count[i])
+	}
+	sliceAttr := *attr
+	sliceAttr.dimensions = dimensions
+	return getDataAttr(h5, h5, newResetReaderFromBytes(buf), sliceAttr), nil
+}
+
+// readInto reads the hyperslab into dst, a flat slice.  Integers and floats
+// are decoded straight into dst.  Other types are decoded as a
+// one-dimensional slice, which is copied.
+func (h5 *HDF5) readInto(obj *object, dst interface{}, start, count []int64) error {
+	attr := obj.objAttr
+	start, count, stride, err := internal.CheckReadInto(attr.dimensions, dst, start, count)
+	if err != nil {
+		return err
+	}
+	n := 1
+	for _, c := range count {
+		n *= int(c)
+	}
+	if ty := numberSliceType(attr); ty != nil {
+		if reflect.TypeOf(dst) != ty {
+			return fmt.Errorf("destination is %T, not %v", dst, ty)
+		}
+		buf := h5.readHyperslab(obj, start, count, stride)
+		if attr.class == typeFixedPoint {
+			decodeFixedPointInto(dst, buf, attr)
+		} else {
+			decodeFloatInto(dst, buf, attr)
+		}
+		return nil
+	}
+	buf := h5.readHyperslab(obj, start, count, stride)
+	dv := reflect.ValueOf(dst).Slice(0, n)
+	flatAttr := *attr
+	flatAttr.dimensions = []uint64{uint64(n)}
+	vals := reflect.ValueOf(getDataAttr(h5, h5, newResetReaderFromBytes(buf), flatAttr))
+	if vals.Type() != dv.Type() {
+		return fmt.Errorf("destination is %T, not %v", dst, vals.Type())
+	}
+	reflect.Copy(dv, vals)
+	return nil
+}
+
+// numberSliceType returns the type of slice that integers and floats with
+// the attribute are read as, or nil for other types.
+func numberSliceType(attr *attribute) reflect.Type {
+	switch attr.class {
+	case typeFixedPoint:
+		signed := map[uint32]interface{}{1: []int8{}, 2: []int16{}, 4: []int32{}, 8: []int64{}}
+		unsigned := map[uint32]interface{}{1: []uint8{}, 2: []uint16{}, 4: []uint32{}, 8: []uint64{}}
+		if attr.signed {
+			return reflect.TypeOf(signed[fixedPointSize(attr.length)])
+		}
+		return reflect.TypeOf(unsigned[fixedPointSize(attr.length)])
+	case typeFloatingPoint:
+		if attr.float != nil && !attr.float.isFloat32() || attr.float == nil && attr.length == 8 {
+			return reflect.TypeOf([]float64{})
+		}
+		return reflect.TypeOf([]float32{})
+	}
+	return nil
+}
+
+// decodeFixedPointInto decodes the integers in buf into dst, which is a
+// slice of the type given by numberSliceType.
+func decodeFixedPointInto(dst interface{}, buf []byte, attr *attribute) {
+	size := int(attr.length)
+	// The padding bits may be anything, so they are removed.  Negative
+	// values also need sign extension.
+	left := 64 - uint(attr.bitOffset) - uint(attr.bitPrecision)
+	right := 64 - uint(attr.bitPrecision)
+	var b [8]byte
+	value := func(i int) uint64 {
+		p := buf[i*size : (i+1)*size]
+		var v uint64
+		switch size {
+		case 1:
+			v = uint64(p[0])
+		case 2:
+			v = uint64(attr.endian.Uint16(p))
+		case 4:
+			v = uint64(attr.endian.Uint32(p))
+		case 8:
+			v = attr.endian.Uint64(p)
+		default:
+			b = [8]byte{}
+			if attr.endian == binary.BigEndian {
+				copy(b[8-size:], p)
+			} else {
+				copy(b[:size], p)
+			}
+			v = attr.endian.Uint64(b[:])
+		}
+		if attr.signed {
+			return uint64(int64(v<<left) >> right)
+		}
+		return v << left >> right
+	}
+	switch dst := dst.(type) {
+	case []int8:
+		for i := 0; i < len(buf)/size; i++ {
+			dst[i] = int8(value(i))
+		}
+	case []uint8:
+		for i := 0; i < len(buf)/size; i++ {
+			dst[i] = uint8(value(i))
+		}
+	case []int16:
+		for i := 0; i < len(buf)/size; i++ {
+			dst[i] = int16(value(i))
+		}
+	case []uint16:
+		for i := 0; i < len(buf)/size; i++ {
+			dst[i] = uint16(value(i))
+		}
+	case []int32:
+		for i := 0; i < len(buf)/size; i++ {
+			dst[i] = int32(value(i))
+		}
+	case []uint32:
+		for i := 0; i < len(buf)/size; i++ {
+			dst[i] = uint32(value(i))
+		}
+	case []int64:
+		for i := 0; i < len(buf)/size; i++ {
+			dst[i] = int64(value(i))
+		}
+	case []uint64:
+		for i := 0; i < len(buf)/size; i++ {
+			dst[i] = value(i)
+		}
+	}
+}
+
+// decodeFloatInto decodes the floats in buf into dst, which is a slice of
+// the type given by numberSliceType.
+func decodeFloatInto(dst interface{}, buf []byte, attr *attribute) {
+	size := int(attr.length)
+	f := attr.float
+	b := make([]byte, size)
+	decode := func(p []byte) float64 {
+		copy(b, p)
+		f.littleEndian(b, attr.endian)
+		return f.decode(b)
+	}
+	switch dst := dst.(type) {
+	case []float32:
+		for i := 0; i < len(buf)/size; i++ {
+			p := buf[i*size : (i+1)*size]
+			if f == nil {
+				dst[i] = math.Float32frombits(attr.endian.Uint32(p))
+			} else {
+				dst[i] = float32(decode(p))
+			}
+		}
+	case []float64:
+		for i := 0; i < len(buf)/size; i++ {
+			p := buf[i*size : (i+1)*size]
+			if f == nil {
+				dst[i] = math.Float64frombits(attr.endian.Uint64(p))
+			} else {
+				dst[i] = decode(p)
+			}
+		}
+	}
+}
+
+// readHyperslab returns the raw bytes of the part of the object selected by
+// the hyperslab, whose parameters have already been checked.
+func (h5 *HDF5) readHyperslab(obj *object, start, count, stride []int64) []byte {
+	attr := obj.objAttr
+	elemSize := int64(attr.length)
+	size := elemSize
+	for i := range count {
+		size *= count[i]
+	}
+	// Start with fill values, for data that was never written.
+	buf := make([]byte, size)
+	read(makeFillValueReader(obj, nil, size), buf)
+	switch {
+	case obj.virtual != nil:
+		h5.readVirtual(obj, start, count, stride, buf)
+	case len(attr.layout) > 0:
+		h5.readHyperslabChunks(obj, start, count, stride, buf)
+	case obj.external != nil:
+		ef := h5.newExternalFiles()
+		defer ef.close()
+		pos := int64(0)
+		internal.HyperslabRuns(attr.dimensions, start, count, stride,
+			func(offset, length int64) {
+				ef.read(obj, uint64(offset*elemSize), buf[pos:pos+length*elemSize])
+				pos += length * elemSize
+			})
+	default:
+		pos := int64(0)
+		internal.HyperslabRuns(attr.dimensions, start, count, stride,
+			func(offset, length int64) {
+				h5.readContiguous(obj, uint64(offset*elemSize), buf[pos:pos+length*elemSize])
+				pos += length * elemSize
+			})
+	}
+	return buf
+}
+
+// readContiguous reads the bytes at the given offset in unchunked data.
+// Bytes not present in the file are left alone.
+func (h5 *HDF5) readContiguous(obj *object, offset uint64, b []byte) {
+	end := offset + uint64(len(b))
+	for _, val := range obj.dataBlocks {
+		first := val.dsOffset
+		if first < offset {
+			first = offset
+		}
+		last := val.dsOffset + val.dsLength
+		if last > end {
+			last = end
+		}
+		if first >= last {
+			continue
+		}
+		dst := b[first-offset : last-offset]
+		if val.rawData != nil {
+			copy(dst, val.rawData[first-val.dsOffset:])
+			continue
+		}
+		read(h5.newSeek(val.offset+first-val.dsOffset, int64(len(dst))), dst)
+	}
+}
+
+// readHyperslabChunks copies the parts of the chunks that intersect the
+// hyperslab into buf.  Chunks that don't intersect it are not read.
+func (h5 *HDF5) readHyperslabChunks(obj *object, start, count, stride []int64, buf []byte) {
+	attr := obj.objAttr
+	for _, val := range obj.dataBlocks {
+		first, n := chunkSelection(attr.layout, val.offsets, start, count, stride)
+		if first == nil {
+			continue
+		}
+		bf, _ := h5.newBlockReader(obj, val)
+		chunk := make([]byte, val.dsLength)
+		read(bf, chunk)
+		copyChunk(buf, chunk, int64(attr.length), attr.layout, val.offsets,
+			start, count, stride, first, n)
+	}
+}
+
+// chunkSelection returns, for each dimension, the first hyperslab index that
+// falls in the chunk at the given offsets and the number of such indexes.
+// It returns nils if the chunk does not intersect the hyperslab.
+func chunkSelection(layout []uint64, offsets []uint64, start, count, stride []int64) (first, n []int64) {
+	first = make([]int64, len(count))
+	n = make([]int64, len(count))
+	for d := range count {
+		lo := int64(offsets[d])
+		hi := lo + int64(layout[d]) - 1
+		if count[d] == 0 || hi < start[d] {
+			return nil, nil
+		}
+		i := int64(0)
+		if lo > start[d] {
+			i = (lo - start[d] + stride[d] - 1) / stride[d]
+		}
+		j := (hi - start[d]) / stride[d]
+		if j >= count[d] {
+			j = count[d] - 1
+		}
+		if i > j {
+			return nil, nil
+		}
+		first[d] = i
+		n[d] = j - i + 1
+	}
+	return first, n
+}
+
+// copyChunk copies the selected elements of a chunk to their place in dst,
+// which holds the hyperslab.  first and n come from chunkSelection.
+func copyChunk(dst []byte, chunk []byte, elemSize int64, layout []uint64,
+	offsets []uint64, start, count, stride, first, n []int64) {
+	nDims := len(count)
+	chunkStride := make([]int64, nDims)
+	dstStride := make([]int64, nDims)
+	cs, ds := elemSize, elemSize
+	for d := nDims - 1; d >= 0; d-- {
+		chunkStride[d] = cs
+		dstStride[d] = ds
+		cs *= int64(layout[d])
+		ds *= count[d]
+	}
+	last := nDims - 1
+	index := make([]int64, nDims)
+	copy(index, first)
+	for {
+		// Copy one row of the innermost dimension.
+		srcOff, dstOff := int64(0), int64(0)
+		for d := 0; d < nDims; d++ {
+			pos := start[d] + index[d]*stride[d]
+			srcOff += (pos - int64(offsets[d])) * chunkStride[d]
+			dstOff += index[d] * dstStride[d]
+		}
+		if stride[last] == 1 {
+			copy(dst[dstOff:dstOff+n[last]*elemSize], chunk[srcOff:])
+		} else {
+			for k := int64(0); k < n[last]; k++ {
+				copy(dst[dstOff:dstOff+elemSize], chunk[srcOff:srcOff+elemSize])
+				srcOff += stride[last] * elemSize
+				dstOff += elemSize
+			}
+		}
+		d := last - 1
+		for ; d >= 0; d-- {
+			index[d]++
+			if index[d] < first[d]+n[d] {
+				break
+			}
+			index[d] = first[d]
+		}
+		if d < 0 {
+			return
+		}
+	}
+}
+
 func getDataAttr(hr heapReader, c caster, bf io.Reader, attr attribute) interface{} {
 	for i, v := range attr.dimensions {
 		logger.Info("dimension", i, "=", v)
@@ -3090,12 +3472,13 @@ loop:
 	return ptype
 }
 
-// Attributes returns the global attributes for this group.
+// Attributes returns the global attributes for this group.  For a group got
+// with GetGroup, they are the group's own attributes, not the root group's.
 func (h5 *HDF5) Attributes() api.AttributeMap {
 	// entry point, panic can bubble up
-	assert(h5.rootObject != nil, "nil root object")
-	h5.sortAttrList(h5.rootObject)
-	return h5.getAttributes(h5.rootObject.attrlist)
+	assert(h5.groupObject != nil, "nil group object")
+	h5.sortAttrList(h5.groupObject)
+	return h5.getAttributes(h5.groupObject.attrlist)
 }
 
 func (h5 *HDF5) hasAddr(addr uint64) bool {
@@ -3104,7 +3487,7 @@ func (h5 *HDF5) hasAddr(addr uint64) bool {
 
 func (h5 *HDF5) findVariable(varName string) *object {
 	obj, has := h5.groupObject.children[varName]
-	if !has {
+	if !has || obj.linkTarget != nil {
 		return nil
 	}
 	logger.Info("Found variable", varName, "group", h5.groupName, "child=", obj.name)
@@ -3188,7 +3571,7 @@ func (h5 *HDF5) findType(varName string) string {
 
 func (h5 *HDF5) getTypeObj(typeName string) (*object, bool) {
 	obj, has := h5.groupObject.children[typeName]
-	if !has {
+	if !has || obj.linkTarget != nil {
 		return nil, false
 	}
 	logger.Info("Found type", typeName, "group", h5.groupName, "child=", obj.name)
@@ -3218,7 +3601,7 @@ func (h5 *HDF5) GetType(typeName string) (string, bool) {
 // GetGoType gets the Go description of the type and sets the bool to true if found.
 func (h5 *HDF5) GetGoType(typeName string) (string, bool) {
 	obj, has := h5.groupObject.children[typeName]
-	if !has {
+	if !has || obj.linkTarget != nil {
 		return "", false
 	}
 	logger.Info("Found type", typeName, "group", h5.groupName, "child=", obj.name)
@@ -3243,7 +3626,7 @@ func (h5 *HDF5) GetGoType(typeName string) (string, bool) {
 func (h5 *HDF5) ListTypes() []string {
 	var ret []string
 	for typeName, obj := range h5.groupObject.children {
-		if obj.isGroup {
+		if obj.isGroup || obj.linkTarget != nil {
 			continue
 		}
 		hasClass := false
@@ -3281,7 +3664,7 @@ func (h5 *HDF5) ListDimensions() []string {
 	var ret []string
 	children := h5.groupObject.sortChildren()
 	for _, obj := range children {
-		if obj.isGroup {
+		if obj.isGroup || obj.linkTarget != nil {
 			continue
 		}
 		hasClass := false
@@ -3348,7 +3731,7 @@ func (h5 *HDF5) findSignature(signature string, name string, origNames map[strin
 		return ""
 	}
 	for varName, obj := range h5.groupObject.children {
-		if obj.isGroup {
+		if obj.isGroup || obj.linkTarget != nil {
 			continue
 		}
 		if origNames[varName] {
@@ -3493,7 +3876,7 @@ func (h5 *HDF5) getDimensions(obj *object) []string {
 			continue
 		}
 		logger.Infof("DIMENSION_LIST=%T 0x%x", a.value, a.value)
-		varLen := a.value.([][]uint64)
+		varLen := a.value.([][]ObjectReference)
 		for _, v := range varLen {
 			for i, addr := range v {
 				// Each dimension in the dimension list points to an object address in the global heap
@@ -3525,7 +3908,7 @@ func (h5 *HDF5) getDimensions(obj *object) []string {
 			logger.Infof("value is %T %v", a.value, a.value)
 			for k, v := range a.value.([]compound) {
 				vals2 := v
-				v0 := vals2[0].Val.(uint64)
+				v0 := vals2[0].Val.(ObjectReference)
 				v1 := vals2[1].Val.(int32)
 				logger.Infof("single ref %d 0x%x %d %s", k, v0, v1, ob.name)
 			}
@@ -3553,6 +3936,12 @@ func (h5 *HDF5) getDimensions(obj *object) []string {
 func (h5 *HDF5) GetVariable(varName string) (av *api.Variable, err error) {
 	err = ErrInternal
 	defer thrower.RecoverError(&err)
+	if hv, name := h5.resolveVariable(varName); hv != h5 {
+		if hv == nil {
+			return nil, ErrNotFound
+		}
+		return hv.GetVariable(name)
+	}
 	found := h5.findVariable(varName)
 	if found == nil {
 		logger.Infof("variable %s not found", varName)
@@ -3578,6 +3967,12 @@ func (h5 *HDF5) GetVariable(varName string) (av *api.Variable, err error) {
 // reduce memory usage.
 func (h5 *HDF5) GetVarGetter(varName string) (slicer api.VarGetter, err error) {
 	defer thrower.RecoverError(&err)
+	if hv, name := h5.resolveVariable(varName); hv != h5 {
+		if hv == nil {
+			return nil, ErrNotFound
+		}
+		return hv.GetVarGetter(name)
+	}
 	found := h5.findVariable(varName)
 	if found == nil {
 		logger.Warnf("variable %s not found", varName)
@@ -3607,7 +4002,21 @@ func (h5 *HDF5) GetVarGetter(varName string) (slicer api.VarGetter, err error) {
 		if end < begin {
 			return nil, errors.New("invalid slice parameters")
 		}
+		if len(found.objAttr.layout) > 0 {
+			// Chunked, so only read the chunks that intersect the slice.
+			dimensions := found.objAttr.dimensions
+			start := make([]int64, len(dimensions))
+			count := make([]int64, len(dimensions))
+			start[0] = begin
+			count[0] = end - begin
+			for i := 1; i < len(dimensions); i++ {
+				count[i] = int64(dimensions[i])
+			}
+			return h5.getHyperslab(found, start, count, nil)
+		}
 		fakeObj := *found
+		fakeAttr := *found.objAttr
+		fakeObj.objAttr = &fakeAttr
 		fakeObj.objAttr.isSlice = true
 		fakeObj.objAttr.firstDim = begin
 		fakeObj.objAttr.lastDim = end
@@ -3617,39 +4026,31 @@ func (h5 *HDF5) GetVarGetter(varName string) (slicer api.VarGetter, err error) {
 		}
 		return data, nil
 	}
+	getHyperslab := func(start, count, stride []int64) (interface{}, error) {
+		return h5.getHyperslab(found, start, count, stride)
+	}
+	readInto := func(dst interface{}, start, count []int64) error {
+		return h5.readInto(found, dst, start, count)
+	}
 	dims := h5.getDimensions(found)
 	attrs := h5.getAttributes(found.attrlist)
 	origNames := map[string]bool{varName: true}
 	ty := cdlTypeString(found.objAttr.class, h5, varName, found.objAttr, origNames)
 	origNames = map[string]bool{varName: true}
 	goTy := goTypeString(found.objAttr.class, h5, varName, found.objAttr, origNames)
-	return internal.NewSlicer(getSlice, d, dims, attrs, ty, goTy), nil
+	return internal.NewSlicer(getSlice, getHyperslab, readInto, d, dims, attrs, ty, goTy), nil
 }
 
-// ListSubgroups returns the names of the subgroups of this group.
+// ListSubgroups returns the names of the subgroups of this group, including
+// links to groups.
 func (h5 *HDF5) ListSubgroups() []string {
 	// entry point
-	// Only go one level down
 	var ret []string
-	var sgDescend func(obj *object, group string)
-	sgDescend = func(obj *object, group string) {
-		if !obj.isGroup {
-			return
-		}
-		if group != h5.groupName && strings.HasPrefix(group, h5.groupName) {
-			// Is a subgroup.  Get the basename of this child.
-			tail := group[len(h5.groupName):]
-			tail = tail[:len(tail)-1] // trim trailing slash
-			assertError(!strings.Contains(tail, "/"), ErrInternal, "trailing slash")
-			ret = append(ret, tail)
-			return
-		}
-		obj.sortChildren()
-		for _, o := range obj.children {
-			sgDescend(o, group+o.name+"/")
+	for _, o := range h5.groupObject.sortChildren() {
+		if o.isGroup || (o.linkTarget != nil && h5.isGroupLink(o)) {
+			ret = append(ret, o.name)
 		}
 	}
-	sgDescend(h5.rootObject, "/")
 	return ret
 }
 
@@ -3677,7 +4078,8 @@ func (obj *object) sortChildren() []*object {
 	return children
 }
 
-// ListVariables lists the variables in this group.
+// ListVariables lists the variables in this group, including links to
+// variables.
 func (h5 *HDF5) ListVariables() []string {
 	// entry point, panic can bubble up
 	var ret []string
@@ -3708,6 +4110,12 @@ func (h5 *HDF5) ListVariables() []string {
 						continue
 					}
 				}
+				if o.linkTarget != nil {
+					if h5.isVariableLink(o) {
+						ret = append(ret, o.name)
+					}
+					continue
+				}
 				found := h5.findVariable(o.name)
 				if found == nil {
 					continue
@@ -550,32 +550,7 @@ var fills2 = keyValList{
 
 // Set allowBitfields and return the old value
 func setBitfields(val bool) (prev bool) {
-	prev, allowBitfields = allowBitfields, val
-	return prev
-}
-
-// Set allowReferences and return the old value
-func setReferences(val bool) (prev bool) {
-	prev, allowReferences = allowReferences, val
-	return prev
-}
-
-// Set parseSbextension and return the old value
-func setSBExtension(val bool) (prev bool) {
-	prev, parseSBExtension = parseSBExtension, val
-	return prev
-}
-
-// Set superblockV3 and return the old value
-func setSuperblockV3(val bool) (prev bool) {
-	prev, superblockV3 = superblockV3, val
-	// Parsing V3 superblocks will cause us to run into the undocumanted
-	// V4 datatype.
-	maxDTVersion = dtversionPacked
-	if superblockV3 {
-		maxDTVersion = dtversionV4
-	}
-	return prev
+	return SetNonNetCDFTypes(val)
 }
 
 // Set parseHeapDirectBlock and return the old value
@@ -726,6 +701,53 @@ func TestTypesBE(t *testing.T) {
 	checkAll(t, nc, values2)
 }
 
+// The writer's version 2 superblock is changed to version 3, which also has
+// file consistency flags.
+func TestSuperblockV3(t *testing.T) {
+	fileName := "testdata/sbv3.nc"
+	_ = os.Remove(fileName)
+	defer os.Remove(fileName)
+	writeKeyVals(t, fileName, values)
+	orig, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const sbSize = 8 + 4 + 4*8 // up to the checksum
+	for _, test := range []struct {
+		flags uint8
+		ok    bool
+	}{
+		{0, true},
+		{0b101, true}, // open for SWMR writing
+		{0b10, false}, // reserved
+	} {
+		b := append([]byte{}, orig...)
+		b[8] = 3
+		b[11] = test.flags
+		sum := checksum(b[:sbSize])
+		b[sbSize], b[sbSize+1], b[sbSize+2], b[sbSize+3] =
+			byte(sum), byte(sum>>8), byte(sum>>16), byte(sum>>24)
+		err = ioutil.WriteFile(fileName, b, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nc, err := Open(fileName)
+		if !test.ok {
+			if err == nil {
+				t.Error("flags", test.flags, "should fail")
+				nc.Close()
+			}
+			continue
+		}
+		if err != nil {
+			t.Error("flags", test.flags, err)
+			continue
+		}
+		checkAll(t, nc, values)
+		nc.Close()
+	}
+}
+
 func TestGlobalAttrs(t *testing.T) {
 	genName := ncGen(t, "testattrs")
 	if genName == "" {
@@ -983,6 +1005,40 @@ func TestGroups(t *testing.T) {
 	}
 }
 
+// Each group has its own attributes, not those of the root group.
+func TestGroupAttributes(t *testing.T) {
+	genName := ncGen(t, "testgroupattrs")
+	if genName == "" {
+		t.Error(errorNcGen)
+		return
+	}
+	defer os.Remove(genName)
+	nc, err := Open(genName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer nc.Close()
+	if title, _ := nc.Attributes().Get("title"); title != "root" {
+		t.Error("root title", title)
+	}
+	if _, has := nc.Attributes().Get("count"); has {
+		t.Error("root has the group's count")
+	}
+	nca, err := nc.GetGroup("a")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer nca.Close()
+	if title, _ := nca.Attributes().Get("title"); title != "group a" {
+		t.Error("group title", title)
+	}
+	if count, _ := nca.Attributes().Get("count"); count != int32(2) {
+		t.Error("group count", count)
+	}
+}
+
 func TestByte(t *testing.T) {
 	genName := ncGen(t, "testbytes")
 	if genName == "" {
@@ -0,0 +1,1017 @@
+package hdf5
+
+// The writer produces files readable by both this package and the NetCDF-4
+// library.  It uses the version 2 superblock and version 2 object headers,
+// with links and attributes stored compactly in the object headers.
+// Variables are stored contiguously and dimensions are stored as HDF5
+// dimension scales, the same way the NetCDF-4 library does it.
+//
+// TODO: write unlimited dimensions
+// TODO: chunking and compression
+// TODO: dense attribute storage for attributes larger than 64K
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"reflect"
+
+	"github.com/batchatco/go-native-netcdf/internal"
+	"github.com/batchatco/go-native-netcdf/netcdf/api"
+	"github.com/batchatco/go-thrower"
+)
+
+const (
+	superblockSize = 48   // version 2 superblock, including the checksum
+	minHeapSize    = 4096 // minimum size of a global heap collection
+	maxHeapObjects = math.MaxUint16
+	maxHeapSize    = 1 << 20 // start a new collection after this size
+)
+
+// HDF5Writer writes out a NetCDF4 file in the HDF5 format.
+// It is also the writer for the root group.
+type HDF5Writer struct {
+	file      *os.File
+	root      *GroupWriter
+	nextDimID int32
+	heap      globalHeap
+	eofAddr   uint64
+}
+
+// GroupWriter writes out the variables, attributes and subgroups of a group.
+type GroupWriter struct {
+	hw       *HDF5Writer
+	name     string
+	parent   *GroupWriter
+	attrs    api.AttributeMap
+	vars     []*writerVar
+	dims     []*writerDim
+	subgroup []*GroupWriter
+	addr     uint64
+}
+
+type writerType struct {
+	class  uint8
+	size   uint32
+	signed bool
+}
+
+type writerDim struct {
+	name   string
+	length uint64
+	id     int32
+	group  *GroupWriter
+	coord  *writerVar // coordinate variable, if any
+	refs   []dimRef   // variables that use this dimension
+	addr   uint64
+}
+
+// The address of the dimension scale
+func (dim *writerDim) objectAddr() uint64 {
+	if dim.coord != nil {
+		return dim.coord.addr
+	}
+	return dim.addr
+}
+
+type dimRef struct {
+	v     *writerVar
+	index int32
+}
+
+type writerVar struct {
+	name       string
+	val        interface{}
+	ty         writerType
+	dimLengths []uint64
+	dims       []*writerDim
+	attrs      api.AttributeMap
+	coordOf    *writerDim
+	dimList    []heapID // global heap objects for the DIMENSION_LIST
+	strings    []heapID // global heap objects for string values
+	addr       uint64
+	dataAddr   uint64
+	dataSize   uint64
+}
+
+// An object header, its address and a function to produce it.
+// The size of the header does not depend on any addresses, which allows
+// the addresses to be computed in a first pass.
+type writerObject struct {
+	addr   *uint64
+	header func() []byte
+}
+
+// A header message
+type writerMessage struct {
+	ty    uint8
+	flags uint8
+	data  []byte
+}
+
+var (
+	typeFloat32 = writerType{typeFloatingPoint, 4, true}
+	typeVString = writerType{typeVariableLength, 16, false} // length, address, index
+)
+
+func write8(w io.Writer, v uint8) {
+	err := binary.Write(w, binary.LittleEndian, v)
+	thrower.ThrowIfError(err)
+}
+
+func write16(w io.Writer, v uint16) {
+	err := binary.Write(w, binary.LittleEndian, v)
+	thrower.ThrowIfError(err)
+}
+
+func write32(w io.Writer, v uint32) {
+	err := binary.Write(w, binary.LittleEndian, v)
+	thrower.ThrowIfError(err)
+}
+
+func write64(w io.Writer, v uint64) {
+	err := binary.Write(w, binary.LittleEndian, v)
+	thrower.ThrowIfError(err)
+}
+
+func writeAny(w io.Writer, any interface{}) {
+	err := binary.Write(w, binary.LittleEndian, any)
+	thrower.ThrowIfError(err)
+}
+
+func writeBytes(w io.Writer, b []byte) {
+	_, err := w.Write(b)
+	thrower.ThrowIfError(err)
+}
+
+func checksum(b []byte) uint32 {
+	return computeChecksumStream(newResetReaderFromBytes(b), len(b))
+}
+
+// OpenWriter creates the file and makes it available for writing
+// using AddVar, AddGlobalAttrs and CreateGroup.  The file must be closed to
+// actually write it out.
+func OpenWriter(fileName string) (*HDF5Writer, error) {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return nil, err
+	}
+	hw := &HDF5Writer{file: file}
+	hw.root = &GroupWriter{hw: hw}
+	return hw, nil
+}
+
+// AddGlobalAttrs adds global attributes to be written out.
+// Use util.NewOrderedMap to create attribute maps.
+func (hw *HDF5Writer) AddGlobalAttrs(attrs api.AttributeMap) error {
+	return hw.root.AddAttrs(attrs)
+}
+
+// AddVar adds a variable to the root group to be written out.
+// Use util.NewOrderedMap to create attribute maps for the variable.
+func (hw *HDF5Writer) AddVar(name string, vr api.Variable) error {
+	return hw.root.AddVar(name, vr)
+}
+
+// CreateGroup creates a subgroup of the root group.
+func (hw *HDF5Writer) CreateGroup(name string) (*GroupWriter, error) {
+	return hw.root.CreateGroup(name)
+}
+
+// Close writes all the data out and closes the file.
+func (hw *HDF5Writer) Close() (err error) {
+	defer thrower.RecoverError(&err)
+	if hw.file == nil {
+		return nil
+	}
+	bf := bufio.NewWriter(hw.file)
+	hw.writeAll(bf)
+	err = bf.Flush()
+	err2 := hw.file.Close()
+	if err == nil {
+		err = err2
+	} else {
+		// return the first error, log the second
+		logger.Error(err2)
+	}
+	hw.file = nil
+	return err
+}
+
+// AddAttrs adds attributes to the group to be written out.
+// Use util.NewOrderedMap to create attribute maps.
+func (gw *GroupWriter) AddAttrs(attrs api.AttributeMap) error {
+	if !hasValidNames(attrs) {
+		return ErrInvalidName
+	}
+	gw.attrs = attrs
+	return nil
+}
+
+// AddVar adds a variable to the group to be written out.
+// Use util.NewOrderedMap to create attribute maps for the variable.
+// Dimensions are looked up in this group and then its ancestors. If not found,
+// the dimension is created in this group.
+func (gw *GroupWriter) AddVar(name string, vr api.Variable) (err error) {
+	defer thrower.RecoverError(&err)
+	if !internal.IsValidNetCDFName(name) || gw.hasChild(name) {
+		return ErrInvalidName
+	}
+	if !hasValidNames(vr.Attributes) {
+		return ErrInvalidName
+	}
+	dimLengths, ty := getDimLengths(vr.Values)
+	checkDimLengths(reflect.ValueOf(vr.Values), dimLengths)
+	v := &writerVar{
+		name:       name,
+		val:        vr.Values,
+		ty:         ty,
+		dimLengths: dimLengths,
+		attrs:      vr.Attributes,
+	}
+	for i := range dimLengths {
+		var dimName string
+		if i < len(vr.Dimensions) {
+			dimName = vr.Dimensions[i]
+		}
+		if dimName == "" {
+			dimName = fmt.Sprintf("_dimid_%d", gw.hw.nextDimID)
+		}
+		if !internal.IsValidNetCDFName(dimName) {
+			return ErrInvalidName
+		}
+		dim := gw.findDim(dimName)
+		switch {
+		case dim == nil:
+			dim = &writerDim{
+				name:   dimName,
+				length: dimLengths[i],
+				id:     gw.hw.nextDimID,
+				group:  gw,
+			}
+			gw.hw.nextDimID++
+			gw.dims = append(gw.dims, dim)
+		case dim.length != dimLengths[i]:
+			return ErrDimensionSize
+		}
+		v.dims = append(v.dims, dim)
+	}
+	gw.vars = append(gw.vars, v)
+	return nil
+}
+
+// CreateGroup creates a subgroup of this group.
+func (gw *GroupWriter) CreateGroup(name string) (*GroupWriter, error) {
+	if !internal.IsValidNetCDFName(name) || gw.hasChild(name) {
+		return nil, ErrInvalidName
+	}
+	sub := &GroupWriter{hw: gw.hw, name: name, parent: gw}
+	gw.subgroup = append(gw.subgroup, sub)
+	return sub, nil
+}
+
+func (gw *GroupWriter) hasChild(name string) bool {
+	for _, v := range gw.vars {
+		if v.name == name {
+			return true
+		}
+	}
+	for _, g := range gw.subgroup {
+		if g.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (gw *GroupWriter) findDim(name string) *writerDim {
+	for g := gw; g != nil; g = g.parent {
+		for _, dim := range g.dims {
+			if dim.name == name {
+				return dim
+			}
+		}
+	}
+	return nil
+}
+
+func hasValidNames(am api.AttributeMap) bool {
+	if am == nil {
+		return true
+	}
+	for _, key := range am.Keys() {
+		if !internal.IsValidNetCDFName(key) {
+			return false
+		}
+	}
+	return true
+}
+
+func scalarType(goKind reflect.Kind) (writerType, bool) {
+	switch goKind {
+	case reflect.String:
+		return typeVString, true
+	case reflect.Int8:
+		return writerType{typeFixedPoint, 1, true}, true
+	case reflect.Uint8:
+		return writerType{typeFixedPoint, 1, false}, true
+	case reflect.Int16:
+		return writerType{typeFixedPoint, 2, true}, true
+	case reflect.Uint16:
+		return writerType{typeFixedPoint, 2, false}, true
+	case reflect.Int32:
+		return writerType{typeFixedPoint, 4, true}, true
+	case reflect.Uint32:
+		return writerType{typeFixedPoint, 4, false}, true
+	case reflect.Int64:
+		return writerType{typeFixedPoint, 8, true}, true
+	case reflect.Uint64:
+		return writerType{typeFixedPoint, 8, false}, true
+	case reflect.Float32:
+		return typeFloat32, true
+	case reflect.Float64:
+		return writerType{typeFloatingPoint, 8, true}, true
+	}
+	// not a scalar
+	return writerType{}, false
+}
+
+func getDimLengthsHelper(rv reflect.Value, dims []uint64) ([]uint64, writerType) {
+	t := rv.Type()
+	if ty, isScalar := scalarType(t.Kind()); isScalar {
+		return dims, ty
+	}
+	switch t.Kind() {
+	case reflect.Array, reflect.Slice:
+		vLen := uint64(rv.Len())
+		dims = append(dims, vLen)
+		if vLen == 0 {
+			ty, isScalar := scalarType(t.Elem().Kind())
+			if !isScalar {
+				// there are other dimensions and we can't tell the size of them.
+				thrower.Throw(ErrEmptySlice)
+			}
+			return dims, ty
+		}
+		return getDimLengthsHelper(rv.Index(0), dims)
+	}
+	logger.Info("Unknown type", t.Kind())
+	thrower.Throw(ErrUnknownType)
+	panic("internal error") // should never happen
+}
+
+func getDimLengths(val interface{}) ([]uint64, writerType) {
+	if val == nil {
+		thrower.Throw(ErrUnknownType)
+	}
+	return getDimLengthsHelper(reflect.ValueOf(val), make([]uint64, 0))
+}
+
+// Checks that the slices are not ragged.
+func checkDimLengths(val reflect.Value, dimLengths []uint64) {
+	if len(dimLengths) == 0 {
+		return
+	}
+	if uint64(val.Len()) != dimLengths[0] {
+		thrower.Throw(ErrDimensionSize)
+	}
+	if len(dimLengths) == 1 {
+		return
+	}
+	for i := 0; i < val.Len(); i++ {
+		checkDimLengths(val.Index(i), dimLengths[1:])
+	}
+}
+
+// Writes the values out in little-endian order.
+func writeValues(w io.Writer, val reflect.Value, dimLengths []uint64) {
+	if len(dimLengths) <= 1 {
+		writeAny(w, val.Interface())
+		return
+	}
+	for i := 0; i < val.Len(); i++ {
+		writeValues(w, val.Index(i), dimLengths[1:])
+	}
+}
+
+// Calls f for each string in val, in order.
+func eachString(val reflect.Value, f func(s string)) {
+	if val.Kind() == reflect.String {
+		f(val.String())
+		return
+	}
+	for i := 0; i < val.Len(); i++ {
+		eachString(val.Index(i), f)
+	}
+}
+
+func dataSize(dimLengths []uint64, ty writerType) uint64 {
+	size := uint64(ty.size)
+	for _, d := range dimLengths {
+		size *= d
+	}
+	return size
+}
+
+func writeDatatype(w io.Writer, ty writerType) {
+	const version = dtversionStandard << 4
+	switch ty.class {
+	case typeFixedPoint:
+		var signed uint8
+		if ty.signed {
+			signed = 0b1000
+		}
+		writeBytes(w, []byte{typeFixedPoint | version, signed, 0, 0})
+		write32(w, ty.size)
+		write16(w, 0)                 // bit offset
+		write16(w, uint16(ty.size*8)) // bit precision
+	case typeFloatingPoint:
+		// mantissa normalization is 2 (implied leading 1)
+		sign := uint8(ty.size*8 - 1)
+		writeBytes(w, []byte{typeFloatingPoint | version, 0b10 << 4, sign, 0})
+		write32(w, ty.size)
+		write16(w, 0)                 // bit offset
+		write16(w, uint16(ty.size*8)) // bit precision
+		if ty.size == 4 {
+			writeBytes(w, []byte{23, 8, 0, 23})
+			write32(w, 127)
+		} else {
+			writeBytes(w, []byte{52, 11, 0, 52})
+			write32(w, 1023)
+		}
+	case typeString:
+		// null-terminated, ASCII
+		writeBytes(w, []byte{typeString | version, 0, 0, 0})
+		write32(w, ty.size)
+	case typeReference:
+		// object reference
+		writeBytes(w, []byte{typeReference | version, 0, 0, 0})
+		write32(w, ty.size)
+	case typeVariableLength:
+		// variable-length string, null-terminated, ASCII, made of unsigned bytes
+		writeBytes(w, []byte{typeVariableLength | version, 1, 0, 0})
+		write32(w, ty.size)
+		writeDatatype(w, writerType{typeFixedPoint, 1, false})
+	default:
+		thrower.Throw(ErrInternal)
+	}
+}
+
+func writeDataspace(w io.Writer, dimLengths []uint64, isScalar bool) {
+	write8(w, 2) // version
+	write8(w, uint8(len(dimLengths)))
+	write8(w, 0) // flags: no maximum dimensions, they are the same as the sizes
+	if isScalar {
+		write8(w, 0)
+	} else {
+		write8(w, 1)
+	}
+	for _, d := range dimLengths {
+		write64(w, d)
+	}
+}
+
+func datatypeBytes(ty writerType) []byte {
+	var b bytes.Buffer
+	writeDatatype(&b, ty)
+	return b.Bytes()
+}
+
+func dataspaceBytes(dimLengths []uint64) []byte {
+	var b bytes.Buffer
+	writeDataspace(&b, dimLengths, len(dimLengths) == 0)
+	return b.Bytes()
+}
+
+func attributeMessage(name string, dtype []byte, dspace []byte, data []byte) writerMessage {
+	var b bytes.Buffer
+	write8(&b, 3) // version
+	write8(&b, 0) // flags
+	write16(&b, uint16(len(name)+1))
+	write16(&b, uint16(len(dtype)))
+	write16(&b, uint16(len(dspace)))
+	write8(&b, 0) // ASCII encoding
+	writeBytes(&b, []byte(name))
+	write8(&b, 0)
+	writeBytes(&b, dtype)
+	writeBytes(&b, dspace)
+	writeBytes(&b, data)
+	if b.Len() > math.MaxUint16 {
+		logger.Error("attribute", name, "is too large")
+		thrower.Throw(ErrAttribute)
+	}
+	return writerMessage{typeAttribute, 0, b.Bytes()}
+}
+
+// A NetCDF char attribute, or a null-terminated string for the ones used
+// by dimension scales.
+func stringAttribute(name string, value string, nullTerminated bool) writerMessage {
+	b := []byte(value)
+	if nullTerminated || len(b) == 0 {
+		b = append(b, 0)
+	}
+	dtype := datatypeBytes(writerType{typeString, uint32(len(b)), false})
+	return attributeMessage(name, dtype, dataspaceBytes(nil), b)
+}
+
+func userAttribute(name string, value interface{}) writerMessage {
+	if s, ok := value.(string); ok {
+		return stringAttribute(name, s, false)
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Slice {
+		ty, isScalar := scalarType(rv.Type().Elem().Kind())
+		if !isScalar || ty.class == typeVariableLength {
+			logger.Warnf("Unknown type %T, %#v=%#v", value, name, value)
+			thrower.Throw(ErrUnknownType)
+		}
+		var b bytes.Buffer
+		writeAny(&b, value)
+		dimLengths := []uint64{uint64(rv.Len())}
+		return attributeMessage(name, datatypeBytes(ty), dataspaceBytes(dimLengths), b.Bytes())
+	}
+	ty, isScalar := scalarType(rv.Kind())
+	if !isScalar {
+		logger.Warnf("Unknown type %T, %#v=%#v", value, name, value)
+		thrower.Throw(ErrUnknownType)
+	}
+	var b bytes.Buffer
+	writeAny(&b, value)
+	return attributeMessage(name, datatypeBytes(ty), dataspaceBytes(nil), b.Bytes())
+}
+
+func userAttributes(attrs api.AttributeMap) []writerMessage {
+	if attrs == nil {
+		return nil
+	}
+	var msgs []writerMessage
+	for _, k := range attrs.Keys() {
+		v, _ := attrs.Get(k)
+		msgs = append(msgs, userAttribute(k, v))
+	}
+	return msgs
+}
+
+func dimidAttribute(id int32) writerMessage {
+	var b bytes.Buffer
+	writeAny(&b, id)
+	return attributeMessage("_Netcdf4Dimid",
+		datatypeBytes(writerType{typeFixedPoint, 4, true}), dataspaceBytes(nil), b.Bytes())
+}
+
+// REFERENCE_LIST is a list of compounds of the variable referencing the
+// dimension and the index of the dimension in that variable.
+func (dim *writerDim) referenceListAttribute() writerMessage {
+	const size = 12
+	var dt bytes.Buffer
+	// compound, packed version
+	writeBytes(&dt, []byte{typeCompound | dtversionPacked<<4, 2, 0, 0})
+	write32(&dt, size)
+	writeBytes(&dt, []byte("dataset\x00"))
+	write8(&dt, 0) // offset
+	writeDatatype(&dt, writerType{typeReference, 8, false})
+	writeBytes(&dt, []byte("dimension\x00"))
+	write8(&dt, 8) // offset
+	writeDatatype(&dt, writerType{typeFixedPoint, 4, true})
+
+	var b bytes.Buffer
+	for _, ref := range dim.refs {
+		write64(&b, ref.v.addr)
+		write32(&b, uint32(ref.index))
+	}
+	return attributeMessage("REFERENCE_LIST", dt.Bytes(),
+		dataspaceBytes([]uint64{uint64(len(dim.refs))}), b.Bytes())
+}
+
+// DIMENSION_LIST is a variable-length list of references to the dimension scales.
+// The references are stored in the global heap.
+func (v *writerVar) dimensionListAttribute() writerMessage {
+	var dt bytes.Buffer
+	// variable-length sequence
+	writeBytes(&dt, []byte{typeVariableLength | dtversionStandard<<4, 0, 0, 0})
+	write32(&dt, 16) // length, address, index
+	writeDatatype(&dt, writerType{typeReference, 8, false})
+
+	var b bytes.Buffer
+	for _, id := range v.dimList {
+		writeHeapID(&b, 1, id) // one reference
+	}
+	return attributeMessage("DIMENSION_LIST", dt.Bytes(),
+		dataspaceBytes([]uint64{uint64(len(v.dims))}), b.Bytes())
+}
+
+func fillValueMessage(fillValue []byte) writerMessage {
+	var b bytes.Buffer
+	write8(&b, 3) // version
+	// space allocation time late, fill value written if set
+	flags := uint8(2 | 2<<2)
+	if fillValue == nil {
+		write8(&b, flags)
+		return writerMessage{typeDataStorageFillValue, 1, b.Bytes()}
+	}
+	write8(&b, flags|1<<5) // fill value defined
+	write32(&b, uint32(len(fillValue)))
+	writeBytes(&b, fillValue)
+	return writerMessage{typeDataStorageFillValue, 1, b.Bytes()}
+}
+
+func contiguousLayoutMessage(addr uint64, size uint64) writerMessage {
+	var b bytes.Buffer
+	write8(&b, 3) // version
+	write8(&b, classContiguous)
+	write64(&b, addr)
+	write64(&b, size)
+	return writerMessage{typeDataLayout, 0, b.Bytes()}
+}
+
+func datasetMessages(dimLengths []uint64, ty writerType, fillValue []byte) []writerMessage {
+	return []writerMessage{
+		{typeDataspace, 0, dataspaceBytes(dimLengths)},
+		{typeDatatype, 1, datatypeBytes(ty)},
+		fillValueMessage(fillValue),
+	}
+}
+
+func nameSizeFlags(length int) uint8 {
+	switch {
+	case length <= math.MaxUint8:
+		return 0
+	case length <= math.MaxUint16:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func writeEnc(w io.Writer, v uint64, flags uint8) {
+	switch flags {
+	case 0:
+		write8(w, uint8(v))
+	case 1:
+		write16(w, uint16(v))
+	case 2:
+		write32(w, uint32(v))
+	default:
+		write64(w, v)
+	}
+}
+
+func linkMessage(name string, creationOrder uint64, addr uint64) writerMessage {
+	var b bytes.Buffer
+	sizeFlags := nameSizeFlags(len(name))
+	write8(&b, 1)               // version
+	write8(&b, sizeFlags|0b100) // creation order present
+	write64(&b, creationOrder)
+	writeEnc(&b, uint64(len(name)), sizeFlags)
+	writeBytes(&b, []byte(name))
+	write64(&b, addr)
+	return writerMessage{typeLink, 0, b.Bytes()}
+}
+
+// Encodes a version 2 object header
+func objectHeader(msgs []writerMessage) []byte {
+	chunkSize := 0
+	for _, m := range msgs {
+		chunkSize += 4 + len(m.data)
+	}
+	var b bytes.Buffer
+	writeBytes(&b, []byte("OHDR"))
+	write8(&b, 2) // version
+	flags := nameSizeFlags(chunkSize)
+	if chunkSize > math.MaxUint32 {
+		flags = 3
+	}
+	write8(&b, flags)
+	writeEnc(&b, uint64(chunkSize), flags)
+	for _, m := range msgs {
+		write8(&b, m.ty)
+		write16(&b, uint16(len(m.data)))
+		write8(&b, m.flags)
+		writeBytes(&b, m.data)
+	}
+	write32(&b, checksum(b.Bytes()))
+	return b.Bytes()
+}
+
+func (gw *GroupWriter) header() []byte {
+	var links []writerMessage
+	for _, dim := range gw.dims {
+		if dim.coord == nil {
+			links = append(links, linkMessage(dim.name, uint64(len(links)), dim.addr))
+		}
+	}
+	for _, v := range gw.vars {
+		links = append(links, linkMessage(v.name, uint64(len(links)), v.addr))
+	}
+	for _, g := range gw.subgroup {
+		links = append(links, linkMessage(g.name, uint64(len(links)), g.addr))
+	}
+	var li bytes.Buffer
+	write8(&li, 0) // version
+	write8(&li, 1) // creation order tracked
+	write64(&li, uint64(len(links)))
+	write64(&li, invalidAddress) // no fractal heap, links are in the header
+	write64(&li, invalidAddress) // no name index
+	msgs := []writerMessage{
+		{typeLinkInfo, 0, li.Bytes()},
+		{typeGroupInfo, 0, []byte{0, 0}},
+	}
+	msgs = append(msgs, links...)
+	if gw.parent == nil {
+		if gw.attrs == nil {
+			msgs = append(msgs, stringAttribute(ncpKey, ncpValue, false))
+		} else if _, has := gw.attrs.Get(ncpKey); !has {
+			msgs = append(msgs, stringAttribute(ncpKey, ncpValue, false))
+		}
+	}
+	msgs = append(msgs, userAttributes(gw.attrs)...)
+	return objectHeader(msgs)
+}
+
+// The value of the _NCProperties attribute
+const ncpValue = "version=2,github.com/batchatco/go-native-netcdf=1.0"
+
+// Header for a dimension that has no coordinate variable.
+func (dim *writerDim) header() []byte {
+	dimLengths := []uint64{dim.length}
+	msgs := datasetMessages(dimLengths, typeFloat32, nil)
+	msgs = append(msgs, contiguousLayoutMessage(invalidAddress, dataSize(dimLengths, typeFloat32)))
+	msgs = append(msgs, stringAttribute("CLASS", "DIMENSION_SCALE", true))
+	msgs = append(msgs, stringAttribute("NAME",
+		fmt.Sprintf("This is a netCDF dimension but not a netCDF variable.%10d", dim.length),
+		true))
+	if len(dim.refs) > 0 {
+		msgs = append(msgs, dim.referenceListAttribute())
+	}
+	msgs = append(msgs, dimidAttribute(dim.id))
+	return objectHeader(msgs)
+}
+
+func (v *writerVar) fillValue() []byte {
+	if v.attrs == nil {
+		return nil
+	}
+	fv, has := v.attrs.Get("_FillValue")
+	if !has {
+		return nil
+	}
+	ty, isScalar := scalarType(reflect.ValueOf(fv).Kind())
+	if !isScalar || ty != v.ty || ty.class == typeVariableLength {
+		logger.Warn("_FillValue type doesn't match variable", v.name)
+		return nil
+	}
+	var b bytes.Buffer
+	writeAny(&b, fv)
+	return b.Bytes()
+}
+
+func (v *writerVar) header() []byte {
+	msgs := datasetMessages(v.dimLengths, v.ty, v.fillValue())
+	addr := v.dataAddr
+	if v.dataSize == 0 {
+		addr = invalidAddress
+	}
+	msgs = append(msgs, contiguousLayoutMessage(addr, v.dataSize))
+	msgs = append(msgs, userAttributes(v.attrs)...)
+	if dim := v.coordOf; dim != nil {
+		msgs = append(msgs, stringAttribute("CLASS", "DIMENSION_SCALE", true))
+		msgs = append(msgs, stringAttribute("NAME", v.name, true))
+		if len(dim.refs) > 0 {
+			msgs = append(msgs, dim.referenceListAttribute())
+		}
+		msgs = append(msgs, dimidAttribute(dim.id))
+	} else if len(v.dims) > 0 {
+		msgs = append(msgs, v.dimensionListAttribute())
+	}
+	return objectHeader(msgs)
+}
+
+// The global heap holds the dimension references for DIMENSION_LIST
+// attributes and the contents of strings.
+type globalHeap struct {
+	collections []*heapCollection
+}
+
+type heapCollection struct {
+	addr    uint64
+	size    uint64 // used, including the collection header
+	objects []heapObject
+}
+
+type heapObject struct {
+	size uint64
+	data func() []byte // called when writing, after addresses are known
+}
+
+type heapID struct {
+	collection *heapCollection // nil if there is no object
+	index      uint16
+}
+
+func (gh *globalHeap) add(size uint64, data func() []byte) heapID {
+	const headerSize = 16
+	n := len(gh.collections)
+	if n == 0 || len(gh.collections[n-1].objects) == maxHeapObjects ||
+		gh.collections[n-1].size >= maxHeapSize {
+		gh.collections = append(gh.collections, &heapCollection{size: headerSize})
+		n++
+	}
+	c := gh.collections[n-1]
+	c.objects = append(c.objects, heapObject{size, data})
+	c.size += headerSize + (size+7) & ^uint64(7)
+	return heapID{c, uint16(len(c.objects))}
+}
+
+// The size of the collection, including the free space.
+func (c *heapCollection) collectionSize() uint64 {
+	if c.size < minHeapSize {
+		return minHeapSize
+	}
+	return c.size
+}
+
+func (gh *globalHeap) layout(addr uint64) uint64 {
+	for _, c := range gh.collections {
+		c.addr = addr
+		addr += c.collectionSize()
+	}
+	return addr
+}
+
+func (gh *globalHeap) write(w io.Writer) {
+	for _, c := range gh.collections {
+		writeBytes(w, []byte("GCOL"))
+		write8(w, 1) // version
+		writeBytes(w, []byte{0, 0, 0})
+		write64(w, c.collectionSize())
+		for i, obj := range c.objects {
+			write16(w, uint16(i+1))
+			write16(w, 0) // reference count
+			write32(w, 0) // reserved
+			write64(w, obj.size)
+			data := obj.data()
+			assert(uint64(len(data)) == obj.size, "heap object size")
+			writeBytes(w, data)
+			writeBytes(w, make([]byte, ((obj.size+7) & ^uint64(7))-obj.size))
+		}
+		if free := c.collectionSize() - c.size; free > 0 {
+			// free space object, its size includes the header
+			write16(w, 0)
+			write16(w, 0)
+			write32(w, 0)
+			write64(w, free)
+			writeBytes(w, make([]byte, free-16))
+		}
+	}
+}
+
+// Writes the length of a variable-length item and where in the global heap it is.
+func writeHeapID(w io.Writer, length uint32, id heapID) {
+	write32(w, length)
+	if id.collection == nil {
+		write64(w, 0)
+		write32(w, 0)
+		return
+	}
+	write64(w, id.collection.addr)
+	write32(w, uint32(id.index))
+}
+
+// Finds the coordinate variables and which variables reference each dimension.
+// Puts the dimension references and strings in the global heap.
+func (gw *GroupWriter) resolve(heap *globalHeap) {
+	for _, dim := range gw.dims {
+		for _, v := range gw.vars {
+			if v.name != dim.name {
+				continue
+			}
+			if len(v.dims) != 1 || v.dims[0] != dim {
+				logger.Error("variable", v.name, "has the same name as a dimension")
+				thrower.Throw(ErrInvalidName)
+			}
+			dim.coord = v
+			v.coordOf = dim
+		}
+		for _, g := range gw.subgroup {
+			if dim.coord == nil && g.name == dim.name {
+				logger.Error("group", g.name, "has the same name as a dimension")
+				thrower.Throw(ErrInvalidName)
+			}
+		}
+	}
+	for _, v := range gw.vars {
+		if v.coordOf == nil {
+			for i, dim := range v.dims {
+				dim := dim
+				v.dimList = append(v.dimList, heap.add(8, func() []byte {
+					var b bytes.Buffer
+					write64(&b, dim.objectAddr())
+					return b.Bytes()
+				}))
+				dim.refs = append(dim.refs, dimRef{v, int32(i)})
+			}
+		}
+		if v.ty.class == typeVariableLength {
+			eachString(reflect.ValueOf(v.val), func(s string) {
+				if len(s) == 0 {
+					v.strings = append(v.strings, heapID{})
+					return
+				}
+				v.strings = append(v.strings, heap.add(uint64(len(s)), func() []byte {
+					return []byte(s)
+				}))
+			})
+		}
+	}
+	for _, g := range gw.subgroup {
+		g.resolve(heap)
+	}
+}
+
+func (gw *GroupWriter) objects(objs []writerObject) []writerObject {
+	objs = append(objs, writerObject{&gw.addr, gw.header})
+	for _, dim := range gw.dims {
+		if dim.coord == nil {
+			objs = append(objs, writerObject{&dim.addr, dim.header})
+		}
+	}
+	for _, v := range gw.vars {
+		objs = append(objs, writerObject{&v.addr, v.header})
+	}
+	for _, g := range gw.subgroup {
+		objs = g.objects(objs)
+	}
+	return objs
+}
+
+func (gw *GroupWriter) allVars(vars []*writerVar) []*writerVar {
+	vars = append(vars, gw.vars...)
+	for _, g := range gw.subgroup {
+		vars = g.allVars(vars)
+	}
+	return vars
+}
+
+func (v *writerVar) writeData(w io.Writer) {
+	if v.ty.class != typeVariableLength {
+		if len(v.dimLengths) == 0 {
+			writeAny(w, v.val)
+			return
+		}
+		writeValues(w, reflect.ValueOf(v.val), v.dimLengths)
+		return
+	}
+	i := 0
+	eachString(reflect.ValueOf(v.val), func(s string) {
+		writeHeapID(w, uint32(len(s)), v.strings[i])
+		i++
+	})
+}
+
+func (hw *HDF5Writer) writeSuperblock(w io.Writer) {
+	var b bytes.Buffer
+	writeBytes(&b, []byte(magic))
+	write8(&b, 2)               // version
+	write8(&b, 8)               // size of offsets
+	write8(&b, 8)               // size of lengths
+	write8(&b, 0)               // flags
+	write64(&b, 0)              // base address
+	write64(&b, invalidAddress) // no superblock extension
+	write64(&b, hw.eofAddr)
+	write64(&b, hw.root.addr)
+	write32(&b, checksum(b.Bytes()))
+	writeBytes(w, b.Bytes())
+}
+
+func (hw *HDF5Writer) writeAll(w io.Writer) {
+	hw.root.resolve(&hw.heap)
+	objs := hw.root.objects(nil)
+	vars := hw.root.allVars(nil)
+
+	// First pass computes the addresses
+	addr := uint64(superblockSize)
+	for _, obj := range objs {
+		*obj.addr = addr
+		addr += uint64(len(obj.header()))
+	}
+	addr = hw.heap.layout(addr)
+	for _, v := range vars {
+		v.dataSize = dataSize(v.dimLengths, v.ty)
+		v.dataAddr = addr
+		addr += v.dataSize
+	}
+	hw.eofAddr = addr
+
+	// Second pass writes everything out
+	hw.writeSuperblock(w)
+	for _, obj := range objs {
+		writeBytes(w, obj.header())
+	}
+	hw.heap.write(w)
+	for _, v := range vars {
+		v.writeData(w)
+	}
+}
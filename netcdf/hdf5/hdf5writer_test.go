@@ -0,0 +1,408 @@
+package hdf5
+
+import (
+	"os"
+	"os/exec"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/batchatco/go-native-netcdf/netcdf/api"
+	"github.com/batchatco/go-native-netcdf/netcdf/util"
+)
+
+func writeKeyVals(t *testing.T, fileName string, values keyValList) {
+	t.Helper()
+	hw, err := OpenWriter(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range values {
+		err = hw.AddVar(v.name, v.val)
+		if err != nil {
+			t.Fatal(v.name, err)
+		}
+	}
+	err = hw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriterTypes(t *testing.T) {
+	fileName := "testdata/writertypes.nc"
+	_ = os.Remove(fileName)
+	defer os.Remove(fileName)
+	writeKeyVals(t, fileName, values)
+
+	nc, err := Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	checkAll(t, nc, values)
+	props, has := nc.Attributes().Get(ncpKey)
+	if !has || props != ncpValue {
+		t.Error("_NCProperties missing", props)
+	}
+}
+
+func TestWriterAttributes(t *testing.T) {
+	fileName := "testdata/writerattrs.nc"
+	_ = os.Remove(fileName)
+	defer os.Remove(fileName)
+	attrs, err := util.NewOrderedMap(
+		[]string{"title", "i8", "ui16s", "f64s", "i64"},
+		map[string]interface{}{
+			"title": "writer test",
+			"i8":    int8(-3),
+			"ui16s": []uint16{1, 2, 3},
+			"f64s":  []float64{1.5, -2.5},
+			"i64":   int64(-1 << 40),
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	varAttrs, err := util.NewOrderedMap(
+		[]string{"units", "_FillValue"},
+		map[string]interface{}{
+			"units":      "K",
+			"_FillValue": float32(-999),
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hw, err := OpenWriter(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = hw.AddGlobalAttrs(attrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = hw.AddVar("temp", api.Variable{
+		Values:     []float32{280.5, 290.25},
+		Dimensions: []string{"x"},
+		Attributes: varAttrs,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = hw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nc, err := Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	got := nc.Attributes()
+	if len(got.Keys()) != len(attrs.Keys()) {
+		t.Error("global attribute keys got", got.Keys(), "exp", attrs.Keys())
+	}
+	checkAllAttrs(t, "global", got, attrs)
+	vr, err := nc.GetVariable("temp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAllAttrs(t, "temp", vr.Attributes, varAttrs)
+	if !reflect.DeepEqual(vr.Dimensions, []string{"x"}) {
+		t.Error("dimensions", vr.Dimensions)
+	}
+}
+
+func TestWriterDimensions(t *testing.T) {
+	fileName := "testdata/writerdims.nc"
+	_ = os.Remove(fileName)
+	defer os.Remove(fileName)
+	coords := keyValList{
+		{"lat", "float", api.Variable{
+			Values:     []float32{10, 20, 30},
+			Dimensions: []string{"lat"},
+			Attributes: nilMap,
+		}},
+		{"temp", "short", api.Variable{
+			Values:     [][]int16{{1, 2, 3}, {4, 5, 6}},
+			Dimensions: []string{"time", "lat"},
+			Attributes: nilMap,
+		}},
+		{"anon", "int", api.Variable{
+			Values:     []int32{7, 8},
+			Dimensions: []string{"time"},
+			Attributes: nilMap,
+		}},
+	}
+	writeKeyVals(t, fileName, coords)
+
+	nc, err := Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	checkAll(t, nc, coords)
+	dims := nc.ListDimensions()
+	if !reflect.DeepEqual(dims, []string{"time"}) {
+		t.Error("dimensions", dims)
+	}
+	length, has := nc.GetDimension("time")
+	if !has || length != 2 {
+		t.Error("time dimension", length, has)
+	}
+}
+
+func TestWriterGroups(t *testing.T) {
+	fileName := "testdata/writergroups.nc"
+	_ = os.Remove(fileName)
+	defer os.Remove(fileName)
+	hw, err := OpenWriter(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = hw.AddVar("top", api.Variable{
+		Values:     []int32{1, 2},
+		Dimensions: []string{"d"},
+		Attributes: nilMap,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := hw.CreateGroup("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrs, err := util.NewOrderedMap([]string{"name"},
+		map[string]interface{}{"name": "group a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.AddAttrs(attrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// uses the dimension from the parent group
+	err = a.AddVar("inner", api.Variable{
+		Values:     []float64{1.5, 2.5},
+		Dimensions: []string{"d"},
+		Attributes: nilMap,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := a.CreateGroup("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.AddVar("deep", api.Variable{
+		Values:     "hello",
+		Dimensions: []string{"len"},
+		Attributes: nilMap,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = hw.CreateGroup("a")
+	if err != ErrInvalidName {
+		t.Error("duplicate group should fail", err)
+	}
+	err = hw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nc, err := Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	if sg := nc.ListSubgroups(); !reflect.DeepEqual(sg, []string{"a"}) {
+		t.Error("subgroups", sg)
+	}
+	ga, err := nc.GetGroup("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ga.Close()
+	checkAllAttrs(t, "a", ga.Attributes(), attrs)
+	inner, err := ga.GetVariable("inner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(inner.Values, []float64{1.5, 2.5}) ||
+		!reflect.DeepEqual(inner.Dimensions, []string{"d"}) {
+		t.Error("inner", inner.Values, inner.Dimensions)
+	}
+	gb, err := nc.GetGroup("/a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gb.Close()
+	deep, err := gb.GetVariable("deep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deep.Values != "hello" {
+		t.Error("deep", deep.Values)
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	fileName := "testdata/writererrors.nc"
+	_ = os.Remove(fileName)
+	defer os.Remove(fileName)
+	hw, err := OpenWriter(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hw.Close()
+	err = hw.AddVar("a", api.Variable{
+		Values:     []int32{1, 2},
+		Dimensions: []string{"d"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = hw.AddVar("b", api.Variable{
+		Values:     []int32{1, 2, 3},
+		Dimensions: []string{"d"},
+	})
+	if err != ErrDimensionSize {
+		t.Error("expected dimension size error, got", err)
+	}
+	err = hw.AddVar("a", api.Variable{Values: int32(1)})
+	if err != ErrInvalidName {
+		t.Error("expected invalid name error, got", err)
+	}
+	err = hw.AddVar("c", api.Variable{Values: 1})
+	if err != ErrUnknownType {
+		t.Error("expected unknown type error, got", err)
+	}
+	err = hw.AddVar("d", api.Variable{Values: [][]int32{}})
+	if err != ErrEmptySlice {
+		t.Error("expected empty slice error, got", err)
+	}
+}
+
+func TestWriterStrings(t *testing.T) {
+	fileName := "testdata/writerstrings.nc"
+	_ = os.Remove(fileName)
+	defer os.Remove(fileName)
+	// big enough to need more than one global heap collection
+	long := make([]string, 300)
+	for i := range long {
+		long[i] = strings.Repeat(string(rune('a'+i%26)), 1+(i*37)%8000)
+	}
+	long[7] = ""
+	strs := keyValList{
+		{"long", "string", api.Variable{
+			Values:     long,
+			Dimensions: []string{"n"},
+			Attributes: nilMap,
+		}},
+		{"empty", "string", api.Variable{
+			Values:     "",
+			Dimensions: nil,
+			Attributes: nilMap,
+		}},
+	}
+	writeKeyVals(t, fileName, strs)
+
+	nc, err := Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	checkAll(t, nc, strs)
+}
+
+// copyGroup copies the attributes, variables and subgroups of g to gw.
+func copyGroup(t *testing.T, g api.Group, gw *GroupWriter) {
+	t.Helper()
+	err := gw.AddAttrs(g.Attributes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range g.ListVariables() {
+		vr, err := g.GetVariable(name)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		err = gw.AddVar(name, *vr)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+	}
+	for _, name := range g.ListSubgroups() {
+		sub, err := g.GetGroup(name)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		sw, err := gw.CreateGroup(name)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		copyGroup(t, sub, sw)
+		sub.Close()
+	}
+}
+
+// ncDumpLines returns the CDL that ncdump prints for the file, sorted so that
+// the order of the variables doesn't matter.  The name of the file is left
+// out, and so are the _FillValue attributes, which the writer always writes.
+func ncDumpLines(t *testing.T, fileName string) []string {
+	t.Helper()
+	out, err := exec.Command("ncdump", fileName).Output()
+	if err != nil {
+		t.Error("ncdump", fileName, err)
+		return nil
+	}
+	lines := strings.Split(string(out), "\n")
+	var kept []string
+	for _, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.Contains(line, ":_FillValue") {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	sort.Strings(kept)
+	return kept
+}
+
+// Files generated by ncgen, once read and written out again, give the same
+// CDL.
+func TestWriterCDL(t *testing.T) {
+	for _, fileNameNoExt := range []string{"testtypes", "testgroupattrs"} {
+		genName := ncGen(t, fileNameNoExt)
+		if genName == "" {
+			t.Error(errorNcGen)
+			continue
+		}
+		defer os.Remove(genName)
+		nc, err := Open(genName)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		writtenName := "testdata/" + fileNameNoExt + "-written.nc"
+		_ = os.Remove(writtenName)
+		defer os.Remove(writtenName)
+		hw, err := OpenWriter(writtenName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		copyGroup(t, nc, hw.root)
+		nc.Close()
+		err = hw.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp := ncDumpLines(t, genName)
+		got := ncDumpLines(t, writtenName)
+		if !reflect.DeepEqual(got, exp) {
+			t.Error(fileNameNoExt, "got CDL", got, "exp", exp)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -72,4 +73,24 @@ func TestLayout(t *testing.T) {
 			}
 		}
 	}
+
+	// Slices of the chunked variable only read the chunks they need.
+	slicer, err := gnc.GetVarGetter("a")
+	if err != nil {
+		t.Error("get chunked var getter -- not found")
+		return
+	}
+	for begin := 0; begin <= len(vals); begin += 3 {
+		for end := begin; end <= len(vals); end += 4 {
+			slice, err := slicer.GetSlice(int64(begin), int64(end))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !reflect.DeepEqual(slice, vals[begin:end]) {
+				t.Error("slice mismatch", begin, end, slice)
+				return
+			}
+		}
+	}
 }
@@ -0,0 +1,279 @@
+package hdf5
+
+// Soft and external links.
+//
+// A soft link names another object in the same file by its path, which is
+// relative to the group containing the link unless it starts with "/".  An
+// external link names a file and the absolute path of an object in it.
+// Links are kept in the tree as objects with a linkTarget, and are followed
+// when they are looked up, so links to objects that don't exist are allowed,
+// as in HDF5.
+//
+// Following a link can lead to other links.  Like the HDF5 library, only
+// a limited number of nested links are followed, which also stops cycles.
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/batchatco/go-native-netcdf/netcdf/api"
+	"github.com/batchatco/go-thrower"
+)
+
+// link types
+const (
+	linkHard     = 0
+	linkSoft     = 1
+	linkExternal = 64
+)
+
+// The HDF5 library's default limit on the number of nested links followed.
+const maxLinkDepth = 16
+
+type linkTarget struct {
+	file string // the file for external links
+	path string
+}
+
+// linkedFiles are the files opened to follow external links.  They are
+// closed along with the file that owns them.
+type linkedFiles struct {
+	owner *HDF5
+	lock  sync.Mutex
+	files map[string]*HDF5
+}
+
+// SetLinkOpener sets the function used to open the files that external links
+// in this file point to.  By default, names that aren't absolute are looked
+// up relative to the directory of the HDF5 file with the link, and then
+// relative to the current directory.  Setting it to nil restores the
+// default.  The files opened use the same openers as this one.
+func (h5 *HDF5) SetLinkOpener(opener ExternalOpener) {
+	h5.openers.lock.Lock()
+	defer h5.openers.lock.Unlock()
+	h5.openers.link = opener
+}
+
+func (h5 *HDF5) getLinkOpener() ExternalOpener {
+	if h5.openers == nil {
+		return nil
+	}
+	h5.openers.lock.RLock()
+	defer h5.openers.lock.RUnlock()
+	return h5.openers.link
+}
+
+// readLinkTarget reads the value of a soft or external link.
+func readLinkTarget(bf remReader, linkType byte) *linkTarget {
+	length := read16(bf)
+	assertError(int64(length) <= bf.Rem(), ErrCorrupted, "link value too long")
+	value := newResetReader(bf, int64(length))
+	switch linkType {
+	case linkSoft:
+		b := make([]byte, length)
+		read(value, b)
+		logger.Info("soft link to", string(b))
+		return &linkTarget{path: string(b)}
+	case linkExternal:
+		flags := read8(value)
+		checkVal(0, flags, "external link version and flags")
+		file := readNullTerminatedName(value, 0)
+		path := readNullTerminatedName(value, 0)
+		logger.Info("external link to", file, path)
+		return &linkTarget{file: file, path: path}
+	}
+	failError(ErrLinkType, fmt.Sprint("unsupported link type ", linkType))
+	panic("not reached")
+}
+
+// addLink adds a soft or external link to the parent group.
+func addLink(parent *object, name string, target *linkTarget, creationOrder uint64) {
+	_, has := parent.children[name]
+	assert(!has, "duplicate object")
+	obj := newObject()
+	obj.name = name
+	obj.creationOrder = creationOrder
+	obj.linkTarget = target
+	parent.children[name] = obj
+}
+
+// location is where an object was found by following a path.
+type location struct {
+	h5     *HDF5   // the file the object is in
+	parent *object // the group the object is in, nil for the root group
+	dir    string  // the name of the parent group, ending with "/"
+	obj    *object
+	name   string // the name of the object in its parent, empty for dir itself
+}
+
+// groupName returns the full name of the object, which should be a group,
+// ending with "/".
+func (loc *location) groupName() string {
+	if loc.name == "" {
+		return loc.dir
+	}
+	return loc.dir + loc.name + "/"
+}
+
+// lookup finds the object with the given path, following any links in it.
+// Relative paths start at the given group.  It returns nil if the object
+// doesn't exist.
+func (h5 *HDF5) lookup(group *object, groupName string, path string, depth int) *location {
+	loc := &location{h5: h5, dir: groupName, obj: group}
+	if strings.HasPrefix(path, "/") {
+		loc = &location{h5: h5, dir: "/", obj: h5.rootObject}
+	}
+	for _, name := range strings.Split(path, "/") {
+		if name == "" || name == "." {
+			continue
+		}
+		if !loc.obj.isGroup {
+			return nil
+		}
+		child, has := loc.obj.children[name]
+		if !has {
+			return nil
+		}
+		loc = &location{h5: loc.h5, parent: loc.obj, dir: loc.groupName(), obj: child,
+			name: name}
+		if child.linkTarget != nil {
+			loc = followLink(loc, depth+1)
+			if loc == nil {
+				return nil
+			}
+		}
+	}
+	return loc
+}
+
+// followLink returns the location of the object the link at loc points to.
+func followLink(loc *location, depth int) *location {
+	assertError(depth <= maxLinkDepth, ErrLinkCycle,
+		fmt.Sprint("too many nested links at ", loc.dir+loc.name))
+	target := loc.obj.linkTarget
+	if target.file == "" {
+		return loc.h5.lookup(loc.parent, loc.dir, target.path, depth)
+	}
+	ext := loc.h5.openLinkedFile(target.file)
+	if ext == nil {
+		return nil
+	}
+	return ext.lookup(ext.rootObject, "/", target.path, depth)
+}
+
+// group returns the group the object at loc is in.
+func (loc *location) group() *HDF5 {
+	hg := *loc.h5
+	hg.groupName = loc.dir
+	hg.groupObject = loc.parent
+	return &hg
+}
+
+// followChild follows the link that is a child of this group.  Errors are
+// returned rather than thrown, for listing the group.
+func (h5 *HDF5) followChild(obj *object) (loc *location, err error) {
+	defer thrower.RecoverError(&err)
+	loc = &location{h5: h5, parent: h5.groupObject, dir: h5.groupName, obj: obj,
+		name: obj.name}
+	return followLink(loc, 1), nil
+}
+
+// isGroupLink returns true if the link points to a group.
+func (h5 *HDF5) isGroupLink(obj *object) bool {
+	loc, err := h5.followChild(obj)
+	if err != nil {
+		logger.Warn("can't follow link", obj.name, err)
+		return false
+	}
+	return loc != nil && loc.obj.isGroup
+}
+
+// isVariableLink returns true if the link points to a variable.
+func (h5 *HDF5) isVariableLink(obj *object) bool {
+	loc, err := h5.followChild(obj)
+	if err != nil {
+		logger.Warn("can't follow link", obj.name, err)
+		return false
+	}
+	if loc == nil || loc.parent == nil {
+		return false
+	}
+	return loc.group().findVariable(loc.name) != nil
+}
+
+// resolveVariable returns the file and group of the named variable, with
+// its name in that group.  If the variable is a link, these are where the
+// link points to.  It returns nil if the link doesn't point anywhere.
+func (h5 *HDF5) resolveVariable(varName string) (*HDF5, string) {
+	obj, has := h5.groupObject.children[varName]
+	if !has || obj.linkTarget == nil {
+		return h5, varName
+	}
+	loc := followLink(&location{h5: h5, parent: h5.groupObject, dir: h5.groupName,
+		obj: obj, name: varName}, 1)
+	if loc == nil || loc.parent == nil {
+		return nil, ""
+	}
+	return loc.group(), loc.name
+}
+
+// openLinkedFile opens the file an external link points to, or returns the
+// one already opened.  It returns nil if the file can't be opened.
+func (h5 *HDF5) openLinkedFile(fileName string) *HDF5 {
+	h5.linked.lock.Lock()
+	defer h5.linked.lock.Unlock()
+	if ext, has := h5.linked.files[fileName]; has {
+		return ext
+	}
+	var file api.ReadSeekerCloser
+	var err error
+	if opener := h5.getLinkOpener(); opener != nil {
+		file, err = opener(h5.fname, fileName)
+	} else {
+		file, err = h5.openLinkedFileDefault(fileName)
+	}
+	var ext *HDF5
+	if err == nil {
+		var nc api.Group
+		nc, err = New(file)
+		if err == nil {
+			ext = nc.(*HDF5)
+			ext.openers = h5.openers
+		} else {
+			file.Close()
+		}
+	}
+	if err != nil {
+		logger.Warn("can't open external link file", fileName, err)
+	}
+	h5.linked.files[fileName] = ext
+	return ext
+}
+
+func (h5 *HDF5) openLinkedFileDefault(fileName string) (api.ReadSeekerCloser, error) {
+	if !filepath.IsAbs(fileName) && h5.fname != "" {
+		f, err := os.Open(filepath.Join(filepath.Dir(h5.fname), fileName))
+		if err == nil {
+			return f, nil
+		}
+	}
+	return os.Open(fileName)
+}
+
+// close closes the linked files, if h5 owns them.
+func (lf *linkedFiles) close(h5 *HDF5) {
+	if lf == nil || lf.owner != h5 {
+		return
+	}
+	lf.lock.Lock()
+	defer lf.lock.Unlock()
+	for _, ext := range lf.files {
+		if ext != nil {
+			ext.Close()
+		}
+	}
+	lf.files = make(map[string]*HDF5)
+}
@@ -0,0 +1,263 @@
+package hdf5
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/batchatco/go-native-netcdf/netcdf/api"
+)
+
+// The writer doesn't make links, so the tests add them to the tree after
+// the file is opened.
+
+func addTestLink(t *testing.T, h5 *HDF5, parent *object, name string, linkType byte,
+	value []byte) {
+	t.Helper()
+	var b indexBuilder
+	b.put(uint8(1), uint8(0x08), linkType, uint8(len(name)), name, uint16(len(value)), value)
+	msg := b.buf.Bytes()
+	h5.readLinkDirectFrom(parent, newResetReaderFromBytes(msg), uint16(len(msg)), 0)
+}
+
+func softLink(path string) []byte {
+	return []byte(path)
+}
+
+func externalLink(file, path string) []byte {
+	return append(append([]byte{0}, file+"\x00"...), path+"\x00"...)
+}
+
+func writeLinkFiles(t *testing.T, fileName, extName string) {
+	t.Helper()
+	hw, err := OpenWriter(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = hw.AddVar("x", api.Variable{Values: []int32{1, 2}, Dimensions: []string{"n"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw, err := hw.CreateGroup("y2026")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"m10", "d17"} {
+		gw, err = gw.CreateGroup(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = gw.AddVar("temp", api.Variable{Values: [][]int32{{10, 11}, {12, 13}},
+		Dimensions: []string{"y", "x"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = hw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hw, err = OpenWriter(extName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = hw.AddVar("lat", api.Variable{Values: []float32{-45, 0, 45},
+		Dimensions: []string{"lat"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = hw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func openLinks(t *testing.T, fileName string) *HDF5 {
+	t.Helper()
+	nc, err := Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h5 := nc.(*HDF5)
+	root := h5.rootObject
+	addTestLink(t, h5, root, "latest", linkSoft, softLink("/y2026/m10/d17"))
+	addTestLink(t, h5, root, "today", linkSoft, softLink("y2026/m10/d17/temp"))
+	addTestLink(t, h5, root.children["y2026"], "month", linkSoft, softLink("m10"))
+	addTestLink(t, h5, root, "loop1", linkSoft, softLink("loop2"))
+	addTestLink(t, h5, root, "loop2", linkSoft, softLink("/loop1"))
+	addTestLink(t, h5, root, "dangling", linkSoft, softLink("/nowhere"))
+	addTestLink(t, h5, root, "coords", linkExternal, externalLink("links2.nc", "/lat"))
+	addTestLink(t, h5, root, "shared", linkExternal, externalLink("links2.nc", "/"))
+	return h5
+}
+
+func TestLinks(t *testing.T) {
+	fileName := "testdata/links.nc"
+	extName := "testdata/links2.nc"
+	defer os.Remove(fileName)
+	defer os.Remove(extName)
+	writeLinkFiles(t, fileName, extName)
+	h5 := openLinks(t, fileName)
+	defer h5.Close()
+
+	temp := [][]int32{{10, 11}, {12, 13}}
+	lat := []float32{-45, 0, 45}
+	for _, name := range []string{"latest", "/latest/", "y2026/month/d17"} {
+		g, err := h5.GetGroup(name)
+		if err != nil {
+			t.Error(name, err)
+			continue
+		}
+		vr, err := g.GetVariable("temp")
+		if err != nil {
+			t.Error(name, err)
+		} else if !reflect.DeepEqual(vr.Values, temp) {
+			t.Error(name, "got", vr.Values, "exp", temp)
+		}
+		g.Close()
+	}
+
+	vr, err := h5.GetVariable("today")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(vr.Values, temp) {
+		t.Error("got", vr.Values, "exp", temp)
+	}
+	vr, err = h5.GetVariable("coords")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(vr.Values, lat) {
+		t.Error("got", vr.Values, "exp", lat)
+	}
+	vg, err := h5.GetVarGetter("coords")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slice, err := vg.GetSlice(1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(slice, lat[1:]) {
+		t.Error("got", slice, "exp", lat[1:])
+	}
+
+	g, err := h5.GetGroup("shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := g.ListVariables()
+	if !reflect.DeepEqual(vars, []string{"lat"}) {
+		t.Error("shared variables", vars)
+	}
+	g.Close()
+
+	subgroups := h5.ListSubgroups()
+	sort.Strings(subgroups)
+	expGroups := []string{"latest", "shared", "y2026"}
+	if !reflect.DeepEqual(subgroups, expGroups) {
+		t.Error("got", subgroups, "exp", expGroups)
+	}
+	vars = h5.ListVariables()
+	sort.Strings(vars)
+	expVars := []string{"coords", "today", "x"}
+	if !reflect.DeepEqual(vars, expVars) {
+		t.Error("got", vars, "exp", expVars)
+	}
+	if types := h5.ListTypes(); len(types) != 0 {
+		t.Error("unexpected types", types)
+	}
+}
+
+func TestLinkErrors(t *testing.T) {
+	fileName := "testdata/links.nc"
+	extName := "testdata/links2.nc"
+	defer os.Remove(fileName)
+	defer os.Remove(extName)
+	writeLinkFiles(t, fileName, extName)
+	h5 := openLinks(t, fileName)
+	defer h5.Close()
+
+	_, err := h5.GetGroup("loop1")
+	if err != ErrLinkCycle {
+		t.Error("expected link cycle, got", err)
+	}
+	_, err = h5.GetVariable("loop2")
+	if err != ErrLinkCycle {
+		t.Error("expected link cycle, got", err)
+	}
+	_, err = h5.GetGroup("dangling")
+	if err != ErrNotFound {
+		t.Error("expected not found, got", err)
+	}
+	_, err = h5.GetVariable("dangling")
+	if err != ErrNotFound {
+		t.Error("expected not found, got", err)
+	}
+	// A link to a group isn't a variable, and the reverse.
+	_, err = h5.GetVariable("latest")
+	if err != ErrNotFound {
+		t.Error("expected not found, got", err)
+	}
+	_, err = h5.GetGroup("today")
+	if err != ErrNotFound {
+		t.Error("expected not found, got", err)
+	}
+}
+
+func TestLinkOpener(t *testing.T) {
+	fileName := "testdata/links.nc"
+	extName := "testdata/links2.nc"
+	defer os.Remove(fileName)
+	defer os.Remove(extName)
+	writeLinkFiles(t, fileName, extName)
+	ext, err := ioutil.ReadFile(extName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(extName)
+
+	var opened []string
+	h5 := openLinks(t, fileName)
+	defer h5.Close()
+	// Groups share the opener with the file, even ones gotten before it's set.
+	root, err := h5.GetGroup("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+	h5.SetLinkOpener(func(path string, name string) (api.ReadSeekerCloser, error) {
+		if path != fileName {
+			t.Error("referring path", path)
+		}
+		opened = append(opened, name)
+		return nopCloser{bytes.NewReader(ext)}, nil
+	})
+	for i := 0; i < 2; i++ {
+		vr, err := root.GetVariable("coords")
+		if err != nil {
+			t.Fatal(err)
+		}
+		lat := []float32{-45, 0, 45}
+		if !reflect.DeepEqual(vr.Values, lat) {
+			t.Error("got", vr.Values, "exp", lat)
+		}
+	}
+	// The file is only opened once.
+	if !reflect.DeepEqual(opened, []string{"links2.nc"}) {
+		t.Error("opened", opened)
+	}
+
+	// Other files don't use the opener, so the file is missing.
+	h5 = openLinks(t, fileName)
+	defer h5.Close()
+	_, err = h5.GetVariable("coords")
+	if err != ErrNotFound {
+		t.Error("expected not found, got", err)
+	}
+}
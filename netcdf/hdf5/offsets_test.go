@@ -0,0 +1,75 @@
+package hdf5
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// The HDF5 tools always write 8-byte offsets and lengths, so these tests build
+// a version 0 file with a single variable by hand.
+
+// smallOffsetsFile returns a file with a 2x3 int32 variable named temp,
+// using the given sizes of offsets and lengths.
+func smallOffsetsFile(offsetSize, lengthSize int, vals []int32) []byte {
+	b := newFileBuilder(0, offsetSize, lengthSize)
+	b.addVar("temp", []uint64{2, 3}, int32Datatype(), vals)
+	return b.bytes()
+}
+
+func TestSmallOffsets(t *testing.T) {
+	vals := []int32{1, 2, 3, 4, 5, 6}
+	exp := [][]int32{{1, 2, 3}, {4, 5, 6}}
+	for _, sizes := range [][2]int{{8, 8}, {4, 4}, {4, 8}, {8, 4}, {2, 2}} {
+		file := smallOffsetsFile(sizes[0], sizes[1], vals)
+		nc, err := New(nopCloser{bytes.NewReader(file)})
+		if err != nil {
+			t.Error(sizes, err)
+			continue
+		}
+		vr, err := nc.GetVariable("temp")
+		if err != nil {
+			t.Error(sizes, err)
+		} else if !reflect.DeepEqual(vr.Values, exp) {
+			t.Error(sizes, "got", vr.Values, "exp", exp)
+		}
+		nc.Close()
+	}
+}
+
+func TestBadOffsetSize(t *testing.T) {
+	file := smallOffsetsFile(8, 8, []int32{1, 2, 3, 4, 5, 6})
+	file[13] = 16
+	_, err := New(nopCloser{bytes.NewReader(file)})
+	if err != ErrOffsetSize {
+		t.Error("expected offset size error, got", err)
+	}
+	file[13] = 8
+	file[14] = 3
+	_, err = New(nopCloser{bytes.NewReader(file)})
+	if err != ErrOffsetSize {
+		t.Error("expected offset size error, got", err)
+	}
+}
+
+func TestAllOnesLengths(t *testing.T) {
+	for _, size := range []uint8{2, 4, 8} {
+		h5 := &HDF5{sizeOfOffsets: size, sizeOfLengths: size}
+		ones := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}[:size]
+		exp := uint64(1)<<(8*uint(size)) - 1
+		if size == 8 {
+			exp = ^uint64(0)
+		}
+		// Lengths are kept as they are, but addresses and unlimited lengths
+		// are extended to 64 bits.
+		if got := h5.readLength(bytes.NewReader(ones)); got != exp {
+			t.Errorf("size %d length got 0x%x exp 0x%x", size, got, exp)
+		}
+		if got := h5.readAddr(bytes.NewReader(ones)); got != invalidAddress {
+			t.Errorf("size %d address got 0x%x", size, got)
+		}
+		if got := h5.readUnlimitedLength(bytes.NewReader(ones)); got != unlimitedSize {
+			t.Errorf("size %d unlimited length got 0x%x", size, got)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"io"
+	"math"
 	"sync"
 
 	"github.com/batchatco/go-thrower"
@@ -552,3 +553,218 @@ func (lr *layoutReader) Count() int64 {
 func newLayoutReader(r remReader, obj *object) io.Reader {
 	return &layoutReader{r, obj, nil, r.Rem(), 0, 0, 0}
 }
+
+// bitReader reads a stream of bits, most significant bit first, as written
+// by the N-Bit and Scale-Offset filters.
+type bitReader struct {
+	r    io.ByteReader
+	b    byte // current byte
+	left uint // bits left in the current byte
+}
+
+func newBitReader(r io.Reader) *bitReader {
+	return &bitReader{r: bufio.NewReader(r)}
+}
+
+// readBits returns the next n bits, n <= 64.
+func (br *bitReader) readBits(n uint) uint64 {
+	v := uint64(0)
+	for n > 0 {
+		if br.left == 0 {
+			b, err := br.r.ReadByte()
+			if err == io.EOF {
+				failError(ErrCorrupted, "filtered data is too short")
+			}
+			thrower.ThrowIfError(err)
+			br.b = b
+			br.left = 8
+		}
+		take := n
+		if take > br.left {
+			take = br.left
+		}
+		bits := uint64(br.b>>(br.left-take)) & (1<<take - 1)
+		v = v<<take | bits
+		br.left -= take
+		n -= take
+	}
+	return v
+}
+
+// elementReader returns elements decoded one at a time by decode.
+type elementReader struct {
+	decode func(elem []byte)
+	elem   []byte // space for decoding an element
+	buf    []byte // rest of the current element
+	n      uint64 // elements left to decode
+}
+
+func newElementReader(nElements uint64, size uint64, decode func(elem []byte)) remReader {
+	r := &elementReader{decode: decode, elem: make([]byte, size), n: nElements}
+	return newResetReader(r, int64(nElements*size))
+}
+
+func (r *elementReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		if r.n == 0 {
+			return 0, io.EOF
+		}
+		for i := range r.elem {
+			r.elem[i] = 0
+		}
+		r.decode(r.elem)
+		r.buf = r.elem
+		r.n--
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// N-Bit filter type classes
+const (
+	nbitAtomic = iota + 1
+	nbitArray
+	nbitCompound
+	nbitNoOpType
+)
+
+// N-Bit and Scale-Offset byte orders
+const (
+	filterOrderLE = iota
+	filterOrderBE
+)
+
+// nbitType is the description of a datatype in the N-Bit filter parameters.
+type nbitType struct {
+	class     uint32
+	size      uint32
+	order     uint32       // atomic
+	precision uint32       // atomic
+	offset    uint32       // atomic
+	base      *nbitType    // array
+	members   []nbitMember // compound
+}
+
+type nbitMember struct {
+	offset uint32
+	typ    *nbitType
+}
+
+// newNbitReader returns a reader of nElements of type typ, decoded from the
+// bits packed by the N-Bit filter.
+func newNbitReader(r io.Reader, typ *nbitType, nElements uint64) remReader {
+	br := newBitReader(r)
+	return newElementReader(nElements, uint64(typ.size), func(elem []byte) {
+		typ.decode(br, elem)
+	})
+}
+
+func (t *nbitType) decode(br *bitReader, data []byte) {
+	switch t.class {
+	case nbitAtomic:
+		t.decodeAtomic(br, data)
+	case nbitArray:
+		size := t.base.size
+		for i := uint32(0); i < t.size/size; i++ {
+			t.base.decode(br, data[i*size:(i+1)*size])
+		}
+	case nbitCompound:
+		for _, m := range t.members {
+			m.typ.decode(br, data[m.offset:m.offset+m.typ.size])
+		}
+	case nbitNoOpType:
+		for i := range data {
+			data[i] = byte(br.readBits(8))
+		}
+	}
+}
+
+// decodeAtomic unpacks the significant bits of an atomic value.  They are
+// packed a byte at a time, starting with the most significant byte.
+func (t *nbitType) decodeAtomic(br *bitReader, data []byte) {
+	typeBits := int(t.size) * 8
+	precision := int(t.precision)
+	offset := int(t.offset)
+	var first, last, step int
+	switch t.order {
+	case filterOrderLE:
+		first = (precision + offset - 1) / 8
+		last = offset / 8
+		step = -1
+	default:
+		first = (typeBits - precision - offset) / 8
+		last = (typeBits - offset - 1) / 8
+		step = 1
+	}
+	for k := first; ; k += step {
+		var n int
+		switch {
+		case first == last:
+			n = precision
+		case k == first:
+			n = 8 - (typeBits-precision-offset)%8
+		case k == last:
+			n = 8 - offset%8
+		default:
+			n = 8
+		}
+		b := byte(br.readBits(uint(n)))
+		if k == last {
+			data[k] = b << uint(offset%8)
+			break
+		}
+		data[k] = b
+	}
+}
+
+// scaleOffset holds the Scale-Offset filter parameters for a chunk.
+type scaleOffset struct {
+	float     bool
+	size      uint32
+	order     binary.ByteOrder
+	scale     int32  // decimal scale factor for floats
+	fillValue []byte // nil if there is no fill value
+	minBits   uint
+	minVal    uint64
+}
+
+// newScaleOffsetReader returns a reader of nElements decoded from the bits
+// packed by the Scale-Offset filter.
+func newScaleOffsetReader(r io.Reader, so *scaleOffset, nElements uint64) remReader {
+	br := newBitReader(r)
+	fillCode := uint64(1)<<so.minBits - 1
+	return newElementReader(nElements, uint64(so.size), func(elem []byte) {
+		v := br.readBits(so.minBits)
+		if so.fillValue != nil && v == fillCode {
+			copy(elem, so.fillValue)
+			return
+		}
+		if !so.float {
+			v += so.minVal
+			switch so.size {
+			case 1:
+				elem[0] = byte(v)
+			case 2:
+				so.order.PutUint16(elem, uint16(v))
+			case 4:
+				so.order.PutUint32(elem, uint32(v))
+			case 8:
+				so.order.PutUint64(elem, v)
+			}
+			return
+		}
+		// The minimum value is stored as the bits of a float.
+		scale := math.Pow(10, float64(so.scale))
+		switch so.size {
+		case 4:
+			min := math.Float32frombits(uint32(so.minVal))
+			f := float32(float64(int32(v))/scale + float64(min))
+			so.order.PutUint32(elem, math.Float32bits(f))
+		case 8:
+			min := math.Float64frombits(so.minVal)
+			f := float64(int64(v))/scale + min
+			so.order.PutUint64(elem, math.Float64bits(f))
+		}
+	})
+}
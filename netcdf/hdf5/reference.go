@@ -1,14 +1,59 @@
 package hdf5
 
+// Object and region references.
+//
+// An object reference is the address of the object header of a group,
+// variable or named type.  A region reference is the ID of a global heap
+// object, which has the address of a variable's object header followed by a
+// serialized dataspace selection, the same as those in virtual datasets.
+//
+// Object references are returned as ObjectReferences, which can be followed
+// with ReferencePath, GetGroupByReference and GetVarGetterByReference.
+// Region references are decoded into RegionReferences when they are read.
+
 import (
-	"encoding/binary"
 	"fmt"
 	"io"
 	"reflect"
+	"sort"
 
+	"github.com/batchatco/go-native-netcdf/netcdf/api"
 	"github.com/batchatco/go-thrower"
 )
 
+// reference types
+const (
+	refObject = 0
+	refRegion = 1
+)
+
+// ObjectReference refers to a group, variable or named type in the file.
+type ObjectReference uint64
+
+// RegionReference refers to some of the elements of a variable.
+type RegionReference struct {
+	Object    ObjectReference
+	Path      string // the full name of the variable, empty if it isn't found
+	Selection Selection
+}
+
+// Selection is the elements selected by a region reference.  Each hyperslab
+// can be read with the variable's GetHyperslab.  For point selections, the
+// points are also given in order, and each is a hyperslab of one element.
+type Selection struct {
+	All        bool // the whole variable, with no hyperslabs
+	Points     [][]int64
+	Hyperslabs []Hyperslab
+}
+
+// Hyperslab is the start, count and stride in each dimension of a part of a
+// variable, as passed to GetHyperslab.
+type Hyperslab struct {
+	Start  []int64
+	Count  []int64
+	Stride []int64
+}
+
 type referenceManagerType struct{}
 
 var (
@@ -23,12 +68,15 @@ func (referenceManagerType) cdlTypeString(sh sigHelper, name string, attr *attri
 
 func (referenceManagerType) goTypeString(sh sigHelper, name string, attr *attribute, origNames map[string]bool) string {
 	// Not NetCDF
-	return "uint64" // reference same as uint64
+	if attr.refType == refRegion {
+		return "RegionReference"
+	}
+	return "ObjectReference"
 }
 
 func (referenceManagerType) alloc(hr heapReader, c caster, bf io.Reader, attr *attribute,
 	dimensions []uint64) interface{} {
-	return allocReferences(bf, dimensions) // already converted
+	return allocReferences(hr, bf, attr.refType, dimensions) // already converted
 }
 
 func (referenceManagerType) defaultFillValue(obj *object, objFillValue []byte, undefinedFillValue bool) []byte {
@@ -40,55 +88,182 @@ func (referenceManagerType) parse(hr heapReader, c caster, attr *attribute, bitF
 	checkVal(1, attr.dtversion, "Only support version 1 of reference")
 	rType := bitFields & 0b1111
 	switch rType {
-	case 0:
-		break
-	case 1:
-		break
+	case refObject:
+		logger.Info("* rtype=object")
+	case refRegion:
+		logger.Info("* rtype=region")
 	default:
-		assert(df == nil, "references can't be attributes")
-		maybeFail(fmt.Sprintf("invalid rtype value: %#b dtlength=%v", rType, attr.length))
-		return
+		failError(ErrReference, fmt.Sprintf("invalid rtype value: %#b dtlength=%v", rType,
+			attr.length))
 	}
-	logger.Info("* rtype=object")
+	attr.refType = uint8(rType)
 	warnAssert((bitFields & ^uint32(0b1111)) == 0, "reserved must be zero")
 	if df == nil {
 		logger.Infof("no data")
 		return
 	}
-	if !allowReferences {
-		assert(df == nil, "references can't be attributes")
-		logger.Infof("References ignored")
-		thrower.Throw(ErrReference)
-	}
 	if df.Rem() >= int64(attr.length) {
 		attr.df = newResetReaderSave(df, df.Rem())
 	}
 }
 
-func allocReferences(bf io.Reader, dimLengths []uint64) interface{} {
+func referenceType(refType uint8) reflect.Type {
+	if refType == refRegion {
+		return reflect.TypeOf(RegionReference{})
+	}
+	return reflect.TypeOf(ObjectReference(0))
+}
+
+func allocReferences(hr heapReader, bf io.Reader, refType uint8, dimLengths []uint64) interface{} {
 	if len(dimLengths) == 0 {
-		var addr uint64
-		err := binary.Read(bf, binary.LittleEndian, &addr)
-		thrower.ThrowIfError(err)
-		logger.Infof("Reference addr 0x%x", addr)
-		return addr
+		return readReference(hr, bf, refType).Interface()
 	}
 
 	thisDim := dimLengths[0]
-	if len(dimLengths) == 1 {
-		values := make([]uint64, thisDim)
-		for i := range values {
-			var addr uint64
-			err := binary.Read(bf, binary.LittleEndian, &addr)
-			thrower.ThrowIfError(err)
-			logger.Infof("Reference addr[%d] 0x%x", i, addr)
-			values[i] = addr
+	vals := makeSlices(referenceType(refType), dimLengths)
+	for i := 0; i < int(thisDim); i++ {
+		if len(dimLengths) == 1 {
+			vals.Index(i).Set(readReference(hr, bf, refType))
+			continue
 		}
-		return values
-	}
-	vals := makeSlices(reflect.TypeOf(uint64(0)), dimLengths)
-	for i := uint64(0); i < thisDim; i++ {
-		vals.Index(int(i)).Set(reflect.ValueOf(allocReferences(bf, dimLengths[1:])))
+		vals.Index(i).Set(reflect.ValueOf(allocReferences(hr, bf, refType, dimLengths[1:])))
 	}
 	return vals.Interface()
 }
+
+func readReference(hr heapReader, bf io.Reader, refType uint8) reflect.Value {
+	addr := hr.readAddr(bf)
+	if refType == refObject {
+		logger.Infof("Reference addr 0x%x", addr)
+		return reflect.ValueOf(ObjectReference(addr))
+	}
+	index := read32(bf)
+	logger.Infof("Region reference heap=0x%x index=%d", addr, index)
+	return reflect.ValueOf(hr.readRegion(addr, index))
+}
+
+// readRegion reads the region reference in the global heap.  Unset
+// references have no object and select nothing.
+func (h5 *HDF5) readRegion(heapAddr uint64, index uint32) RegionReference {
+	if heapAddr == 0 || heapAddr == invalidAddress {
+		return RegionReference{}
+	}
+	bf, size := h5.readGlobalHeap(heapAddr, index)
+	assertError(bf != nil && size > uint64(h5.sizeOfOffsets), ErrCorrupted,
+		"region reference not found")
+	addr := h5.readAddr(bf)
+	sel := readSelection(bf)
+	ref := RegionReference{
+		Object:    ObjectReference(addr),
+		Path:      h5.findPath(addr),
+		Selection: Selection{All: sel.all},
+	}
+	for _, box := range sel.boxes {
+		if sel.points {
+			point := make([]int64, len(box))
+			for d := range box {
+				point[d] = box[d].start
+			}
+			ref.Selection.Points = append(ref.Selection.Points, point)
+		}
+		ref.Selection.Hyperslabs = append(ref.Selection.Hyperslabs, boxHyperslabs(box)...)
+	}
+	return ref
+}
+
+// boxHyperslabs returns the hyperslabs that select the same elements as the
+// box.  Blocks of more than one element have to be split up, unless there is
+// only one of them.
+func boxHyperslabs(box []vdsDim) []Hyperslab {
+	slabs := []Hyperslab{{}}
+	for _, d := range box {
+		var next []Hyperslab
+		for _, slab := range slabs {
+			add := func(start, count, stride int64) {
+				next = append(next, Hyperslab{
+					Start:  append(append([]int64{}, slab.Start...), start),
+					Count:  append(append([]int64{}, slab.Count...), count),
+					Stride: append(append([]int64{}, slab.Stride...), stride),
+				})
+			}
+			switch {
+			case d.count == 1:
+				add(d.start, d.block, 1)
+			case d.block == 1:
+				add(d.start, d.count, d.stride)
+			default:
+				for i := int64(0); i < d.block; i++ {
+					add(d.start+i, d.count, d.stride)
+				}
+			}
+		}
+		slabs = next
+	}
+	return slabs
+}
+
+// findPath returns the full name of the object with the address, or the
+// empty string if there isn't one.  Links are not followed.
+func (h5 *HDF5) findPath(addr uint64) string {
+	if h5.rootObject.addr == addr {
+		return "/"
+	}
+	var find func(obj *object, dir string) string
+	find = func(obj *object, dir string) string {
+		names := make([]string, 0, len(obj.children))
+		for name := range obj.children {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			child := obj.children[name]
+			if child.linkTarget != nil {
+				continue
+			}
+			if child.addr == addr {
+				return dir + name
+			}
+			if child.isGroup {
+				if p := find(child, dir+name+"/"); p != "" {
+					return p
+				}
+			}
+		}
+		return ""
+	}
+	return find(h5.rootObject, "/")
+}
+
+// ReferencePath returns the full name of the group, variable or type that the
+// reference refers to.
+func (h5 *HDF5) ReferencePath(ref ObjectReference) (string, error) {
+	p := h5.findPath(uint64(ref))
+	if p == "" {
+		return "", ErrNotFound
+	}
+	return p, nil
+}
+
+// GetGroupByReference returns the group that the reference refers to.
+func (h5 *HDF5) GetGroupByReference(ref ObjectReference) (api.Group, error) {
+	p, err := h5.ReferencePath(ref)
+	if err != nil {
+		return nil, err
+	}
+	return h5.GetGroup(p)
+}
+
+// GetVarGetterByReference returns a VarGetter for the variable that the
+// reference refers to.
+func (h5 *HDF5) GetVarGetterByReference(ref ObjectReference) (slicer api.VarGetter, err error) {
+	defer thrower.RecoverError(&err)
+	p, err := h5.ReferencePath(ref)
+	if err != nil {
+		return nil, err
+	}
+	loc := h5.lookup(h5.rootObject, "/", p, 0)
+	if loc == nil || loc.parent == nil {
+		return nil, ErrNotFound
+	}
+	return loc.group().GetVarGetter(loc.name)
+}
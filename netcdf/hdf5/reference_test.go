@@ -0,0 +1,165 @@
+package hdf5
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestObjectReferences(t *testing.T) {
+	defer setBitfields(setBitfields(true))
+	nc, err := Open("testdata/reference.h5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	h5 := nc.(*HDF5)
+	vr, err := nc.GetVariable("Dataset3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs, ok := vr.Values.([]ObjectReference)
+	if !ok {
+		t.Fatalf("got %T", vr.Values)
+	}
+	var paths []string
+	for _, ref := range refs {
+		p, err := h5.ReferencePath(ref)
+		if err != nil {
+			t.Error(ref, err)
+		}
+		paths = append(paths, p)
+	}
+	expPaths := []string{"/Group1/Dataset1", "/Group1/Dataset2", "/Group1", "/Group1/Datatype1"}
+	if !reflect.DeepEqual(paths, expPaths) {
+		t.Error("got", paths, "exp", expPaths)
+	}
+
+	g, err := h5.GetGroupByReference(refs[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := g.ListVariables()
+	sort.Strings(vars)
+	if !reflect.DeepEqual(vars, []string{"Dataset1", "Dataset2"}) {
+		t.Error("group variables", vars)
+	}
+	defer g.Close()
+	vg, err := h5.GetVarGetterByReference(refs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	direct, err := g.(*HDF5).GetVarGetter("Dataset1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vg.Len() != direct.Len() || vg.Type() != direct.Type() {
+		t.Error("got", vg.Len(), vg.Type(), "exp", direct.Len(), direct.Type())
+	}
+
+	// References to the wrong kind of object, or to nothing
+	_, err = h5.GetGroupByReference(refs[0])
+	if err != ErrNotFound {
+		t.Error("expected not found, got", err)
+	}
+	_, err = h5.GetVarGetterByReference(refs[2])
+	if err != ErrNotFound {
+		t.Error("expected not found, got", err)
+	}
+	_, err = h5.ReferencePath(ObjectReference(12345))
+	if err != ErrNotFound {
+		t.Error("expected not found, got", err)
+	}
+}
+
+// regionFile returns a file with a 3x4 variable named temp, and a global heap
+// at the end with region references to it, with the given selections.
+func regionFile(selections ...[]interface{}) (file []byte, heap uint64) {
+	b := newFileBuilder(0, 8, 8)
+	b.addVar("temp", []uint64{3, 4}, int32Datatype(),
+		[]int32{0, 1, 2, 3, 10, 11, 12, 13, 20, 21, 22, 23})
+	temp := b.vars["temp"]
+	file = b.bytes()
+
+	var objects indexBuilder
+	for i, sel := range selections {
+		var obj indexBuilder
+		obj.put(temp, sel)
+		objects.put(uint16(i+1), uint16(0), uint32(0), uint64(obj.buf.Len()), obj.buf.Bytes(),
+			make([]byte, (8-obj.buf.Len()%8)%8))
+	}
+	var gh indexBuilder
+	gh.put("GCOL", 1, 0, 0, 0, uint64(16+objects.buf.Len()), objects.buf.Bytes())
+	return append(file, gh.buf.Bytes()...), uint64(len(file))
+}
+
+func TestRegionReferences(t *testing.T) {
+	points := []interface{}{uint32(selectPoints), uint32(1), uint32(0), uint32(0),
+		uint32(2), uint32(2), uint32(2), uint32(1), uint32(0), uint32(3)}
+	regular := []interface{}{uint32(selectHyperslab), uint32(2), hyperslabRegular, uint32(0),
+		uint32(2), uint64(0), uint64(2), uint64(2), uint64(1), uint64(0), uint64(2), uint64(2),
+		uint64(2)}
+	irregular := []interface{}{uint32(selectHyperslab), uint32(1), uint32(0), uint32(0),
+		uint32(2), uint32(2), uint32(0), uint32(0), uint32(0), uint32(1), uint32(1), uint32(2),
+		uint32(2), uint32(3)}
+	all := []interface{}{uint32(selectAll), uint32(1), uint32(0), uint32(0)}
+	file, heap := regionFile(points, regular, irregular, all)
+	nc, err := New(nopCloser{bytes.NewReader(file)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	h5 := nc.(*HDF5)
+
+	var ids indexBuilder
+	for i := 1; i <= 4; i++ {
+		ids.put(heap, uint32(i))
+	}
+	ids.put(uint64(0), uint32(0)) // unset
+	refs := allocReferences(h5, bytes.NewReader(ids.buf.Bytes()), refRegion, []uint64{5}).([]RegionReference)
+	for i, ref := range refs[:4] {
+		if ref.Path != "/temp" {
+			t.Error(i, "got path", ref.Path)
+		}
+	}
+	if !reflect.DeepEqual(refs[4], RegionReference{}) {
+		t.Error("got", refs[4])
+	}
+	if !refs[3].Selection.All || refs[3].Selection.Hyperslabs != nil {
+		t.Error("got", refs[3].Selection)
+	}
+	expPoints := [][]int64{{2, 1}, {0, 3}}
+	if !reflect.DeepEqual(refs[0].Selection.Points, expPoints) {
+		t.Error("got", refs[0].Selection.Points, "exp", expPoints)
+	}
+
+	vg, err := nc.GetVarGetter("temp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := func(sel Selection) []interface{} {
+		var vals []interface{}
+		for _, slab := range sel.Hyperslabs {
+			v, err := vg.GetHyperslab(slab.Start, slab.Count, slab.Stride)
+			if err != nil {
+				t.Fatal(err)
+			}
+			vals = append(vals, v)
+		}
+		return vals
+	}
+	exp := [][]interface{}{
+		{[][]int32{{21}}, [][]int32{{3}}},
+		// rows 0 and 2, and two blocks of two columns
+		{[][]int32{{0, 2}, {20, 22}}, [][]int32{{1, 3}, {21, 23}}},
+		// a block from (0,0) to (0,1), and one from (1,2) to (2,3), by row
+		{[][]int32{{0, 1}}, [][]int32{{12, 13}}, [][]int32{{22, 23}}},
+	}
+	for i, e := range exp {
+		got := read(refs[i].Selection)
+		if !reflect.DeepEqual(got, e) {
+			t.Error(i, "got", got, "exp", e, refs[i].Selection.Hyperslabs)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package hdf5
+
+// Messages only found in the superblock extension.
+//
+// Version 2 and 3 superblocks keep anything that isn't the default in an
+// object header, the superblock extension, instead of the superblock itself.
+// The shared message table is in sohm.go.  The others are the B-tree K
+// values, information for the driver that wrote the file, and how free file
+// space is managed.  Only the K values affect reading the file, except that
+// files written by drivers that split the data into several files can't be
+// read.
+
+import (
+	"fmt"
+	"io"
+)
+
+// file space strategies for version 0 of the file space info message
+const fileSpaceAllPersist = 1
+
+// drivers whose data isn't all in the file with the superblock
+var splitDrivers = map[string]bool{
+	"NCSAmult": true, // multi and split
+	"NCSAfami": true, // family
+}
+
+// number of free-space managers in the file space info message
+const (
+	fileSpaceManagersV0 = 6
+	fileSpaceManagersV1 = 12
+)
+
+func (h5 *HDF5) readKValues(bf io.Reader) {
+	version := read8(bf)
+	checkVal(0, version, "B-tree K values version")
+	h5.chunkK = read16(bf)
+	h5.groupInternalK = read16(bf)
+	h5.groupLeafK = read16(bf)
+	logger.Info("K values: chunk", h5.chunkK, "group internal", h5.groupInternalK,
+		"group leaf", h5.groupLeafK)
+	h5.checkKValues()
+}
+
+func (h5 *HDF5) readDriverInfo(bf io.Reader) {
+	version := read8(bf)
+	checkVal(0, version, "driver info version")
+	id := make([]byte, 8)
+	read(bf, id)
+	size := read16(bf)
+	info := make([]byte, size)
+	read(bf, info)
+	logger.Infof("driver=%q info=%x", string(id), info)
+	assertError(!splitDrivers[string(id)], ErrDriver,
+		fmt.Sprint("data is in other files for driver ", string(id)))
+	logger.Warn("ignoring driver info for", string(id))
+}
+
+func (h5 *HDF5) readFileSpaceInfo(bf io.Reader) {
+	version := read8(bf)
+	var nManagers int
+	switch version {
+	case 0:
+		strategy := read8(bf)
+		threshold := h5.readLength(bf)
+		logger.Info("file space strategy", strategy, "threshold", threshold)
+		if strategy == fileSpaceAllPersist {
+			nManagers = fileSpaceManagersV0
+		}
+	case 1:
+		strategy := read8(bf)
+		persist := read8(bf)
+		threshold := h5.readLength(bf)
+		pageSize := h5.readLength(bf)
+		pageEndThreshold := read16(bf)
+		eoa := h5.readAddr(bf)
+		logger.Info("file space strategy", strategy, "persist", persist, "threshold",
+			threshold, "page size", pageSize, "page end threshold", pageEndThreshold)
+		logger.Infof("end of allocation before free-space managers=0x%x", eoa)
+		if persist != 0 {
+			nManagers = fileSpaceManagersV1
+		}
+	default:
+		fail(fmt.Sprint("Unknown file space info version: ", version))
+	}
+	// Free space isn't needed for reading.
+	for i := 0; i < nManagers; i++ {
+		addr := h5.readAddr(bf)
+		logger.Infof("free-space manager %d address=0x%x", i, addr)
+	}
+}
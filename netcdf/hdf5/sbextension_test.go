@@ -0,0 +1,116 @@
+package hdf5
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// The netCDF library doesn't set the B-tree K values, so these tests build
+// a file with a big root group by hand.
+
+type kValues struct {
+	leaf     uint16 // in the superblock
+	internal uint16
+	perLeaf  int // actually used in the file
+	perNode  int
+}
+
+// kValuesFile returns a file with the variables in its root group, each
+// with one int32 value.  Version 0 files have the K values in the
+// superblock, and version 2 files in the superblock extension.
+func kValuesFile(version int, k kValues, vars map[string]int32) []byte {
+	b := newFileBuilder(version, 8, 8)
+	b.perLeaf = k.perLeaf
+	b.perNode = k.perNode
+	if version == 0 {
+		b.leafK = k.leaf
+		b.internalK = k.internal
+	} else {
+		// The extension has all the messages that can be in it, except the
+		// shared message table.  The driver keeps all the data in this file.
+		b.addExtension(
+			v1Message(typeBtreeKValues, 0, uint16(defaultChunkK), k.internal, k.leaf),
+			v1Message(typeDriverInfo, 0, "TESTdriv", uint16(4), uint32(0)),
+			v1Message(typeFileSpaceInfo, 1, 0, 0, uint64(1), uint64(4096), uint16(0),
+				uint64(invalidAddress)))
+	}
+	var names []string
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b.addVar(name, []uint64{1}, int32Datatype(), vars[name])
+	}
+	return b.bytes()
+}
+
+func TestKValues(t *testing.T) {
+	vars := make(map[string]int32)
+	for i := 0; i < 20; i++ {
+		vars[fmt.Sprintf("v%02d", i)] = int32(i)
+	}
+	for _, version := range []int{0, 2} {
+		for _, k := range []kValues{
+			{leaf: 4, internal: 16, perLeaf: 8, perNode: 32}, // the defaults
+			{leaf: 1, internal: 1, perLeaf: 2, perNode: 2},   // three levels of nodes
+			{leaf: 3, internal: 2, perLeaf: 5, perNode: 3},   // not full
+		} {
+			file := kValuesFile(version, k, vars)
+			nc, err := New(nopCloser{bytes.NewReader(file)})
+			if err != nil {
+				t.Error(version, k, err)
+				continue
+			}
+			got := nc.ListVariables()
+			sort.Strings(got)
+			if len(got) != len(vars) {
+				t.Error(version, k, "got", got)
+			}
+			for _, name := range got {
+				vr, err := nc.GetVariable(name)
+				if err != nil {
+					t.Error(version, k, name, err)
+					continue
+				}
+				if !reflect.DeepEqual(vr.Values, []int32{vars[name]}) {
+					t.Error(version, k, name, "got", vr.Values, "exp", vars[name])
+				}
+			}
+			nc.Close()
+		}
+	}
+}
+
+func TestKValuesTooSmall(t *testing.T) {
+	vars := map[string]int32{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5}
+	for _, version := range []int{0, 2} {
+		for _, k := range []kValues{
+			{leaf: 1, internal: 16, perLeaf: 3, perNode: 32},
+			{leaf: 4, internal: 1, perLeaf: 1, perNode: 3},
+			{leaf: 0, internal: 16, perLeaf: 8, perNode: 32},
+		} {
+			file := kValuesFile(version, k, vars)
+			_, err := New(nopCloser{bytes.NewReader(file)})
+			if err != ErrCorrupted {
+				t.Error(version, k, "expected corrupted, got", err)
+			}
+		}
+	}
+}
+
+func TestSplitDriver(t *testing.T) {
+	k := kValues{leaf: 4, internal: 16, perLeaf: 8, perNode: 32}
+	file := kValuesFile(2, k, map[string]int32{"a": 1})
+	for _, driver := range []string{"NCSAmult", "NCSAfami"} {
+		// The extension's object header has no checksum to update.
+		patched := bytes.Replace(file, []byte("TESTdriv"), []byte(driver), 1)
+		_, err := New(nopCloser{bytes.NewReader(patched)})
+		if err != ErrDriver {
+			t.Error(driver, "expected driver error, got", err)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package hdf5
 
 import (
+	"bytes"
+	"math"
 	"os"
+	"reflect"
 	"testing"
 
 	"github.com/batchatco/go-native-netcdf/netcdf/api"
@@ -69,3 +72,276 @@ func TestSlicer(t *testing.T) {
 		}
 	}
 }
+
+func TestHyperslab(t *testing.T) {
+	fileName := "testdata/testhyperslab.nc"
+	_ = os.Remove(fileName)
+	defer os.Remove(fileName)
+	// temp[time][lat][lon] = time*100 + lat*10 + lon
+	temp := make([][][]int16, 3)
+	for i := range temp {
+		temp[i] = make([][]int16, 4)
+		for j := range temp[i] {
+			temp[i][j] = make([]int16, 5)
+			for k := range temp[i][j] {
+				temp[i][j][k] = int16(i*100 + j*10 + k)
+			}
+		}
+	}
+	contents := keyValList{
+		{"temp", "short", api.Variable{
+			Values:     temp,
+			Dimensions: []string{"time", "lat", "lon"},
+			Attributes: nilMap,
+		}},
+		{"names", "string", api.Variable{
+			Values:     []string{"abc", "de", "", "fghi"},
+			Dimensions: []string{"n"},
+			Attributes: nilMap,
+		}},
+	}
+	writeKeyVals(t, fileName, contents)
+
+	nc, err := Open(fileName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer nc.Close()
+
+	slicer, err := nc.GetVarGetter("temp")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	tests := []struct {
+		start, count, stride []int64
+		exp                  interface{}
+	}{
+		{[]int64{0, 0, 0}, []int64{3, 4, 5}, nil, temp},
+		{[]int64{1, 1, 2}, []int64{2, 2, 2}, nil,
+			[][][]int16{{{112, 113}, {122, 123}}, {{212, 213}, {222, 223}}}},
+		{[]int64{0, 3, 0}, []int64{2, 1, 3}, []int64{2, 1, 2},
+			[][][]int16{{{30, 32, 34}}, {{230, 232, 234}}}},
+		{[]int64{2, 0, 4}, []int64{1, 4, 1}, nil,
+			[][][]int16{{{204}, {214}, {224}, {234}}}},
+	}
+	for _, test := range tests {
+		slab, err := slicer.GetHyperslab(test.start, test.count, test.stride)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !reflect.DeepEqual(slab, test.exp) {
+			t.Error("hyperslab", test.start, test.count, test.stride,
+				"got", slab, "exp", test.exp)
+		}
+	}
+	_, err = slicer.GetHyperslab([]int64{0, 0, 4}, []int64{1, 1, 2}, nil)
+	if err == nil {
+		t.Error("expected error")
+	}
+
+	slicer, err = nc.GetVarGetter("names")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	slab, err := slicer.GetHyperslab([]int64{1}, []int64{2}, []int64{2})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(slab, []string{"de", "fghi"}) {
+		t.Error("names hyperslab", slab)
+	}
+}
+
+func TestCopyChunk(t *testing.T) {
+	// A 5x7 dataset of 1-byte elements, stored in 2x3 chunks.
+	dims := []uint64{5, 7}
+	layout := []uint64{2, 3}
+	start := []int64{1, 1}
+	count := []int64{2, 3}
+	stride := []int64{2, 2}
+	// Selects rows 1, 3 and columns 1, 3, 5.
+	exp := []byte{11, 13, 15, 31, 33, 35}
+	got := make([]byte, len(exp))
+	for row := uint64(0); row < dims[0]; row += layout[0] {
+		for col := uint64(0); col < dims[1]; col += layout[1] {
+			offsets := []uint64{row, col}
+			chunk := make([]byte, layout[0]*layout[1])
+			for i := range chunk {
+				chunk[i] = byte((row+uint64(i)/layout[1])*10 + col + uint64(i)%layout[1])
+			}
+			first, n := chunkSelection(layout, offsets, start, count, stride)
+			if first == nil {
+				continue
+			}
+			copyChunk(got, chunk, 1, layout, offsets, start, count, stride, first, n)
+		}
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Error("got", got, "exp", exp)
+	}
+	first, _ := chunkSelection(layout, []uint64{4, 6}, start, count, stride)
+	if first != nil {
+		t.Error("chunk should not intersect", first)
+	}
+}
+
+func TestReadInto(t *testing.T) {
+	fileName := "testdata/testreadinto.nc"
+	_ = os.Remove(fileName)
+	defer os.Remove(fileName)
+	// temp[time][lat][lon] = time*100 + lat*10 + lon
+	temp := make([][][]int16, 3)
+	flat := make([]int16, 0, 60)
+	for i := range temp {
+		temp[i] = make([][]int16, 4)
+		for j := range temp[i] {
+			temp[i][j] = make([]int16, 5)
+			for k := range temp[i][j] {
+				temp[i][j][k] = int16(i*100 + j*10 + k)
+				flat = append(flat, temp[i][j][k])
+			}
+		}
+	}
+	contents := keyValList{
+		{"temp", "short", api.Variable{
+			Values:     temp,
+			Dimensions: []string{"time", "lat", "lon"},
+			Attributes: nilMap,
+		}},
+		{"names", "string", api.Variable{
+			Values:     []string{"abc", "de", "", "fghi"},
+			Dimensions: []string{"n"},
+			Attributes: nilMap,
+		}},
+	}
+	writeKeyVals(t, fileName, contents)
+
+	nc, err := Open(fileName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer nc.Close()
+
+	slicer, err := nc.GetVarGetter("temp")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	dst := make([]int16, 60)
+	err = slicer.ReadInto(dst, nil, nil)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(dst, flat) {
+		t.Error("got", dst)
+	}
+	// dst is reused, and only the start of it is filled
+	err = slicer.ReadInto(dst, []int64{1, 1, 2}, []int64{2, 2, 2})
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(dst[:8],
+		[]int16{112, 113, 122, 123, 212, 213, 222, 223}) || dst[8] != flat[8] {
+		t.Error("got", dst)
+	}
+
+	bad := []struct {
+		dst          interface{}
+		start, count []int64
+	}{
+		{make([]int32, 60), nil, nil},
+		{make([]int16, 59), nil, nil},
+		{int16(0), []int64{0, 0, 0}, []int64{1, 1, 1}},
+		{dst, []int64{0, 0, 4}, []int64{1, 1, 2}},
+		{dst, []int64{0, 0}, nil},
+	}
+	for _, b := range bad {
+		err := slicer.ReadInto(b.dst, b.start, b.count)
+		if err == nil {
+			t.Errorf("expected error %T %v %v", b.dst, b.start, b.count)
+		}
+	}
+
+	// strings need decoding, so are copied into dst
+	slicer, err = nc.GetVarGetter("names")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	names := make([]string, 2)
+	err = slicer.ReadInto(names, []int64{2}, []int64{2})
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(names, []string{"", "fghi"}) {
+		t.Error("names got", names)
+	}
+	err = slicer.ReadInto(make([]byte, 2), []int64{2}, []int64{2})
+	if err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestReadIntoFloat16(t *testing.T) {
+	var b indexBuilder
+	b.put(uint16(0x3c00), uint16(0xc000), uint16(0x7bff), uint16(0x3800))
+	file := floatFile(0, 2, 0, 16, float16Format, b.buf.Bytes())
+	nc, err := New(nopCloser{bytes.NewReader(file)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	slicer, err := nc.GetVarGetter("x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := make([]float32, 3)
+	err = slicer.ReadInto(dst, []int64{1}, []int64{3})
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(dst, []float32{-2, 65504, 0.5}) {
+		t.Error("got", dst)
+	}
+}
+
+func TestReadIntoFixedPoint(t *testing.T) {
+	for _, test := range []struct {
+		flags     uint8
+		size      uint32
+		offset    uint16
+		precision uint16
+		data      []byte
+		dst       interface{}
+		exp       interface{}
+	}{
+		{fixedSigned | fixedHiPad, 2, 0, 12,
+			[]byte{0xff, 0x07, 0x00, 0xf8, 0xff, 0xff, 0x01, 0xf0},
+			make([]int16, 3), []int16{-2048, -1, 1}},
+		{fixedBigEndian, 3, 0, 24,
+			[]byte{0x12, 0x34, 0x56, 0xff, 0xff, 0xff, 0, 0, 0, 0, 0, 1},
+			make([]uint32, 3), []uint32{0xffffff, 0, 1}},
+		{fixedSigned, 8, 0, 64, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+			2, 0, 0, 0, 0, 0, 0, 0, 3, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x80},
+			make([]int64, 3), []int64{2, 3, math.MinInt64}},
+	} {
+		file := fixedPointFile(test.flags, test.size, test.offset, test.precision, test.data)
+		nc, err := New(nopCloser{bytes.NewReader(file)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		slicer, err := nc.GetVarGetter("x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = slicer.ReadInto(test.dst, []int64{1}, []int64{3})
+		if err != nil {
+			t.Error(test.size, err)
+		} else if !reflect.DeepEqual(test.dst, test.exp) {
+			t.Error(test.size, "got", test.dst, "exp", test.exp)
+		}
+		nc.Close()
+	}
+}
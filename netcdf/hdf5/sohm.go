@@ -0,0 +1,256 @@
+package hdf5
+
+// Shared object header messages (SOHM).
+//
+// Files can share datatype, dataspace, fill value, filter pipeline and
+// attribute messages between objects.  The superblock extension then has a
+// Shared Message Table message pointing to the SMTB master table.  The table
+// has up to eight indexes, each for some of the message types.  An index
+// keeps its messages in a fractal heap, and lists them either in an SMLI
+// list or, when there are many, in a version 2 B-tree.
+//
+// An object header message that is shared this way has a version 3 shared
+// message in its place, holding the heap ID of the message in the index's
+// heap.  Messages can also be shared by keeping them in an object header,
+// in which case the shared message has its address, as for committed
+// datatypes.
+//
+// The indexes and heaps are only read when a message in them is needed.
+
+import (
+	"fmt"
+	"io"
+)
+
+// shared message types
+const (
+	sharedNotShared = iota
+	sharedInHeap
+	sharedInObject
+	sharedSharable
+)
+
+// message locations in the index records
+const (
+	sharedLocationHeap   = 0
+	sharedLocationObject = 1
+)
+
+// version 2 B-tree record type for shared messages
+const btreeSharedMessages = 7
+
+// the size of fractal heap IDs for shared messages
+const sharedHeapIDSize = 8
+
+// index types
+const (
+	sharedIndexList  = 0
+	sharedIndexBTree = 1
+)
+
+// The bits in the index message type flags, by header message type.
+var sharedMessageFlags = map[uint16]uint{
+	typeDataspace:                 0,
+	typeDatatype:                  1,
+	typeDataStorageFillValue:      2,
+	typeDataStorageFilterPipeline: 3,
+	typeAttribute:                 4,
+}
+
+type sharedMessageIndex struct {
+	indexType    uint8
+	messageTypes uint16 // flags for the message types in this index
+	nMessages    uint16
+	indexAddr    uint64
+	heapAddr     uint64
+	heap         *linkInfo         // nil until read
+	messages     map[uint64][]byte // by heap ID, nil until read
+}
+
+type sharedMessageTable struct {
+	indexes []*sharedMessageIndex
+}
+
+// readSharedMessageTable reads the Shared Message Table message and the
+// master table it points to.
+func (h5 *HDF5) readSharedMessageTable(bf io.Reader) *sharedMessageTable {
+	version := read8(bf)
+	checkVal(0, version, "shared message table version")
+	addr := h5.readAddr(bf)
+	nIndexes := read8(bf)
+	logger.Infof("shared message table addr=0x%x indexes=%d", addr, nIndexes)
+	assertError(nIndexes > 0 && nIndexes <= 8, ErrCorrupted,
+		fmt.Sprint("bad number of shared message indexes: ", nIndexes))
+
+	indexSize := 14 + 2*int64(h5.sizeOfOffsets)
+	tableSize := 4 + int64(nIndexes)*indexSize
+	tf := h5.newSeek(addr, tableSize)
+	checkMagic(tf, 4, "SMTB")
+	table := &sharedMessageTable{}
+	for i := 0; i < int(nIndexes); i++ {
+		version := read8(tf)
+		checkVal(0, version, "shared message index version")
+		index := &sharedMessageIndex{}
+		index.indexType = read8(tf)
+		index.messageTypes = read16(tf)
+		minSize := read32(tf)
+		listCutoff := read16(tf)
+		btreeCutoff := read16(tf)
+		index.nMessages = read16(tf)
+		index.indexAddr = h5.readAddr(tf)
+		index.heapAddr = h5.readAddr(tf)
+		logger.Infof("shared index %d type=%d flags=%s min size=%d cutoffs=%d,%d messages=%d index=0x%x heap=0x%x",
+			i, index.indexType, binaryToString(uint64(index.messageTypes)), minSize,
+			listCutoff, btreeCutoff, index.nMessages, index.indexAddr, index.heapAddr)
+		table.indexes = append(table.indexes, index)
+	}
+	h5.checkChecksum(addr, int(tableSize))
+	return table
+}
+
+// sharedRecordSize is the size of a record in an index list or B-tree.  The
+// record is big enough for either location of the message.
+func (h5 *HDF5) sharedRecordSize() uint64 {
+	heapSize := uint64(4 + sharedHeapIDSize)
+	objectSize := 4 + uint64(h5.sizeOfOffsets)
+	if objectSize > heapSize {
+		return 5 + objectSize
+	}
+	return 5 + heapSize
+}
+
+// readSharedRecord reads an index record, adding the heap ID of messages in
+// the heap to the index.  Messages in object headers are found from their
+// address instead, so aren't needed.
+func (h5 *HDF5) readSharedRecord(index *sharedMessageIndex, bf io.Reader) {
+	rf := newResetReader(bf, int64(h5.sharedRecordSize()))
+	location := read8(rf)
+	hash := read32(rf)
+	switch location {
+	case sharedLocationHeap:
+		refCount := read32(rf)
+		heapID := read64(rf)
+		logger.Infof("shared message hash=0x%x refcount=%d heap ID=0x%x", hash, refCount,
+			heapID)
+		index.messages[heapID] = nil
+	case sharedLocationObject:
+		checkZeroes(rf, 1)
+		ty := read8(rf)
+		creationIndex := read16(rf)
+		addr := h5.readAddr(rf)
+		logger.Infof("shared message hash=0x%x type=%d index=%d in object 0x%x",
+			hash, ty, creationIndex, addr)
+	default:
+		failError(ErrCorrupted, fmt.Sprint("unknown shared message location: ", location))
+	}
+	checkZeroes(rf, int(rf.Rem()))
+}
+
+// readSharedIndex reads the index's list or B-tree, and its fractal heap.
+func (h5 *HDF5) readSharedIndex(index *sharedMessageIndex) {
+	index.messages = make(map[uint64][]byte)
+	if index.indexAddr != invalidAddress {
+		switch index.indexType {
+		case sharedIndexList:
+			recordSize := h5.sharedRecordSize()
+			size := 4 + int64(index.nMessages)*int64(recordSize)
+			bf := h5.newSeek(index.indexAddr, size)
+			checkMagic(bf, 4, "SMLI")
+			for i := 0; i < int(index.nMessages); i++ {
+				h5.readSharedRecord(index, bf)
+			}
+			h5.checkChecksum(index.indexAddr, int(size))
+		case sharedIndexBTree:
+			bt := h5.readBTree2Header(index.indexAddr)
+			checkVal(btreeSharedMessages, bt.ty, "shared message btree type")
+			checkVal(h5.sharedRecordSize(), bt.recordSize, "shared message record size")
+			bt.readRecord = func(bf io.Reader) { h5.readSharedRecord(index, bf) }
+			h5.readBTree2(bt)
+		default:
+			failError(ErrCorrupted, fmt.Sprint("unknown shared message index type: ",
+				index.indexType))
+		}
+	}
+	if index.heapAddr != invalidAddress {
+		index.heap = &linkInfo{heapAddress: index.heapAddr}
+		h5.readHeap(index.heap)
+		checkVal(sharedHeapIDSize, index.heap.heapIDLength, "shared message heap ID length")
+	}
+}
+
+// getSharedMessage returns the message of the given type with the heap ID.
+func (h5 *HDF5) getSharedMessage(headerType uint16, heapID uint64) []byte {
+	assertError(h5.sharedMessages != nil, ErrCorrupted, "no shared message table")
+	flag, has := sharedMessageFlags[headerType]
+	assertError(has, ErrCorrupted, fmt.Sprint("message type can't be shared: ", headerType))
+	var index *sharedMessageIndex
+	for _, idx := range h5.sharedMessages.indexes {
+		if (idx.messageTypes>>flag)&1 == 1 {
+			index = idx
+			break
+		}
+	}
+	assertError(index != nil, ErrCorrupted,
+		fmt.Sprint("no shared message index for type: ", headerType))
+	if index.messages == nil {
+		h5.readSharedIndex(index)
+	}
+	msg, has := index.messages[heapID]
+	assertError(has && index.heap != nil, ErrCorrupted,
+		fmt.Sprintf("shared message 0x%x not in index", heapID))
+	if msg != nil {
+		return msg
+	}
+
+	// The heap ID has the version and type, then the offset and length
+	// of the object.
+	idType := (heapID >> 4) & 0b11
+	checkVal(0, idType, "don't know how to handle non-managed")
+	offsetSize := uint(index.heap.maxHeapSize / 8)
+	offset := (heapID >> 8) & (1<<(8*offsetSize) - 1)
+	length := heapID >> (8 * (offsetSize + 1))
+	assertError(length > 0 && length <= 0xffff, ErrCorrupted, "bad shared message length")
+	logger.Infof("shared message offset=0x%x length=%d", offset, length)
+	h5.readLinkData(nil, index.heap, offset, uint16(length), 0,
+		func(obj *object, addr uint64, offset uint64, length uint16, creationOrder uint64) {
+			msg = make([]byte, length)
+			read(h5.newSeek(addr+offset, int64(length)), msg)
+		})
+	index.messages[heapID] = msg
+	return msg
+}
+
+// readSharedMessage reads the shared message in place of an object header
+// message of the given type.  Messages shared in the heap are returned, to be
+// read as if they were in the object header.  Otherwise, the message is read
+// from the object header it is in, and nil is returned.
+func (h5 *HDF5) readSharedMessage(obj *object, bf remReader, headerType uint16) remReader {
+	version := read8(bf)
+	sType := read8(bf)
+	logger.Infof("shared message version=%d type=%d", version, sType)
+	switch version {
+	case 1:
+		checkVal(0, sType, "type must be zero")
+		checkZeroes(bf, 6)
+	case 2:
+		// the type is supposed to be zero for version 2, but is sometimes 2
+		assert(sType == 0 || sType == 2, "type must be 0 or 2")
+	case 3:
+		switch sType {
+		case sharedInHeap:
+			heapID := read64(bf)
+			checkZeroes(bf, int(bf.Rem()))
+			return newResetReaderFromBytes(h5.getSharedMessage(headerType, heapID))
+		case sharedInObject:
+		default:
+			fail(fmt.Sprint("Unimplemented shared message type: ", sType))
+		}
+	default:
+		fail(fmt.Sprint("Unknown shared message version: ", version))
+	}
+	addr := h5.readAddr(bf)
+	logger.Infof("shared message addr = 0x%x", addr)
+	_ = h5.getSharedAttr(obj, addr)
+	checkZeroes(bf, int(bf.Rem()))
+	return nil
+}
@@ -0,0 +1,114 @@
+package hdf5
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// The HDF5 tools only share messages when told to by a file creation
+// property, so these tests build a file with a shared message table by hand.
+
+// sharedMessagesFile returns a version 2 file with a 2x3 int32 variable named
+// temp, whose datatype and dataspace are in the shared message heap, as is
+// the datatype of its attribute.  The index is a list or a B-tree.
+func sharedMessagesFile(indexType uint8, vals []int32) []byte {
+	b := newFileBuilder(2, 8, 8)
+
+	// The fractal heap, with its messages in the root direct block.
+	var msgs indexBuilder
+	msgs.put(make([]byte, 18)) // direct block header
+	heapID := func(vals ...interface{}) uint64 {
+		offset := msgs.addr()
+		msgs.put(vals...)
+		return offset<<8 | (msgs.addr()-offset)<<48
+	}
+	datatype := heapID(0x10, 0x08, 0, 0, uint32(4), uint16(0), uint16(32))
+	dataspace := heapID(1, 2, 0, 0, uint32(0), uint64(2), uint64(3))
+	msgs.put(make([]byte, 512-msgs.buf.Len()))
+	block := b.addr()
+	b.put("FHDB", 0, uint64(0), []byte{0, 0, 0, 0, 0}, msgs.buf.Bytes()[18:])
+	heap := b.addr()
+	b.block("FRHP", 0, uint16(8), uint16(0), 0, uint32(4096),
+		uint64(0), uint64(invalidAddress), uint64(0), uint64(invalidAddress),
+		uint64(512), uint64(512), uint64(512), uint64(2),
+		uint64(0), uint64(0), uint64(0), uint64(0),
+		uint16(4), uint64(512), uint64(65536), uint16(40), uint16(1), block, uint16(0))
+
+	// The index
+	var records []interface{}
+	for _, id := range []uint64{datatype, dataspace} {
+		records = append(records, 0, uint32(0x1234), uint32(2), id)
+	}
+	index := b.addr()
+	if indexType == sharedIndexList {
+		b.block("SMLI", records)
+	} else {
+		leaf := index
+		b.block("BTLF", 0, btreeSharedMessages, records)
+		index = b.addr()
+		b.block("BTHD", 0, btreeSharedMessages, uint32(512), uint16(17), uint16(0),
+			100, 40, leaf, uint16(2), uint64(2))
+	}
+	table := b.addr()
+	b.block("SMTB", 0, int(indexType), uint16(0x3), uint32(0), uint16(50), uint16(40),
+		uint16(2), index, heap)
+	b.addExtension(v1Message(typeSharedMessageTable, 0, table, 1))
+
+	data := b.addr()
+	b.put(vals)
+	sharedType := []interface{}{3, sharedInHeap, datatype}
+	dtMessage := v1Message(typeDatatype, sharedType...)
+	dtMessage[2] = 2 // shared
+	dsMessage := v1Message(typeDataspace, 3, sharedInHeap, dataspace)
+	dsMessage[2] = 2
+	b.addObject("temp", dsMessage, dtMessage,
+		v1Message(typeDataLayout, 3, classContiguous, data, uint64(4*len(vals))),
+		v1Message(typeAttribute, 3, 1, uint16(6), uint16(10), uint16(16), 0, "valid", 0,
+			sharedType, 1, 1, 0, 0, uint32(0), uint64(2), int32(7), int32(9)))
+	return b.bytes()
+}
+
+func TestSharedMessages(t *testing.T) {
+	vals := []int32{1, 2, 3, 4, 5, 6}
+	exp := [][]int32{{1, 2, 3}, {4, 5, 6}}
+	for _, indexType := range []uint8{sharedIndexList, sharedIndexBTree} {
+		file := sharedMessagesFile(indexType, vals)
+		nc, err := New(nopCloser{bytes.NewReader(file)})
+		if err != nil {
+			t.Error(indexType, err)
+			continue
+		}
+		vr, err := nc.GetVariable("temp")
+		if err != nil {
+			t.Error(indexType, err)
+			nc.Close()
+			continue
+		}
+		if !reflect.DeepEqual(vr.Values, exp) {
+			t.Error(indexType, "got", vr.Values, "exp", exp)
+		}
+		valid, has := vr.Attributes.Get("valid")
+		if !has || !reflect.DeepEqual(valid, []int32{7, 9}) {
+			t.Error(indexType, "got", valid, "exp", []int32{7, 9})
+		}
+		nc.Close()
+	}
+}
+
+func TestSharedMessageMissing(t *testing.T) {
+	file := sharedMessagesFile(sharedIndexList, []int32{1, 2, 3, 4, 5, 6})
+	// Change the heap ID of the variable's dataspace, which comes after the
+	// one in the index, so it isn't found.
+	var id indexBuilder
+	id.put(uint64(30<<8 | 24<<48))
+	file[bytes.LastIndex(file, id.buf.Bytes())+1]++
+	nc, err := New(nopCloser{bytes.NewReader(file)})
+	if err == nil {
+		_, err = nc.GetVariable("temp")
+		nc.Close()
+	}
+	if err != ErrCorrupted {
+		t.Error("expected corrupted, got", err)
+	}
+}
@@ -0,0 +1,306 @@
+package hdf5
+
+// SZIP decompression, which is the CCSDS 121.0 lossless data compression
+// algorithm (also known as AEC) with HDF5's szip parameters.  This decodes
+// the same streams as libaec's szip compatible interface.
+//
+// The data is split into reference sample intervals (RSIs) of blocks of
+// samples.  Each block starts with an ID saying how it was coded:
+//
+//   low entropy:  either runs of all-zero blocks, or the second extension,
+//                 which codes pairs of samples together
+//   split:        each sample as a unary (fundamental sequence) high part
+//                 followed by its k low bits
+//   uncompressed: each sample as is
+//
+// With preprocessing, the first sample of an RSI is a reference sample, and
+// the others are mapped differences from the previous sample.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// szip option mask bits
+const (
+	szipAllowK13 = 1 << iota
+	szipChip
+	szipEntropyCoding
+	szipLSB
+	szipMSB
+	szipNearestNeighbor
+	_
+	szipRaw
+)
+
+// Remainder of segment: a run of zero blocks up to the end of the 64 block
+// segment or the RSI.
+const szipROS = 5
+
+// The second extension codes sums of sample pairs up to this.
+const szipMaxSecondExtension = 12
+
+// szip holds the szip parameters for decoding a chunk.
+type szip struct {
+	bitsPerSample   uint
+	bytesPerSample  int
+	blockSize       int
+	rsi             int // blocks in a reference sample interval
+	preprocess      bool
+	msb             bool
+	idLen           uint
+	xmax            uint64
+	pixelsPerLine   int
+	deinterleave    int // the word size if bytes were deinterleaved
+	padLines        bool
+	secondExtension []int // the sums and first indexes for second extension values
+}
+
+func szipFilter(params []uint32, r io.Reader) (io.Reader, error) {
+	if len(params) < 4 {
+		logger.Error("bad szip params", params)
+		return nil, ErrCorrupted
+	}
+	sz, err := newSzip(params[0], params[1], params[2], params[3])
+	if err != nil {
+		return nil, err
+	}
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return nil, err
+	}
+	in, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return newResetReaderFromBytes(sz.decode(in, int(size))), nil
+}
+
+func newSzip(mask, pixelsPerBlock, bitsPerPixel, pixelsPerLine uint32) (*szip, error) {
+	logger.Infof("szip mask=0x%x pixels per block=%d bits per pixel=%d pixels per line=%d",
+		mask, pixelsPerBlock, bitsPerPixel, pixelsPerLine)
+	if bitsPerPixel == 0 || bitsPerPixel > 32 && bitsPerPixel != 64 ||
+		pixelsPerBlock == 0 || pixelsPerBlock > 64 || pixelsPerLine == 0 {
+		logger.Error("bad szip params")
+		return nil, ErrCorrupted
+	}
+	sz := &szip{
+		bitsPerSample: uint(bitsPerPixel),
+		blockSize:     int(pixelsPerBlock),
+		rsi:           int((pixelsPerLine + pixelsPerBlock - 1) / pixelsPerBlock),
+		preprocess:    mask&szipNearestNeighbor != 0,
+		msb:           mask&szipMSB != 0,
+		pixelsPerLine: int(pixelsPerLine),
+		padLines:      pixelsPerLine%pixelsPerBlock != 0,
+	}
+	if bitsPerPixel == 32 || bitsPerPixel == 64 {
+		// These are compressed as bytes, with the bytes of each word spread
+		// out across the data.
+		sz.deinterleave = int(bitsPerPixel / 8)
+		sz.bitsPerSample = 8
+	}
+	switch {
+	case sz.bitsPerSample > 16:
+		sz.idLen = 5
+		sz.bytesPerSample = 4
+	case sz.bitsPerSample > 8:
+		sz.idLen = 4
+		sz.bytesPerSample = 2
+	default:
+		sz.idLen = 3
+		sz.bytesPerSample = 1
+	}
+	sz.xmax = 1<<sz.bitsPerSample - 1
+	for sum := 0; sum <= szipMaxSecondExtension; sum++ {
+		first := sum * (sum + 1) / 2
+		for i := 0; i <= sum; i++ {
+			sz.secondExtension = append(sz.secondExtension, sum, first)
+		}
+	}
+	return sz, nil
+}
+
+// decode decodes the input into size bytes of output.
+func (sz *szip) decode(in []byte, size int) []byte {
+	nSamples := size / sz.bytesPerSample
+	lines := 0
+	if sz.padLines {
+		// Each line was padded to a whole number of blocks.
+		lines = (nSamples + sz.pixelsPerLine - 1) / sz.pixelsPerLine
+		nSamples = lines * sz.rsi * sz.blockSize
+	}
+	samples := make([]uint64, 0, nSamples)
+	br := newBitReader(newResetReaderFromBytes(in))
+	rsiSamples := sz.rsi * sz.blockSize
+	for len(samples) < nSamples {
+		rsi := sz.decodeRSI(br, nSamples-len(samples))
+		if len(rsi) > rsiSamples {
+			rsi = rsi[:rsiSamples]
+		}
+		if sz.preprocess {
+			sz.postprocess(rsi)
+		}
+		samples = append(samples, rsi...)
+	}
+	samples = samples[:nSamples]
+	if sz.padLines {
+		unpadded := samples[:0]
+		for line := 0; line < lines; line++ {
+			start := line * rsiSamples
+			unpadded = append(unpadded, samples[start:start+sz.pixelsPerLine]...)
+		}
+		samples = unpadded
+	}
+	out := make([]byte, len(samples)*sz.bytesPerSample)
+	for i, s := range samples {
+		b := out[i*sz.bytesPerSample:]
+		switch {
+		case sz.bytesPerSample == 1:
+			b[0] = byte(s)
+		case sz.bytesPerSample == 2 && sz.msb:
+			binary.BigEndian.PutUint16(b, uint16(s))
+		case sz.bytesPerSample == 2:
+			binary.LittleEndian.PutUint16(b, uint16(s))
+		case sz.msb:
+			binary.BigEndian.PutUint32(b, uint32(s))
+		default:
+			binary.LittleEndian.PutUint32(b, uint32(s))
+		}
+	}
+	if len(out) > size {
+		out = out[:size]
+	}
+	if sz.deinterleave > 0 {
+		n := len(out) / sz.deinterleave
+		interleaved := make([]byte, len(out))
+		for i := 0; i < n; i++ {
+			for j := 0; j < sz.deinterleave; j++ {
+				interleaved[i*sz.deinterleave+j] = out[j*n+i]
+			}
+		}
+		out = interleaved
+	}
+	return out
+}
+
+// decodeRSI decodes the blocks of a reference sample interval, stopping
+// early once it has at least max samples.
+func (sz *szip) decodeRSI(br *bitReader, max int) []uint64 {
+	rsi := make([]uint64, 0, sz.rsi*sz.blockSize)
+	for block := 0; block < sz.rsi && len(rsi) < max; {
+		ref := 0
+		if sz.preprocess && block == 0 {
+			ref = 1
+		}
+		id := br.readBits(sz.idLen)
+		switch {
+		case id == 0:
+			// low entropy
+			secondExtension := br.readBits(1) == 1
+			if ref == 1 {
+				rsi = append(rsi, br.readBits(sz.bitsPerSample))
+			}
+			if secondExtension {
+				rsi = sz.decodeSecondExtension(br, rsi, ref)
+				block++
+				continue
+			}
+			zeroBlocks := int(readFS(br)) + 1
+			switch {
+			case zeroBlocks == szipROS:
+				zeroBlocks = 64 - block%64
+				if sz.rsi-block < zeroBlocks {
+					zeroBlocks = sz.rsi - block
+				}
+			case zeroBlocks > szipROS:
+				zeroBlocks--
+			}
+			for i := ref; i < zeroBlocks*sz.blockSize; i++ {
+				rsi = append(rsi, 0)
+			}
+			block += zeroBlocks
+		case id == 1<<sz.idLen-1:
+			// uncompressed
+			for i := 0; i < sz.blockSize; i++ {
+				rsi = append(rsi, br.readBits(sz.bitsPerSample))
+			}
+			block++
+		default:
+			// split
+			k := uint(id - 1)
+			if ref == 1 {
+				rsi = append(rsi, br.readBits(sz.bitsPerSample))
+			}
+			start := len(rsi)
+			for i := ref; i < sz.blockSize; i++ {
+				rsi = append(rsi, readFS(br)<<k)
+			}
+			if k > 0 {
+				for i := start; i < len(rsi); i++ {
+					rsi[i] |= br.readBits(k)
+				}
+			}
+			block++
+		}
+	}
+	return rsi
+}
+
+// decodeSecondExtension decodes a block coded with the second extension.
+// Each value codes a pair of samples.  If there is a reference sample, it
+// takes the place of the first sample of the first pair.
+func (sz *szip) decodeSecondExtension(br *bitReader, rsi []uint64, ref int) []uint64 {
+	for i := ref; i < sz.blockSize; {
+		m := int(readFS(br))
+		assertError(2*m+1 < len(sz.secondExtension), ErrCorrupted,
+			fmt.Sprint("bad szip second extension value: ", m))
+		sum := sz.secondExtension[2*m]
+		second := m - sz.secondExtension[2*m+1]
+		if i%2 == 0 {
+			rsi = append(rsi, uint64(sum-second))
+			i++
+		}
+		rsi = append(rsi, uint64(second))
+		i++
+	}
+	return rsi
+}
+
+// postprocess converts the mapped differences following the reference
+// sample back into samples.
+func (sz *szip) postprocess(rsi []uint64) {
+	if len(rsi) == 0 {
+		return
+	}
+	prev := rsi[0]
+	for i := 1; i < len(rsi); i++ {
+		d := rsi[i]
+		theta := prev
+		if sz.xmax-prev < theta {
+			theta = sz.xmax - prev
+		}
+		switch {
+		case d <= 2*theta && d%2 == 0:
+			prev += d / 2
+		case d <= 2*theta:
+			prev -= (d + 1) / 2
+		case theta == prev:
+			prev = d
+		default:
+			prev = sz.xmax - d
+		}
+		rsi[i] = prev
+	}
+}
+
+// readFS reads a fundamental sequence code, which is the number of zero bits
+// before a one bit.
+func readFS(br *bitReader) uint64 {
+	n := uint64(0)
+	for br.readBits(1) == 0 {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,316 @@
+package hdf5
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/batchatco/go-thrower"
+)
+
+// szipEncoder is a simple CCSDS 121.0 encoder, which uses each coding option
+// in turn so they all get tested.
+type szipEncoder struct {
+	bw         bitWriter
+	bits       uint
+	idLen      uint
+	blockSize  int
+	rsi        int
+	preprocess bool
+	block      int // number of blocks coded, to choose the option
+}
+
+func (e *szipEncoder) writeFS(n uint64) {
+	e.bw.writeBits(1, uint(n)+1)
+}
+
+// mapDifferences replaces all but the first sample with mapped differences.
+func (e *szipEncoder) mapDifferences(rsi []uint64) {
+	xmax := int64(1)<<e.bits - 1
+	prev := int64(rsi[0])
+	for i := 1; i < len(rsi); i++ {
+		x := int64(rsi[i])
+		delta := x - prev
+		theta := prev
+		if xmax-prev < theta {
+			theta = xmax - prev
+		}
+		switch {
+		case delta >= 0 && delta <= theta:
+			rsi[i] = uint64(2 * delta)
+		case delta < 0 && -delta <= theta:
+			rsi[i] = uint64(-2*delta - 1)
+		case delta < 0:
+			rsi[i] = uint64(theta - delta)
+		default:
+			rsi[i] = uint64(theta + delta)
+		}
+		prev = x
+	}
+}
+
+func (e *szipEncoder) encode(samples []uint64) []byte {
+	rsiSamples := e.rsi * e.blockSize
+	for start := 0; start < len(samples); start += rsiSamples {
+		end := start + rsiSamples
+		if end > len(samples) {
+			end = len(samples)
+		}
+		rsi := append([]uint64{}, samples[start:end]...)
+		for len(rsi)%e.blockSize != 0 {
+			rsi = append(rsi, rsi[len(rsi)-1])
+		}
+		if e.preprocess {
+			e.mapDifferences(rsi)
+		}
+		e.encodeRSI(rsi)
+	}
+	return e.bw.b
+}
+
+func allZero(vals []uint64) bool {
+	for _, v := range vals {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *szipEncoder) encodeRSI(rsi []uint64) {
+	nBlocks := len(rsi) / e.blockSize
+	for b := 0; b < nBlocks; {
+		ref := 0
+		if e.preprocess && b == 0 {
+			ref = 1
+		}
+		block := rsi[b*e.blockSize : (b+1)*e.blockSize]
+		e.block++
+		if allZero(block[ref:]) {
+			// Count the zero blocks to the end of the segment.
+			z := 1
+			for b+z < nBlocks && (b+z)%64 != 0 &&
+				allZero(rsi[(b+z)*e.blockSize:(b+z+1)*e.blockSize]) {
+				z++
+			}
+			e.bw.writeBits(0, e.idLen+1)
+			if ref == 1 {
+				e.bw.writeBits(block[0], e.bits)
+			}
+			switch {
+			case (b+z)%64 == 0 || b+z == nBlocks && b+z == e.rsi:
+				e.writeFS(szipROS - 1)
+			case z < szipROS:
+				e.writeFS(uint64(z - 1))
+			default:
+				e.writeFS(uint64(z))
+			}
+			b += z
+			continue
+		}
+		// The reference sample counts as zero in its pair.
+		pair := func(i int) uint64 {
+			if i == 0 && ref == 1 {
+				return 0
+			}
+			return block[i]
+		}
+		secondExtension := true
+		for i := 0; i < len(block); i += 2 {
+			if i+1 < len(block) && pair(i)+block[i+1] > szipMaxSecondExtension {
+				secondExtension = false
+			}
+		}
+		// Choose k so the fundamental sequences are short.
+		k := uint(0)
+		for _, v := range block[ref:] {
+			for v>>k > 4 {
+				k++
+			}
+		}
+		switch {
+		case e.block%3 == 0 && secondExtension:
+			e.bw.writeBits(0, e.idLen)
+			e.bw.writeBits(1, 1)
+			if ref == 1 {
+				e.bw.writeBits(block[0], e.bits)
+			}
+			for i := 0; i < len(block); i += 2 {
+				sum := pair(i) + block[i+1]
+				e.writeFS(sum*(sum+1)/2 + block[i+1])
+			}
+		case e.block%3 == 1 || k+1 >= 1<<e.idLen-1:
+			e.bw.writeBits(1<<e.idLen-1, e.idLen)
+			for _, v := range block {
+				e.bw.writeBits(v, e.bits)
+			}
+		default:
+			e.bw.writeBits(uint64(k+1), e.idLen)
+			if ref == 1 {
+				e.bw.writeBits(block[0], e.bits)
+			}
+			for _, v := range block[ref:] {
+				e.writeFS(v >> k)
+			}
+			for _, v := range block[ref:] {
+				e.bw.writeBits(v&(1<<k-1), k)
+			}
+		}
+		b++
+	}
+}
+
+// szipChunk returns a chunk for the szip filter.
+func szipChunk(e *szipEncoder, samples []uint64, size int) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, uint32(size))
+	return append(b, e.encode(samples)...)
+}
+
+func szipDecode(params []uint32, chunk []byte) (b []byte, err error) {
+	defer thrower.RecoverError(&err)
+	r, err := szipFilter(params, bytes.NewReader(chunk))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+// testSamples returns smooth data with some runs of zeros.
+func testSamples(n int, bits uint) []uint64 {
+	rng := rand.New(rand.NewSource(1))
+	xmax := float64(uint64(1)<<bits - 1)
+	samples := make([]uint64, n)
+	for i := range samples {
+		switch {
+		case i%500 < 150:
+			// zeros
+		case i%500 < 160:
+			samples[i] = uint64(rng.Float64() * xmax)
+		default:
+			v := xmax/2 + xmax/2*math.Sin(float64(i)/40)
+			samples[i] = uint64(v)
+		}
+	}
+	return samples
+}
+
+func TestSzip(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		bits          uint
+		blockSize     int
+		pixelsPerLine int
+		mask          uint32
+	}{
+		{"8 bits", 8, 8, 64, szipEntropyCoding},
+		{"8 bits preprocessed", 8, 16, 128, szipNearestNeighbor},
+		{"12 bits msb", 12, 32, 256, szipNearestNeighbor | szipMSB},
+		{"16 bits lsb", 16, 32, 320, szipNearestNeighbor | szipLSB},
+		{"24 bits", 24, 8, 64, szipNearestNeighbor},
+		{"padded lines", 8, 8, 60, szipNearestNeighbor},
+		{"long lines", 8, 32, 4096, szipNearestNeighbor},
+		{"3 bits", 3, 8, 16, szipEntropyCoding},
+	} {
+		e := &szipEncoder{bits: tc.bits, blockSize: tc.blockSize,
+			rsi:        (tc.pixelsPerLine + tc.blockSize - 1) / tc.blockSize,
+			preprocess: tc.mask&szipNearestNeighbor != 0}
+		sz, err := newSzip(tc.mask, uint32(tc.blockSize), uint32(tc.bits),
+			uint32(tc.pixelsPerLine))
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.idLen = sz.idLen
+		samples := testSamples(2000, tc.bits)
+		var exp []byte
+		var encoded []uint64
+		for i, s := range samples {
+			if tc.pixelsPerLine%tc.blockSize != 0 && i%tc.pixelsPerLine == 0 && i > 0 {
+				// pad the line to a whole number of blocks
+				for len(encoded)%tc.blockSize != 0 {
+					encoded = append(encoded, encoded[len(encoded)-1])
+				}
+			}
+			encoded = append(encoded, s)
+			b := make([]byte, sz.bytesPerSample)
+			switch {
+			case sz.bytesPerSample == 1:
+				b[0] = byte(s)
+			case sz.bytesPerSample == 2 && sz.msb:
+				binary.BigEndian.PutUint16(b, uint16(s))
+			case sz.bytesPerSample == 2:
+				binary.LittleEndian.PutUint16(b, uint16(s))
+			default:
+				binary.LittleEndian.PutUint32(b, uint32(s))
+			}
+			exp = append(exp, b...)
+		}
+		for tc.pixelsPerLine%tc.blockSize != 0 && len(encoded)%(e.rsi*tc.blockSize) != 0 {
+			// and the last line is padded to a whole line
+			encoded = append(encoded, encoded[len(encoded)-1])
+		}
+		params := []uint32{tc.mask, uint32(tc.blockSize), uint32(tc.bits),
+			uint32(tc.pixelsPerLine)}
+		got, err := szipDecode(params, szipChunk(e, encoded, len(exp)))
+		if err != nil {
+			t.Error(tc.name, err)
+			continue
+		}
+		if !bytes.Equal(got, exp) {
+			for i := range got {
+				if got[i] != exp[i] {
+					t.Error(tc.name, "first difference at", i, "got", got[i], "exp", exp[i])
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestSzipDeinterleave(t *testing.T) {
+	// 32-bit values are compressed as bytes, grouped by their position in
+	// the word.
+	vals := make([]float32, 100)
+	for i := range vals {
+		vals[i] = float32(i) / 3
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, vals)
+	exp := buf.Bytes()
+	n := len(vals)
+	deinterleaved := make([]uint64, len(exp))
+	for i := 0; i < n; i++ {
+		for j := 0; j < 4; j++ {
+			deinterleaved[j*n+i] = uint64(exp[i*4+j])
+		}
+	}
+	e := &szipEncoder{bits: 8, idLen: 3, blockSize: 8, rsi: 4, preprocess: true}
+	params := []uint32{szipNearestNeighbor | szipLSB, 8, 32, 32}
+	got, err := szipDecode(params, szipChunk(e, deinterleaved, len(exp)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotVals := make([]float32, n)
+	binary.Read(bytes.NewReader(got), binary.LittleEndian, gotVals)
+	if !reflect.DeepEqual(gotVals, vals) {
+		t.Error("got", gotVals, "exp", vals)
+	}
+}
+
+func TestSzipErrors(t *testing.T) {
+	_, err := szipDecode([]uint32{0, 0, 8, 32}, []byte{0, 0, 0, 0})
+	if err != ErrCorrupted {
+		t.Error("expected corrupted, got", err)
+	}
+	// Truncated data
+	e := &szipEncoder{bits: 8, idLen: 3, blockSize: 8, rsi: 4}
+	chunk := szipChunk(e, testSamples(300, 8)[150:214], 64)
+	_, err = szipDecode([]uint32{0, 8, 8, 32}, chunk[:len(chunk)-10])
+	if err != ErrCorrupted {
+		t.Error("expected corrupted, got", err)
+	}
+}
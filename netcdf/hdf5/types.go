@@ -17,6 +17,8 @@ type typeManager interface {
 
 type heapReader interface {
 	readGlobalHeap(heapAddress uint64, index uint32) (remReader, uint64)
+	readAddr(r io.Reader) uint64
+	readRegion(heapAddr uint64, index uint32) RegionReference
 }
 
 type caster interface {
@@ -98,12 +100,7 @@ func printDatatype(hr heapReader, c caster, bf remReader, df remReader, objCount
 	case dtversionPacked:
 		logger.Info("VAX and/or packed datatype")
 	case dtversionV4:
-		if maxDTVersion == dtversionV4 {
-			// allowed
-			logger.Info("Undocumented datatype version 4")
-			break
-		}
-		fallthrough
+		logger.Info("Datatype version 4")
 	default:
 		fail(fmt.Sprint("Unknown datatype version: ", dtversion))
 	}
@@ -0,0 +1,619 @@
+package hdf5
+
+// Virtual datasets (VDS).
+//
+// The layout message of a virtual dataset points to a global heap object
+// holding a list of mappings.  Each mapping names a source file and a
+// dataset in it, and has two dataspace selections: the source selection
+// picks elements of the source dataset, and the virtual selection says where
+// they go in the virtual dataset.  Both selections have the same number of
+// elements, which are paired up in the order they are visited.  Elements of
+// the virtual dataset not covered by any mapping get the fill value.
+//
+// A source file name of "." is the virtual dataset's own file.  Relative
+// names are looked up in the directory of the virtual dataset's file first,
+// and then in the current directory.  Missing source files and datasets are
+// read as fill values, the same as the HDF5 library does.
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// version of the global heap encoding of the mappings
+const vdsHeapVersion = 0
+
+// dataspace selection types
+const (
+	selectNone = iota
+	selectPoints
+	selectHyperslab
+	selectAll
+)
+
+// hyperslab selection flags
+const hyperslabRegular = 0x1
+
+type virtualMapping struct {
+	fileName    string
+	datasetName string
+	source      *vdsSelection
+	virtual     *vdsSelection
+}
+
+// vdsDim selects count blocks of block consecutive indexes, stride apart,
+// starting at start.
+type vdsDim struct {
+	start, stride, count, block int64
+}
+
+func (d vdsDim) len() int64 {
+	return d.count * d.block
+}
+
+// index returns the i'th selected index.
+func (d vdsDim) index(i int64) int64 {
+	return d.start + i/d.block*d.stride + i%d.block
+}
+
+// vdsSelection is a dataspace selection as a list of boxes, which are visited
+// in order.  A box selects the product of its dimensions' indexes, visited
+// in row-major order.
+type vdsSelection struct {
+	all    bool // the whole dataspace, whose size isn't known until it's read
+	points bool // each box is a point
+	rank   int
+	boxes  [][]vdsDim // none if nothing is selected
+}
+
+// resolve returns the selection's boxes in a dataspace with the given
+// dimensions.
+func (sel *vdsSelection) resolve(dims []uint64) [][]vdsDim {
+	if !sel.all {
+		if len(sel.boxes) == 0 {
+			return nil
+		}
+		assertError(sel.rank == len(dims), ErrCorrupted,
+			fmt.Sprint("selection rank ", sel.rank, " doesn't match dimensions ", dims))
+		return sel.boxes
+	}
+	box := make([]vdsDim, len(dims))
+	for d, dim := range dims {
+		box[d] = vdsDim{0, 1, 1, int64(dim)}
+	}
+	return [][]vdsDim{box}
+}
+
+// selectionSize returns the number of elements in the boxes.
+func selectionSize(boxes [][]vdsDim) int64 {
+	total := int64(0)
+	for _, box := range boxes {
+		n := int64(1)
+		for _, d := range box {
+			n *= d.len()
+		}
+		total += n
+	}
+	return total
+}
+
+// selectionBounds returns the lowest and highest selected index in each
+// dimension.  It returns nils if nothing is selected.
+func selectionBounds(boxes [][]vdsDim, rank int) (lo, hi []int64) {
+	for _, box := range boxes {
+		empty := false
+		for _, d := range box {
+			if d.len() == 0 {
+				empty = true
+			}
+		}
+		if empty {
+			continue
+		}
+		if lo == nil {
+			lo = make([]int64, rank)
+			hi = make([]int64, rank)
+			for d := range box {
+				lo[d] = box[d].start
+				hi[d] = box[d].index(box[d].len() - 1)
+			}
+			continue
+		}
+		for d := range box {
+			if box[d].start < lo[d] {
+				lo[d] = box[d].start
+			}
+			if last := box[d].index(box[d].len() - 1); last > hi[d] {
+				hi[d] = last
+			}
+		}
+	}
+	return lo, hi
+}
+
+// vdsCursor walks through the elements of a selection, a run of consecutive
+// indexes in the last dimension at a time.
+type vdsCursor struct {
+	boxes [][]vdsDim
+	box   int
+	pos   []int64 // position in each dimension of the current box
+}
+
+func newVdsCursor(boxes [][]vdsDim, rank int) *vdsCursor {
+	c := &vdsCursor{boxes: boxes, pos: make([]int64, rank)}
+	c.skipEmpty()
+	return c
+}
+
+func (c *vdsCursor) skipEmpty() {
+	for ; c.box < len(c.boxes); c.box++ {
+		empty := false
+		for _, d := range c.boxes[c.box] {
+			if d.len() == 0 {
+				empty = true
+			}
+		}
+		if !empty {
+			return
+		}
+	}
+}
+
+// run sets coord to the next element, and returns the number of consecutive
+// elements from there in the last dimension.  It returns 0 at the end.
+func (c *vdsCursor) run(coord []int64) int64 {
+	if c.box >= len(c.boxes) {
+		return 0
+	}
+	box := c.boxes[c.box]
+	for d := range box {
+		coord[d] = box[d].index(c.pos[d])
+	}
+	last := box[len(box)-1]
+	p := c.pos[len(box)-1]
+	return last.block - p%last.block
+}
+
+// advance moves n elements forward, which must not be past the end of the
+// current run.
+func (c *vdsCursor) advance(n int64) {
+	box := c.boxes[c.box]
+	d := len(box) - 1
+	c.pos[d] += n
+	for d >= 0 && c.pos[d] == box[d].len() {
+		c.pos[d] = 0
+		d--
+		if d >= 0 {
+			c.pos[d]++
+		}
+	}
+	if d < 0 {
+		c.box++
+		c.skipEmpty()
+	}
+}
+
+// readVirtualMappings reads the mappings of a virtual dataset from the global
+// heap.
+func (h5 *HDF5) readVirtualMappings(obj *object, heapAddress uint64, index uint32) {
+	logger.Infof("virtual mappings heap=0x%x index=%d", heapAddress, index)
+	bf, size := h5.readGlobalHeap(heapAddress, index)
+	assertError(bf != nil && size > 4, ErrCorrupted, "virtual mappings not found")
+	b := make([]byte, size)
+	read(bf, b)
+	sum := computeChecksumStream(newResetReaderFromBytes(b), len(b)-4)
+	bf = newResetReaderFromBytes(b)
+	version := read8(bf)
+	if version != vdsHeapVersion {
+		failError(ErrVirtualStorage, fmt.Sprint("unsupported virtual mapping version: ", version))
+	}
+	nEntries := h5.readLength(bf)
+	logger.Info("virtual mappings", nEntries)
+	for i := uint64(0); i < nEntries; i++ {
+		var m virtualMapping
+		// Percent signs are doubled, because the names can also be patterns
+		// for unlimited mappings.
+		m.fileName = strings.ReplaceAll(readNullTerminatedName(bf, 0), "%%", "%")
+		m.datasetName = strings.ReplaceAll(readNullTerminatedName(bf, 0), "%%", "%")
+		m.source = readSelection(bf)
+		m.virtual = readSelection(bf)
+		logger.Info("virtual mapping from", m.fileName, m.datasetName)
+		obj.virtual = append(obj.virtual, m)
+	}
+	checkVal(sum, read32(bf), "virtual mappings checksum")
+}
+
+// readSelection reads a serialized dataspace selection.
+func readSelection(bf remReader) *vdsSelection {
+	selType := read32(bf)
+	version := read32(bf)
+	logger.Info("selection type", selType, "version", version)
+	switch selType {
+	case selectNone, selectAll:
+		checkVal(1, version, "selection version")
+		skip(bf, 8) // reserved and length
+		if selType == selectAll {
+			return &vdsSelection{all: true}
+		}
+		return &vdsSelection{}
+	case selectPoints:
+		return readPoints(bf, version)
+	case selectHyperslab:
+		return readHyperslabSelection(bf, version)
+	}
+	failError(ErrCorrupted, fmt.Sprint("bad selection type: ", selType))
+	panic("not reached")
+}
+
+// checkEncodedSize checks the size of the integers in a selection.
+func checkEncodedSize(size uint8) int {
+	switch size {
+	case 2, 4, 8:
+		return int(size)
+	}
+	failError(ErrCorrupted, fmt.Sprint("bad selection encoded size: ", size))
+	panic("not reached")
+}
+
+func readPoints(bf remReader, version uint32) *vdsSelection {
+	size := 4
+	switch version {
+	case 1:
+		skip(bf, 8) // reserved and length
+	case 2:
+		size = checkEncodedSize(read8(bf))
+	default:
+		failError(ErrCorrupted, fmt.Sprint("bad point selection version: ", version))
+	}
+	sel := &vdsSelection{rank: int(read32(bf)), points: true}
+	nPoints := readUint(bf, size)
+	assertError(nPoints*uint64(sel.rank)*uint64(size) <= uint64(bf.Rem()), ErrCorrupted,
+		"too many points")
+	for i := uint64(0); i < nPoints; i++ {
+		box := make([]vdsDim, sel.rank)
+		for d := range box {
+			box[d] = vdsDim{int64(readUint(bf, size)), 1, 1, 1}
+		}
+		sel.boxes = append(sel.boxes, box)
+	}
+	return sel
+}
+
+func readHyperslabSelection(bf remReader, version uint32) *vdsSelection {
+	size := 4
+	flags := uint8(0)
+	switch version {
+	case 1:
+		skip(bf, 8) // reserved and length
+	case 2:
+		flags = read8(bf)
+		skip(bf, 4) // length
+		size = 8
+	case 3:
+		flags = read8(bf)
+		size = checkEncodedSize(read8(bf))
+	default:
+		failError(ErrCorrupted, fmt.Sprint("bad hyperslab selection version: ", version))
+	}
+	sel := &vdsSelection{rank: int(read32(bf))}
+	unlimited := uint64(1)<<(8*uint(size)) - 1
+	if size == 8 {
+		unlimited = invalidAddress
+	}
+	if flags&hyperslabRegular != 0 {
+		box := make([]vdsDim, sel.rank)
+		for d := range box {
+			start := readUint(bf, size)
+			stride := readUint(bf, size)
+			count := readUint(bf, size)
+			block := readUint(bf, size)
+			if count == unlimited || block == unlimited {
+				failError(ErrVirtualStorage, "unlimited virtual mappings not supported")
+			}
+			assertError(count <= 1 || stride >= block, ErrCorrupted, "overlapping hyperslab blocks")
+			box[d] = vdsDim{int64(start), int64(stride), int64(count), int64(block)}
+		}
+		sel.boxes = [][]vdsDim{box}
+		return sel
+	}
+	if version == 1 {
+		size = 4
+	}
+	nBlocks := readUint(bf, size)
+	assertError(nBlocks*2*uint64(sel.rank)*uint64(size) <= uint64(bf.Rem()), ErrCorrupted,
+		"too many hyperslab blocks")
+	var blocks [][2][]int64
+	for i := uint64(0); i < nBlocks; i++ {
+		var block [2][]int64
+		for j := range block {
+			block[j] = make([]int64, sel.rank)
+			for d := range block[j] {
+				block[j][d] = int64(readUint(bf, size))
+			}
+		}
+		blocks = append(blocks, block)
+	}
+	sel.boxes = hyperslabRuns(blocks, sel.rank)
+	return sel
+}
+
+// hyperslabRuns splits the blocks, given by their first and last
+// coordinates, into runs in the last dimension, sorted so that their elements
+// are visited in row-major order like the HDF5 library does.
+func hyperslabRuns(blocks [][2][]int64, rank int) [][]vdsDim {
+	var runs [][]vdsDim
+	for _, block := range blocks {
+		first, last := block[0], block[1]
+		empty := false
+		for d := 0; d < rank; d++ {
+			if last[d] < first[d] {
+				empty = true
+			}
+		}
+		if empty || rank == 0 {
+			continue
+		}
+		coord := append([]int64{}, first...)
+		for {
+			run := make([]vdsDim, rank)
+			for d := 0; d < rank-1; d++ {
+				run[d] = vdsDim{coord[d], 1, 1, 1}
+			}
+			run[rank-1] = vdsDim{first[rank-1], 1, 1, last[rank-1] - first[rank-1] + 1}
+			runs = append(runs, run)
+			d := rank - 2
+			for ; d >= 0; d-- {
+				coord[d]++
+				if coord[d] <= last[d] {
+					break
+				}
+				coord[d] = first[d]
+			}
+			if d < 0 {
+				break
+			}
+		}
+	}
+	sortRuns(runs)
+	return runs
+}
+
+func sortRuns(runs [][]vdsDim) {
+	less := func(a, b []vdsDim) bool {
+		for d := range a {
+			if a[d].start != b[d].start {
+				return a[d].start < b[d].start
+			}
+		}
+		return false
+	}
+	// Insertion sort, because the blocks are usually in order already.
+	for i := 1; i < len(runs); i++ {
+		for j := i; j > 0 && less(runs[j], runs[j-1]); j-- {
+			runs[j], runs[j-1] = runs[j-1], runs[j]
+		}
+	}
+}
+
+// virtualSource opens the source dataset of a mapping, using the files
+// already opened.  It returns nil if the source doesn't exist.
+func (h5 *HDF5) virtualSource(m *virtualMapping, files map[string]*HDF5) (*HDF5, *object) {
+	src, has := files[m.fileName]
+	if !has {
+		src = h5.openVirtualSource(m.fileName)
+		files[m.fileName] = src
+	}
+	if src == nil {
+		return nil, nil
+	}
+	obj := src.rootObject
+	for _, name := range strings.Split(canonicalizePath(m.datasetName), "/") {
+		if name == "" {
+			continue
+		}
+		child, has := obj.children[name]
+		if !has {
+			logger.Warn("virtual source dataset not found:", m.fileName, m.datasetName)
+			return nil, nil
+		}
+		obj = child
+	}
+	if obj.isGroup || obj.objAttr.dimensions == nil {
+		logger.Warn("virtual source is not a dataset:", m.fileName, m.datasetName)
+		return nil, nil
+	}
+	return src, obj
+}
+
+func (h5 *HDF5) openVirtualSource(fileName string) *HDF5 {
+	if fileName == "." {
+		return h5
+	}
+	names := []string{fileName}
+	if !filepath.IsAbs(fileName) && h5.fname != "" {
+		names = []string{filepath.Join(filepath.Dir(h5.fname), fileName), fileName}
+	}
+	for _, name := range names {
+		if _, err := os.Stat(name); err != nil {
+			continue
+		}
+		logger.Info("opening virtual source", name)
+		nc, err := Open(name)
+		if err != nil {
+			logger.Warn("can't open virtual source", name, err)
+			return nil
+		}
+		src := nc.(*HDF5)
+		src.openers = h5.openers
+		return src
+	}
+	logger.Warn("virtual source file not found:", fileName)
+	return nil
+}
+
+// newVirtualReader returns a reader of the whole virtual dataset, or of the
+// slice of it if the object is a slice.
+func (h5 *HDF5) newVirtualReader(obj *object) remReader {
+	attr := obj.objAttr
+	rank := len(attr.dimensions)
+	start := make([]int64, rank)
+	count := make([]int64, rank)
+	stride := make([]int64, rank)
+	for d := range count {
+		count[d] = int64(attr.dimensions[d])
+		stride[d] = 1
+	}
+	if attr.isSlice {
+		start[0] = attr.firstDim
+		count[0] = attr.lastDim - attr.firstDim
+	}
+	return newResetReaderFromBytes(h5.readHyperslab(obj, start, count, stride))
+}
+
+// readVirtual copies the elements of the hyperslab mapped from source datasets
+// into buf.  Elements that aren't mapped are left alone.
+func (h5 *HDF5) readVirtual(obj *object, start, count, stride []int64, buf []byte) {
+	attr := obj.objAttr
+	rank := len(attr.dimensions)
+	assertError(rank > 0, ErrVirtualStorage, "scalar virtual dataset")
+	elemSize := int64(attr.length)
+	files := make(map[string]*HDF5)
+	defer func() {
+		for _, src := range files {
+			if src != nil && src != h5 {
+				src.Close()
+			}
+		}
+	}()
+	dstStride := make([]int64, rank)
+	ds := elemSize
+	for d := rank - 1; d >= 0; d-- {
+		dstStride[d] = ds
+		ds *= count[d]
+	}
+	for i := range obj.virtual {
+		m := &obj.virtual[i]
+		virtual := m.virtual.resolve(attr.dimensions)
+		lo, hi := selectionBounds(virtual, rank)
+		if lo == nil || !boundsIntersect(lo, hi, start, count, stride) {
+			continue
+		}
+		src, srcObj := h5.virtualSource(m, files)
+		if src == nil {
+			continue
+		}
+		srcAttr := srcObj.objAttr
+		if srcAttr.class != attr.class || srcAttr.length != attr.length {
+			failError(ErrVirtualStorage, fmt.Sprint("virtual source ", m.datasetName,
+				" has a different datatype"))
+		}
+		srcRank := len(srcAttr.dimensions)
+		assertError(srcRank > 0, ErrVirtualStorage, "scalar virtual source dataset")
+		source := m.source.resolve(srcAttr.dimensions)
+		assertError(selectionSize(source) == selectionSize(virtual), ErrCorrupted,
+			"virtual mapping selections have different sizes")
+		srcLo, srcHi := selectionBounds(source, srcRank)
+		if srcLo == nil {
+			continue
+		}
+		// Read the part of the source the selection is in.
+		srcCount := make([]int64, srcRank)
+		ones := make([]int64, srcRank)
+		for d := range srcCount {
+			assertError(srcHi[d] < int64(srcAttr.dimensions[d]), ErrCorrupted,
+				"virtual source selection is out of bounds")
+			srcCount[d] = srcHi[d] - srcLo[d] + 1
+			ones[d] = 1
+		}
+		data := src.readHyperslab(srcObj, srcLo, srcCount, ones)
+		srcStride := make([]int64, srcRank)
+		ss := elemSize
+		for d := srcRank - 1; d >= 0; d-- {
+			srcStride[d] = ss
+			ss *= srcCount[d]
+		}
+
+		vc := newVdsCursor(virtual, rank)
+		sc := newVdsCursor(source, srcRank)
+		vCoord := make([]int64, rank)
+		sCoord := make([]int64, srcRank)
+		for {
+			vn := vc.run(vCoord)
+			sn := sc.run(sCoord)
+			if vn == 0 || sn == 0 {
+				break
+			}
+			n := vn
+			if sn < n {
+				n = sn
+			}
+			srcOff := int64(0)
+			for d := range sCoord {
+				srcOff += (sCoord[d] - srcLo[d]) * srcStride[d]
+			}
+			copyVirtualRun(buf, data[srcOff:srcOff+n*elemSize], vCoord, elemSize,
+				start, count, stride, dstStride)
+			vc.advance(n)
+			sc.advance(n)
+		}
+	}
+}
+
+// boundsIntersect returns whether the box from lo to hi might have elements
+// in the hyperslab.
+func boundsIntersect(lo, hi []int64, start, count, stride []int64) bool {
+	for d := range lo {
+		if count[d] == 0 {
+			return false
+		}
+		last := start[d] + (count[d]-1)*stride[d]
+		if hi[d] < start[d] || lo[d] > last {
+			return false
+		}
+	}
+	return true
+}
+
+// copyVirtualRun copies the elements of src, which go in consecutive indexes
+// of the last dimension starting at coord, to their places in the hyperslab
+// in dst.  Elements not in the hyperslab are skipped.
+func copyVirtualRun(dst []byte, src []byte, coord []int64, elemSize int64,
+	start, count, stride, dstStride []int64) {
+	last := len(coord) - 1
+	dstOff := int64(0)
+	for d := 0; d < last; d++ {
+		i := coord[d] - start[d]
+		if i < 0 || i%stride[d] != 0 || i/stride[d] >= count[d] {
+			return
+		}
+		dstOff += i / stride[d] * dstStride[d]
+	}
+	n := int64(len(src)) / elemSize
+	// The first index of the run in the hyperslab
+	first := coord[last]
+	if first < start[last] {
+		first = start[last]
+	}
+	if r := (first - start[last]) % stride[last]; r != 0 {
+		first += stride[last] - r
+	}
+	for x := first; x < coord[last]+n; x += stride[last] {
+		i := (x - start[last]) / stride[last]
+		if i >= count[last] {
+			return
+		}
+		s := (x - coord[last]) * elemSize
+		if stride[last] == 1 {
+			// The rest of the run is contiguous in dst too.
+			remaining := coord[last] + n - x
+			if count[last]-i < remaining {
+				remaining = count[last] - i
+			}
+			copy(dst[dstOff+i*elemSize:], src[s:s+remaining*elemSize])
+			return
+		}
+		copy(dst[dstOff+i*dstStride[last]:], src[s:s+elemSize])
+	}
+}
@@ -0,0 +1,222 @@
+package hdf5
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/batchatco/go-native-netcdf/netcdf/api"
+	"github.com/batchatco/go-thrower"
+)
+
+// The HDF5 tools can't make virtual datasets, so the tests write the source
+// files with the writer and build the mappings by hand.
+
+// selection encodings, ints written as 32 bits
+func selAll() []interface{} {
+	return []interface{}{uint32(selectAll), uint32(1), uint32(0), uint32(0)}
+}
+
+func selRegular(version uint32, start, stride, count, block []uint16) []interface{} {
+	vals := []interface{}{uint32(selectHyperslab), version, uint8(hyperslabRegular)}
+	if version == 3 {
+		vals = append(vals, uint8(2))
+	} else {
+		vals = append(vals, uint32(0))
+	}
+	vals = append(vals, uint32(len(start)))
+	for d := range start {
+		if version == 3 {
+			vals = append(vals, start[d], stride[d], count[d], block[d])
+		} else {
+			vals = append(vals, uint64(start[d]), uint64(stride[d]), uint64(count[d]),
+				uint64(block[d]))
+		}
+	}
+	return vals
+}
+
+// selBlocks is a version 1 irregular hyperslab, given as first and last
+// coordinates.
+func selBlocks(rank int, blocks ...[]uint32) []interface{} {
+	vals := []interface{}{uint32(selectHyperslab), uint32(1), uint32(0), uint32(0),
+		uint32(rank), uint32(len(blocks) / 2)}
+	for _, b := range blocks {
+		for _, v := range b {
+			vals = append(vals, v)
+		}
+	}
+	return vals
+}
+
+// selPoints is a version 2 point selection with 4-byte coordinates.
+func selPoints(rank int, points ...[]uint32) []interface{} {
+	vals := []interface{}{uint32(selectPoints), uint32(2), uint8(4), uint32(rank),
+		uint32(len(points))}
+	for _, p := range points {
+		for _, v := range p {
+			vals = append(vals, v)
+		}
+	}
+	return vals
+}
+
+type vdsMapping struct {
+	file, dataset   string
+	source, virtual []interface{}
+}
+
+// vdsLayout puts the mappings in a global heap and returns a layout message
+// pointing to them.
+func vdsLayout(b *indexBuilder, mappings []vdsMapping) []byte {
+	var heap indexBuilder
+	heap.put(uint8(vdsHeapVersion), uint64(len(mappings)))
+	for _, m := range mappings {
+		heap.put(m.file, 0, m.dataset, 0, m.source, m.virtual)
+	}
+	obj := heap.buf.Bytes()
+	heap.put(computeChecksumStream(newResetReaderFromBytes(obj), len(obj)))
+	obj = heap.buf.Bytes()
+	padded := (len(obj) + 7) &^ 7
+	addr := b.addr()
+	b.put("GCOL", 1, 0, 0, 0, uint64(16+16+padded))
+	b.put(uint16(1), uint16(0), uint32(0), uint64(len(obj)), obj, make([]byte, padded-len(obj)))
+	var msg indexBuilder
+	msg.put(4, classVirtual, addr, uint32(1))
+	return msg.buf.Bytes()
+}
+
+func writeVdsSource(t *testing.T, fileName string, vals [][]int32) {
+	t.Helper()
+	hw, err := OpenWriter(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = hw.AddVar("temp", api.Variable{Values: vals, Dimensions: []string{"y", "x"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = hw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readVds makes a virtual dataset of 3 days of the source's type.
+func readVds(t *testing.T, mappings []vdsMapping) (h5 *HDF5, obj *object, err error) {
+	t.Helper()
+	defer thrower.RecoverError(&err)
+	nc, err := Open("testdata/vdsday1.nc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	src := nc.(*HDF5).rootObject.children["temp"]
+	var b indexBuilder
+	msg := vdsLayout(&b, mappings)
+	file := b.buf.Bytes()
+	h5 = &HDF5{
+		fname:         "testdata/vds.h5",
+		file:          newRaFile(bytes.NewReader(file)),
+		fileSize:      int64(len(file)),
+		sizeOfOffsets: 8,
+		sizeOfLengths: 8,
+	}
+	obj = newObject()
+	attr := *src.objAttr
+	attr.dimensions = []uint64{3, 2, 3}
+	obj.objAttr = &attr
+	fill := int32(-1)
+	obj.fillValue = make([]byte, 4)
+	binary.LittleEndian.PutUint32(obj.fillValue, uint32(fill))
+	h5.readDataLayout(obj, newResetReaderFromBytes(msg))
+	return h5, obj, nil
+}
+
+func TestVirtualDataset(t *testing.T) {
+	day1 := "testdata/vdsday1.nc"
+	day2 := "testdata/vdsday2.nc"
+	defer os.Remove(day1)
+	defer os.Remove(day2)
+	writeVdsSource(t, day1, [][]int32{{100, 101, 102}, {103, 104, 105}})
+	writeVdsSource(t, day2, [][]int32{{200, 201, 202}, {203, 204, 205}})
+	mappings := []vdsMapping{
+		// All of day 1 into the first day
+		{"vdsday1.nc", "/temp", selAll(),
+			selRegular(3, []uint16{0, 0, 0}, []uint16{1, 1, 1}, []uint16{1, 1, 1},
+				[]uint16{1, 2, 3})},
+		// The rows of day 2, listed out of order, into the second day
+		{"vdsday2.nc", "temp",
+			selBlocks(2, []uint32{1, 0}, []uint32{1, 2}, []uint32{0, 0}, []uint32{0, 2}),
+			selRegular(2, []uint16{1, 0, 0}, []uint16{1, 1, 1}, []uint16{1, 2, 1},
+				[]uint16{1, 1, 3})},
+		// Day 3 is missing
+		{"vdsday3.nc", "temp", selAll(),
+			selRegular(3, []uint16{2, 0, 0}, []uint16{1, 1, 1}, []uint16{1, 1, 1},
+				[]uint16{1, 2, 3})},
+		// Except for two points from day 2
+		{"vdsday2.nc", "temp", selPoints(2, []uint32{0, 0}, []uint32{1, 2}),
+			selPoints(3, []uint32{2, 1, 1}, []uint32{2, 0, 0})},
+	}
+	h5, obj, err := readVds(t, mappings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := [][][]int32{
+		{{100, 101, 102}, {103, 104, 105}},
+		{{200, 201, 202}, {203, 204, 205}},
+		{{205, -1, -1}, {-1, 200, -1}},
+	}
+	got := h5.getData(obj)
+	if !reflect.DeepEqual(got, exp) {
+		t.Error("got", got, "exp", exp)
+	}
+
+	slice, err := h5.getHyperslab(obj, []int64{0, 0, 0}, []int64{3, 2, 2}, []int64{1, 1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expSlice := [][][]int32{
+		{{100, 102}, {103, 105}},
+		{{200, 202}, {203, 205}},
+		{{205, -1}, {-1, -1}},
+	}
+	if !reflect.DeepEqual(slice, expSlice) {
+		t.Error("got", slice, "exp", expSlice)
+	}
+
+	obj.objAttr.isSlice = true
+	obj.objAttr.firstDim = 1
+	obj.objAttr.lastDim = 3
+	got = h5.getData(obj)
+	if !reflect.DeepEqual(got, exp[1:]) {
+		t.Error("got", got, "exp", exp[1:])
+	}
+}
+
+func TestVirtualDatasetErrors(t *testing.T) {
+	day1 := "testdata/vdsday1.nc"
+	defer os.Remove(day1)
+	writeVdsSource(t, day1, [][]int32{{100, 101, 102}, {103, 104, 105}})
+	unlimited := selRegular(3, []uint16{0, 0, 0}, []uint16{1, 1, 1},
+		[]uint16{0xffff, 1, 1}, []uint16{1, 2, 3})
+	_, _, err := readVds(t, []vdsMapping{{"vdsday1.nc", "temp", selAll(), unlimited}})
+	if err != ErrVirtualStorage {
+		t.Error("expected virtual storage error, got", err)
+	}
+
+	// The selections must have the same size.
+	h5, obj, err := readVds(t, []vdsMapping{{"vdsday1.nc", "temp", selAll(), selAll()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	func() {
+		defer thrower.RecoverError(&err)
+		_, err = h5.getHyperslab(obj, []int64{0, 0, 0}, []int64{3, 2, 3}, nil)
+	}()
+	if err != ErrCorrupted {
+		t.Error("expected corrupted, got", err)
+	}
+}
@@ -120,14 +120,12 @@ func allocStrings(hr heapReader, bf io.Reader, dimLengths []uint64) interface{}
 	if len(dimLengths) == 0 {
 		// alloc one scalar
 		var length uint32
-		var addr uint64
 		var index uint32
 
 		var err error
 		err = binary.Read(bf, binary.LittleEndian, &length)
 		thrower.ThrowIfError(err)
-		err = binary.Read(bf, binary.LittleEndian, &addr)
-		thrower.ThrowIfError(err)
+		addr := hr.readAddr(bf)
 		err = binary.Read(bf, binary.LittleEndian, &index)
 		thrower.ThrowIfError(err)
 		logger.Infof("String length %d (0x%x), addr 0x%x, index %d (0x%x)",
@@ -146,13 +144,11 @@ func allocStrings(hr heapReader, bf io.Reader, dimLengths []uint64) interface{}
 		values := make([]string, thisDim)
 		for i := uint64(0); i < thisDim; i++ {
 			var length uint32
-			var addr uint64
 			var index uint32
 
 			err := binary.Read(bf, binary.LittleEndian, &length)
 			thrower.ThrowIfError(err)
-			err = binary.Read(bf, binary.LittleEndian, &addr)
-			thrower.ThrowIfError(err)
+			addr := hr.readAddr(bf)
 			err = binary.Read(bf, binary.LittleEndian, &index)
 			thrower.ThrowIfError(err)
 			logger.Infof("String length %d (0x%x), addr 0x%x, index %d (0x%x)",
@@ -182,12 +178,10 @@ func allocVariable(hr heapReader, c caster, bf io.Reader, dimLengths []uint64, a
 		"rem=", bf.(remReader).Rem())
 	if len(dimLengths) == 0 {
 		var length uint32
-		var addr uint64
 		var index uint32
 		err := binary.Read(bf, binary.LittleEndian, &length)
 		thrower.ThrowIfError(err)
-		err = binary.Read(bf, binary.LittleEndian, &addr)
-		thrower.ThrowIfError(err)
+		addr := hr.readAddr(bf)
 		err = binary.Read(bf, binary.LittleEndian, &index)
 		thrower.ThrowIfError(err)
 		logger.Infof("length %d(0x%x) addr 0x%x index %d(0x%x)\n",
@@ -0,0 +1,94 @@
+package netcdf
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/batchatco/go-native-netcdf/netcdf/api"
+)
+
+// ErrTypeMismatch is returned by Read and ReadND when the type asked for is
+// not the type of the variable.  The error returned wraps it, with the name
+// and types.
+var ErrTypeMismatch = errors.New("variable type mismatch")
+
+// Read returns all the values of the named variable in g as a flat slice,
+// in row-major order, and the length of each of its dimensions.  T is the
+// type of one value, such as float32.  Scalars have no dimensions, and
+// strings made from character dimensions are single values.
+func Read[T any](g api.Group, name string) ([]T, []uint64, error) {
+	vals, err := readValues(g, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	want := reflect.TypeOf((*T)(nil)).Elem()
+	v := reflect.ValueOf(vals)
+	var shape []uint64
+	for ty := v.Type(); ty != want; ty = ty.Elem() {
+		if ty.Kind() != reflect.Slice {
+			return nil, nil, mismatch(name, v.Type(), want)
+		}
+		shape = append(shape, 0)
+	}
+	// Dimensions after an empty one have no values to take the length from,
+	// so they are left as zero.
+	for d, e := 0, v; d < len(shape) && e.Len() > 0; d, e = d+1, e.Index(0) {
+		shape[d] = uint64(e.Len())
+	}
+	if len(shape) == 0 {
+		return []T{vals.(T)}, []uint64{}, nil
+	}
+	size := uint64(1)
+	for _, n := range shape {
+		size *= n
+	}
+	flat := make([]T, 0, size)
+	var flatten func(v reflect.Value, depth int)
+	flatten = func(v reflect.Value, depth int) {
+		if depth == 1 {
+			flat = append(flat, v.Interface().([]T)...)
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			flatten(v.Index(i), depth-1)
+		}
+	}
+	flatten(v, len(shape))
+	return flat, shape, nil
+}
+
+// ReadND returns all the values of the named variable in g as S, which is
+// the type of one value with a slice for each dimension, such as [][]float32
+// for a two-dimensional float variable.
+func ReadND[S any](g api.Group, name string) (S, error) {
+	var zero S
+	vals, err := readValues(g, name)
+	if err != nil {
+		return zero, err
+	}
+	s, ok := vals.(S)
+	if !ok {
+		return zero, mismatch(name, reflect.TypeOf(vals), reflect.TypeOf((*S)(nil)).Elem())
+	}
+	return s, nil
+}
+
+func readValues(g api.Group, name string) (interface{}, error) {
+	vg, err := g.GetVarGetter(name)
+	if err != nil {
+		return nil, err
+	}
+	vals, err := vg.Values()
+	if err != nil {
+		return nil, err
+	}
+	if vals == nil {
+		return nil, fmt.Errorf("%w: %s has no values", ErrTypeMismatch, name)
+	}
+	return vals, nil
+}
+
+func mismatch(name string, got reflect.Type, want reflect.Type) error {
+	return fmt.Errorf("%w: %s is %v, not %v", ErrTypeMismatch, name, got, want)
+}
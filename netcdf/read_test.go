@@ -0,0 +1,139 @@
+package netcdf
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/batchatco/go-native-netcdf/netcdf/api"
+	"github.com/batchatco/go-native-netcdf/netcdf/cdf"
+	"github.com/batchatco/go-native-netcdf/netcdf/hdf5"
+)
+
+type writer interface {
+	AddVar(name string, vr api.Variable) error
+	Close() error
+}
+
+var readVars = []struct {
+	name string
+	vr   api.Variable
+}{
+	{"temp", api.Variable{
+		Values:     [][]float32{{1, 2, 3}, {4, 5, 6}},
+		Dimensions: []string{"y", "x"}}},
+	{"levels", api.Variable{
+		Values:     [][][]int16{{{1, 2}, {3, 4}}, {{5, 6}, {7, 8}}, {{9, 10}, {11, 12}}},
+		Dimensions: []string{"z", "y", "w"}}},
+	{"count", api.Variable{
+		Values:     int32(42),
+		Dimensions: nil}},
+}
+
+func writeReadFile(t *testing.T, fileName string, w writer, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(fileName, err)
+	}
+	for _, v := range readVars {
+		err = w.AddVar(v.name, v.vr)
+		if err != nil {
+			t.Fatal(fileName, v.name, err)
+		}
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(fileName, err)
+	}
+}
+
+func TestRead(t *testing.T) {
+	cdfName := "testdata/read.nc"
+	cw, err := cdf.OpenWriter(cdfName)
+	defer os.Remove(cdfName)
+	writeReadFile(t, cdfName, cw, err)
+	hdfName := "testdata/read.h5"
+	hw, err := hdf5.OpenWriter(hdfName)
+	defer os.Remove(hdfName)
+	writeReadFile(t, hdfName, hw, err)
+
+	for _, fileName := range []string{cdfName, hdfName} {
+		g, err := Open(fileName)
+		if err != nil {
+			t.Error(fileName, err)
+			continue
+		}
+		temp, shape, err := Read[float32](g, "temp")
+		if err != nil {
+			t.Error(fileName, err)
+		} else {
+			if !reflect.DeepEqual(temp, []float32{1, 2, 3, 4, 5, 6}) {
+				t.Error(fileName, "got", temp)
+			}
+			if !reflect.DeepEqual(shape, []uint64{2, 3}) {
+				t.Error(fileName, "got shape", shape)
+			}
+		}
+		levels, shape, err := Read[int16](g, "levels")
+		if err != nil {
+			t.Error(fileName, err)
+		} else {
+			if !reflect.DeepEqual(levels, []int16{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}) {
+				t.Error(fileName, "got", levels)
+			}
+			if !reflect.DeepEqual(shape, []uint64{3, 2, 2}) {
+				t.Error(fileName, "got shape", shape)
+			}
+		}
+		count, shape, err := Read[int32](g, "count")
+		if err != nil {
+			t.Error(fileName, err)
+		} else if !reflect.DeepEqual(count, []int32{42}) || len(shape) != 0 {
+			t.Error(fileName, "got", count, shape)
+		}
+
+		nd, err := ReadND[[][]float32](g, "temp")
+		if err != nil {
+			t.Error(fileName, err)
+		} else if !reflect.DeepEqual(nd, readVars[0].vr.Values) {
+			t.Error(fileName, "got", nd)
+		}
+		scalar, err := ReadND[int32](g, "count")
+		if err != nil || scalar != 42 {
+			t.Error(fileName, "got", scalar, err)
+		}
+		g.Close()
+	}
+}
+
+func TestReadMismatch(t *testing.T) {
+	fileName := "testdata/mismatch.nc"
+	cw, err := cdf.OpenWriter(fileName)
+	defer os.Remove(fileName)
+	writeReadFile(t, fileName, cw, err)
+	g, err := Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	_, _, err = Read[float64](g, "temp")
+	if !errors.Is(err, ErrTypeMismatch) {
+		t.Error("expected type mismatch, got", err)
+	} else if err.Error() != "variable type mismatch: temp is [][]float32, not float64" {
+		t.Error("got", err)
+	}
+	_, _, err = Read[int16](g, "count")
+	if !errors.Is(err, ErrTypeMismatch) {
+		t.Error("expected type mismatch, got", err)
+	}
+	_, err = ReadND[[]float32](g, "temp")
+	if !errors.Is(err, ErrTypeMismatch) {
+		t.Error("expected type mismatch, got", err)
+	}
+	_, _, err = Read[float32](g, "nothing")
+	if err == nil || errors.Is(err, ErrTypeMismatch) {
+		t.Error("expected not found, got", err)
+	}
+}
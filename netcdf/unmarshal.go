@@ -0,0 +1,145 @@
+package netcdf
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/batchatco/go-native-netcdf/netcdf/api"
+	"github.com/batchatco/go-native-netcdf/netcdf/hdf5"
+)
+
+// compound is implemented by values made of named members, such as HDF5
+// compounds.
+type compound interface {
+	Member(name string) (interface{}, bool)
+}
+
+var errMismatch = errors.New("mismatch")
+
+// Unmarshal fills the fields of the struct that v points to from the
+// variables and attributes of g.  A field tagged `netcdf:"name"` gets the
+// values of the variable with that name, and one tagged `netcdf:"@name"` gets
+// the global attribute with that name.  Other fields are left alone.
+//
+// The type of each field must be the type of the values, except that
+// compounds can be unmarshaled into structs, at any depth of slices.  The
+// fields of those structs are matched with members by their netcdf tag, or
+// by their name if they have none.
+//
+// An error wrapping ErrTypeMismatch is returned if the types do not match, and
+// one wrapping hdf5.ErrNonExportedField if a tagged field is not exported.
+func Unmarshal(g api.Group, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("can't unmarshal into %T, need a pointer to a struct", v)
+	}
+	st := rv.Elem()
+	for i := 0; i < st.NumField(); i++ {
+		field := st.Type().Field(i)
+		tag, has := field.Tag.Lookup("netcdf")
+		if !has || tag == "-" {
+			continue
+		}
+		if field.PkgPath != "" {
+			return fmt.Errorf("%w: %s", hdf5.ErrNonExportedField, field.Name)
+		}
+		var val interface{}
+		if strings.HasPrefix(tag, "@") {
+			val, has = g.Attributes().Get(tag[1:])
+			if !has {
+				return fmt.Errorf("attribute %s not found", tag[1:])
+			}
+		} else {
+			var err error
+			val, err = readValues(g, tag)
+			if err != nil {
+				return err
+			}
+		}
+		err := assign(st.Field(i), reflect.ValueOf(val))
+		if err == errMismatch {
+			return mismatch(tag, reflect.TypeOf(val), field.Type)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// assign sets dst to src, converting compounds to structs.
+func assign(dst reflect.Value, src reflect.Value) error {
+	if src.Kind() == reflect.Interface {
+		src = src.Elem()
+	}
+	if !src.IsValid() {
+		return errMismatch
+	}
+	if src.Type().AssignableTo(dst.Type()) {
+		dst.Set(src)
+		return nil
+	}
+	switch dst.Kind() {
+	case reflect.Struct:
+		c, ok := src.Interface().(compound)
+		if !ok {
+			return errMismatch
+		}
+		for i := 0; i < dst.NumField(); i++ {
+			field := dst.Type().Field(i)
+			name := field.Name
+			tag, has := field.Tag.Lookup("netcdf")
+			switch {
+			case tag == "-":
+				continue
+			case field.PkgPath != "":
+				if has {
+					return fmt.Errorf("%w: %s", hdf5.ErrNonExportedField, field.Name)
+				}
+				continue
+			case has:
+				name = tag
+			}
+			val, has := c.Member(name)
+			if !has {
+				return fmt.Errorf("%w: compound has no member %s for field %s",
+					ErrTypeMismatch, name, field.Name)
+			}
+			err := assign(dst.Field(i), reflect.ValueOf(val))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Slice:
+		if src.Kind() != reflect.Slice {
+			return errMismatch
+		}
+		s := reflect.MakeSlice(dst.Type(), src.Len(), src.Len())
+		for i := 0; i < src.Len(); i++ {
+			err := assign(s.Index(i), src.Index(i))
+			if err != nil {
+				return err
+			}
+		}
+		dst.Set(s)
+		return nil
+
+	case reflect.Array:
+		if (src.Kind() != reflect.Slice && src.Kind() != reflect.Array) ||
+			src.Len() != dst.Len() {
+			return errMismatch
+		}
+		for i := 0; i < src.Len(); i++ {
+			err := assign(dst.Index(i), src.Index(i))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return errMismatch
+}
@@ -0,0 +1,169 @@
+package netcdf
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/batchatco/go-native-netcdf/netcdf/cdf"
+	"github.com/batchatco/go-native-netcdf/netcdf/hdf5"
+	"github.com/batchatco/go-native-netcdf/netcdf/util"
+)
+
+func TestUnmarshal(t *testing.T) {
+	fileName := "testdata/unmarshal.nc"
+	cw, err := cdf.OpenWriter(fileName)
+	defer os.Remove(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrs, err := util.NewOrderedMap([]string{"title", "version"},
+		map[string]interface{}{"title": "unmarshal test", "version": int32(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cw.AddGlobalAttrs(attrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeReadFile(t, fileName, cw, nil)
+	g, err := Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	var data struct {
+		Title   string        `netcdf:"@title"`
+		Version int32         `netcdf:"@version"`
+		Temp    [][]float32   `netcdf:"temp"`
+		Levels  [][][2]int16  `netcdf:"levels"`
+		Count   int32         `netcdf:"count"`
+		Skipped string        `netcdf:"-"`
+		Other   int           // not tagged
+		Any     interface{}   `netcdf:"count"`
+		Rows    [2][3]float32 `netcdf:"temp"`
+	}
+	data.Other = 5
+	err = Unmarshal(g, &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Title != "unmarshal test" || data.Version != 2 || data.Count != 42 ||
+		data.Any != int32(42) || data.Other != 5 || data.Skipped != "" {
+		t.Error("got", data)
+	}
+	if !reflect.DeepEqual(data.Temp, readVars[0].vr.Values) {
+		t.Error("got temp", data.Temp)
+	}
+	if !reflect.DeepEqual(data.Levels,
+		[][][2]int16{{{1, 2}, {3, 4}}, {{5, 6}, {7, 8}}, {{9, 10}, {11, 12}}}) {
+		t.Error("got levels", data.Levels)
+	}
+	if data.Rows != [2][3]float32{{1, 2, 3}, {4, 5, 6}} {
+		t.Error("got rows", data.Rows)
+	}
+
+	var wrongType struct {
+		Temp [][]float64 `netcdf:"temp"`
+	}
+	err = Unmarshal(g, &wrongType)
+	if !errors.Is(err, ErrTypeMismatch) {
+		t.Error("expected type mismatch, got", err)
+	} else if err.Error() != "variable type mismatch: temp is [][]float32, not [][]float64" {
+		t.Error("got", err)
+	}
+	var wrongLength struct {
+		Rows [3][3]float32 `netcdf:"temp"`
+	}
+	err = Unmarshal(g, &wrongLength)
+	if !errors.Is(err, ErrTypeMismatch) {
+		t.Error("expected type mismatch, got", err)
+	}
+	var notExported struct {
+		count int32 `netcdf:"count"`
+	}
+	err = Unmarshal(g, &notExported)
+	if !errors.Is(err, hdf5.ErrNonExportedField) {
+		t.Error("expected non-exported field, got", err)
+	}
+	var noAttr struct {
+		Title string `netcdf:"@nothing"`
+	}
+	err = Unmarshal(g, &noAttr)
+	if err == nil {
+		t.Error("expected attribute not found")
+	}
+	var noVar struct {
+		Title string `netcdf:"nothing"`
+	}
+	err = Unmarshal(g, &noVar)
+	if err == nil {
+		t.Error("expected variable not found")
+	}
+	err = Unmarshal(g, data)
+	if err == nil {
+		t.Error("expected error for non-pointer")
+	}
+}
+
+type position struct {
+	A uint8 `netcdf:"a"`
+	B uint8 `netcdf:"b"`
+}
+
+type observation struct {
+	ID       int16    `netcdf:"id"`
+	Temp     float32  `netcdf:"temp"`
+	Position position `netcdf:"pos"`
+	note     string
+}
+
+func TestUnmarshalCompound(t *testing.T) {
+	// compound.h5 has a variable obs of two compounds:
+	// {int16 id; float32 temp; {uint8 a; uint8 b} pos}
+	g, err := Open("testdata/compound.h5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	var data struct {
+		Obs []observation `netcdf:"obs"`
+	}
+	err = Unmarshal(g, &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []observation{
+		{7, 1.5, position{1, 2}, ""},
+		{-3, -20, position{3, 4}, ""},
+	}
+	if !reflect.DeepEqual(data.Obs, exp) {
+		t.Error("got", data.Obs)
+	}
+
+	var missing struct {
+		Obs []struct {
+			ID    int16
+			Depth float32
+		} `netcdf:"obs"`
+	}
+	err = Unmarshal(g, &missing)
+	if !errors.Is(err, ErrTypeMismatch) {
+		t.Error("expected type mismatch, got", err)
+	} else if !strings.Contains(err.Error(), "member ID") {
+		t.Error("expected the missing member in", err)
+	}
+	var notExported struct {
+		Obs []struct {
+			id int16 `netcdf:"id"`
+		} `netcdf:"obs"`
+	}
+	err = Unmarshal(g, &notExported)
+	if !errors.Is(err, hdf5.ErrNonExportedField) {
+		t.Error("expected non-exported field, got", err)
+	}
+}